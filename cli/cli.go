@@ -0,0 +1,279 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"patrol_install/steps/build/steps/changed_tests"
+	create_parameters "patrol_install/steps/build/steps/create_parameters"
+	"patrol_install/steps/build_matrix"
+	"patrol_install/utils/print"
+	"patrol_install/utils/step_config"
+	"patrol_install/utils/step_inputs"
+)
+
+// ProgramName is how the binary is called in usage texts.
+const ProgramName = "patrol_build"
+
+// Exit codes of Run.
+const (
+	ExitOK     = 0
+	ExitFailed = 1
+	ExitUsage  = 2
+)
+
+// command is a subcommand and the step inputs it reads.
+type command struct {
+	name    string
+	summary string
+	inputs  []string
+	run     func(ctx context.Context) error
+}
+
+// builds reports whether the command runs the build stage, whose settings are validated upfront.
+func (c command) builds() bool {
+	return c.name == "build" || c.name == "run"
+}
+
+func commands() []command {
+	retryInputs := []string{"retry_count", "retry_initial_delay"}
+	outputInputs := []string{"output_exporter", "output_file"}
+	buildInputs := []string{"test_target_directory", "platform", "test_build_type", "flavor", "tags", "excluded_tags", "tag_check", "changed_tests_base_ref", "changed_tests_mapping", "is_verbose_mode", "clean_build_outputs"}
+	exportInputs := []string{"platform", "test_build_type", "flavor", "symlink_policy", "hardlink_artifacts", "artifacts_dir", "artifact_name_template", "export_mode"}
+	testInputs := []string{"test_target_directory", "tags", "excluded_tags", "shard_count", "shard_timings_file"}
+
+	configInputs := []string{step_config.FileInputKey}
+
+	return []command{
+		{"install", "Install the Patrol CLI when it is missing", concat(configInputs, []string{"custom_patrol_cli_version"}, retryInputs), func(ctx context.Context) error {
+			return installStage(ctx)
+		}},
+		{"validate", "Check that Flutter, Patrol and the installed Patrol CLI are compatible", configInputs, func(ctx context.Context) error {
+			return validateStage(ctx)
+		}},
+		{"build", "Build the Patrol test apps", concat(configInputs, buildInputs, retryInputs, outputInputs), func(ctx context.Context) error {
+			return buildStage(ctx)
+		}},
+		{"export", "Copy the built apps into the artifacts folder and export their paths", concat(configInputs, exportInputs, testInputs, outputInputs), func(ctx context.Context) error {
+			return exportStage(ctx)
+		}},
+		{"run", "Install, validate, build and export, like the Bitrise step", nil, func(ctx context.Context) error {
+			return allStages(ctx)
+		}},
+	}
+}
+
+// CLI runs the subcommands, with flags generated from the inputs of step.yml.
+type CLI struct {
+	inputs  []step_inputs.Input
+	version string
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+// New returns a CLI for the given step.yml contents and version.
+func New(stepYml []byte, version string) (*CLI, error) {
+	inputs, err := step_inputs.Parse(stepYml)
+	if err != nil {
+		return nil, err
+	}
+	return &CLI{inputs: inputs, version: version, stdout: os.Stdout, stderr: os.Stderr}, nil
+}
+
+// Run executes the command named by args[0] and returns the exit code. Without arguments every
+// stage runs and the exit code is always ExitOK, as the Bitrise step has always done.
+func (c *CLI) Run(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		if err := c.configure(c.inputs, nil, false, true); err != nil {
+			print.Error(err.Error())
+			return ExitOK
+		}
+		_ = allStages(ctx)
+		return ExitOK
+	}
+
+	name := args[0]
+	switch name {
+	case "version", "--version":
+		fmt.Fprintf(c.stdout, "%s %s\n", ProgramName, c.version)
+		return ExitOK
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			return c.Run(ctx, []string{args[1], "--help"})
+		}
+		c.usage(c.stdout)
+		return ExitOK
+	}
+
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return c.runCommand(ctx, cmd, args[1:])
+		}
+	}
+	fmt.Fprintf(c.stderr, "unknown command %q\n\n", name)
+	c.usage(c.stderr)
+	return ExitUsage
+}
+
+func (c *CLI) runCommand(ctx context.Context, cmd command, args []string) int {
+	inputs := c.commandInputs(cmd)
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() { c.commandUsage(fs.Output(), cmd, inputs) }
+	values := make(map[string]*inputValue, len(inputs))
+	for _, input := range inputs {
+		value := &inputValue{isBool: input.IsBool()}
+		values[input.Key] = value
+		fs.Var(value, flagName(input), input.Summary)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(c.stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return ExitUsage
+	}
+
+	flags := map[string]string{}
+	for key, value := range values {
+		if value.set {
+			flags[key] = value.value
+		}
+	}
+	if err := c.configure(inputs, flags, true, cmd.builds()); err != nil {
+		print.Error(err.Error())
+		return ExitFailed
+	}
+
+	if err := cmd.run(ctx); err != nil {
+		return ExitFailed
+	}
+	return ExitOK
+}
+
+// commandInputs returns the inputs a command accepts as flags; run accepts all of them.
+func (c *CLI) commandInputs(cmd command) []step_inputs.Input {
+	if cmd.name == "run" {
+		return c.inputs
+	}
+	inputs := make([]step_inputs.Input, 0, len(cmd.inputs))
+	for _, key := range cmd.inputs {
+		if input, ok := step_inputs.Lookup(c.inputs, key); ok {
+			inputs = append(inputs, input)
+		}
+	}
+	return inputs
+}
+
+// configure merges flags, the environment, the config file and, when useDefaults is set, the
+// step.yml defaults, exports the result for the stages and prints the shown inputs with their
+// origin. Build settings are validated through the build parameter setters when validateBuild is set.
+func (c *CLI) configure(shown []step_inputs.Input, flags map[string]string, useDefaults, validateBuild bool) error {
+	path := step_config.DefaultFileName
+	if input, ok := step_inputs.Lookup(c.inputs, step_config.FileInputKey); ok {
+		if value := step_config.Resolve([]step_inputs.Input{input}, flags, &step_config.File{}, true)[0]; value.Value != "" {
+			path = value.Value
+		}
+	}
+	file, err := step_config.LoadFile(path, c.inputs)
+	if err != nil {
+		return err
+	}
+
+	values := step_config.Resolve(c.inputs, flags, file, useDefaults)
+	if err := step_config.Apply(values); err != nil {
+		return err
+	}
+	step_config.Print(filterValues(values, shown), file)
+
+	if err := step_inputs.Validate(c.inputs, os.Getenv); err != nil {
+		return err
+	}
+
+	if validateBuild {
+		if _, err := create_parameters.BuildParametersFromEnv(); err != nil {
+			return fmt.Errorf("invalid build settings: %w", err)
+		}
+		if err := changed_tests.ValidateFromEnv(); err != nil {
+			return fmt.Errorf("invalid build settings: %w", err)
+		}
+		if err := validateMatrix(c.inputs); err != nil {
+			return fmt.Errorf("invalid build matrix: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateMatrix checks the inputs of every build matrix configuration against step.yml.
+func validateMatrix(inputs []step_inputs.Input) error {
+	configurations, err := build_matrix.FromEnv()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, configuration := range configurations {
+		values := configuration.Inputs()
+		getenv := func(key string) string {
+			if value, ok := values[key]; ok {
+				return value
+			}
+			return os.Getenv(key)
+		}
+		if err := step_inputs.Validate(inputs, getenv); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", configuration.ID(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func filterValues(values []step_config.Value, shown []step_inputs.Input) []step_config.Value {
+	filtered := make([]step_config.Value, 0, len(shown))
+	for _, value := range values {
+		if _, ok := step_inputs.Lookup(shown, value.Input.Key); ok {
+			filtered = append(filtered, value)
+		}
+	}
+	return filtered
+}
+
+func flagName(input step_inputs.Input) string {
+	return strings.ReplaceAll(input.Key, "_", "-")
+}
+
+func concat(lists ...[]string) []string {
+	var all []string
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	return all
+}
+
+// inputValue is a flag.Value remembering whether the flag was given. Inputs only accepting
+// true and false are boolean flags, so --dry-run works without a value.
+type inputValue struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (v *inputValue) String() string {
+	return v.value
+}
+
+func (v *inputValue) Set(value string) error {
+	v.value, v.set = value, true
+	return nil
+}
+
+func (v *inputValue) IsBoolFlag() bool {
+	return v.isBool
+}
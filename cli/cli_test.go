@@ -0,0 +1,412 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v "github.com/Masterminds/semver/v3"
+
+	build_constants "patrol_install/steps/build/constants"
+	"patrol_install/steps/build_matrix"
+	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
+	"patrol_install/utils/step_inputs"
+	"patrol_install/utils/summary"
+)
+
+const testStepYml = `
+inputs:
+- platform: both
+  opts:
+    title: Platform
+    summary: Platform to build
+    is_required: true
+    value_options:
+    - both
+    - ios
+    - android
+- test_build_type: release
+  opts:
+    summary: Build type
+- tags: ""
+  opts:
+    summary: Tags
+- clean_build_outputs: "false"
+  opts:
+    summary: Clean
+    value_options:
+    - "true"
+    - "false"
+- config_file: patrol_build.yaml
+  opts:
+    summary: Config file
+- artifacts_dir: $PATROL_TEST_DEPLOY_DIR/patrol
+  opts:
+    summary: Artifacts folder
+`
+
+func newTestCLI(t *testing.T) (*CLI, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	app, err := New([]byte(testStepYml), "1.2.3")
+	if err != nil {
+		t.Fatalf("new cli: %v", err)
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	app.stdout, app.stderr = stdout, stderr
+	return app, stdout, stderr
+}
+
+// stubStage replaces a stage, recording the env it saw.
+func stubStage(t *testing.T, stage *func(context.Context) error, err error, keys ...string) map[string]string {
+	seen := map[string]string{}
+	original := *stage
+	*stage = func(context.Context) error {
+		for _, key := range keys {
+			if value, ok := os.LookupEnv(key); ok {
+				seen[key] = value
+			}
+		}
+		return err
+	}
+	t.Cleanup(func() { *stage = original })
+	return seen
+}
+
+// clearEnv unsets keys for the test, restoring them afterwards.
+func clearEnv(t *testing.T, keys ...string) {
+	for _, key := range keys {
+		t.Setenv(key, "")
+		if err := os.Unsetenv(key); err != nil {
+			t.Fatalf("unset %s: %v", key, err)
+		}
+	}
+}
+
+func TestRun_FlagsOverrideEnvWhichOverridesDefaults(t *testing.T) {
+	// GIVEN a platform flag, tags from the env and nothing else set
+	app, _, _ := newTestCLI(t)
+	clearEnv(t, "PLATFORM", "TEST_BUILD_TYPE", "CLEAN_BUILD_OUTPUTS", "ARTIFACTS_DIR", "PATROL_TEST_DEPLOY_DIR")
+	t.Setenv("PLATFORM", "ios")
+	t.Setenv("TAGS", "smoke")
+	seen := stubStage(t, &allStages, nil, "PLATFORM", "TEST_BUILD_TYPE", "TAGS", "CLEAN_BUILD_OUTPUTS", "ARTIFACTS_DIR")
+
+	// WHEN running with flags
+	code := app.Run(context.Background(), []string{"run", "--platform", "android", "--clean-build-outputs"})
+
+	// THEN flags win, the env is kept, defaults fill the rest and defaults with unset variables are skipped
+	if code != ExitOK {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	want := map[string]string{"PLATFORM": "android", "TEST_BUILD_TYPE": "release", "TAGS": "smoke", "CLEAN_BUILD_OUTPUTS": "true"}
+	for key, value := range want {
+		if seen[key] != value {
+			t.Fatalf("expected %s=%s, got %v", key, value, seen)
+		}
+	}
+	if _, ok := seen["ARTIFACTS_DIR"]; ok {
+		t.Fatalf("expected ARTIFACTS_DIR to stay unset, got %v", seen)
+	}
+}
+
+func TestRun_CommandOnlyAcceptsItsInputs(t *testing.T) {
+	// GIVEN the install command, which does not read the platform
+	app, _, stderr := newTestCLI(t)
+	stubStage(t, &installStage, nil)
+
+	// WHEN passing a platform flag
+	code := app.Run(context.Background(), []string{"install", "--platform", "ios"})
+
+	// THEN it is rejected as a usage error
+	if code != ExitUsage || !strings.Contains(stderr.String(), "platform") {
+		t.Fatalf("expected usage error, got %d: %s", code, stderr.String())
+	}
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	app, _, _ := newTestCLI(t)
+	stubStage(t, &buildStage, errors.New("build failed"))
+	stubStage(t, &allStages, errors.New("build failed"))
+
+	if code := app.Run(context.Background(), []string{"build"}); code != ExitFailed {
+		t.Fatalf("expected a failed build to exit with 1, got %d", code)
+	}
+	if code := app.Run(context.Background(), nil); code != ExitOK {
+		t.Fatalf("expected the step mode to keep exiting with 0, got %d", code)
+	}
+	if code := app.Run(context.Background(), []string{"deploy"}); code != ExitUsage {
+		t.Fatalf("expected an unknown command to exit with 2, got %d", code)
+	}
+}
+
+func TestRun_HelpAndVersion(t *testing.T) {
+	// GIVEN a CLI
+	app, stdout, stderr := newTestCLI(t)
+
+	// WHEN asking for the version and the help of build
+	versionCode := app.Run(context.Background(), []string{"version"})
+	helpCode := app.Run(context.Background(), []string{"help", "build"})
+
+	// THEN the version is printed and the help lists the step.yml inputs
+	if versionCode != ExitOK || !strings.Contains(stdout.String(), "patrol_build 1.2.3") {
+		t.Fatalf("unexpected version output %q", stdout.String())
+	}
+	help := stderr.String()
+	if helpCode != ExitOK || !strings.Contains(help, "--platform value") || !strings.Contains(help, "env PLATFORM; default \"both\"; one of both, ios, android; required") {
+		t.Fatalf("unexpected help output %q", help)
+	}
+	if !strings.Contains(help, "--clean-build-outputs\n") {
+		t.Fatalf("expected boolean inputs without a value, got %q", help)
+	}
+}
+
+func TestCommands_CoverEveryStepInput(t *testing.T) {
+	// GIVEN the inputs of the repository step.yml
+	data, err := os.ReadFile(filepath.Join("..", "step.yml"))
+	if err != nil {
+		t.Fatalf("read step.yml: %v", err)
+	}
+	inputs, err := step_inputs.Parse(data)
+	if err != nil {
+		t.Fatalf("parse step.yml: %v", err)
+	}
+
+	// WHEN collecting the inputs of the stage commands
+	covered := map[string]bool{"dry_run": true, "build_matrix": true} // only meaningful for run, which accepts every input
+	for _, cmd := range commands() {
+		for _, key := range cmd.inputs {
+			if _, ok := step_inputs.Lookup(inputs, key); !ok {
+				t.Fatalf("command %s refers to unknown input %s", cmd.name, key)
+			}
+			covered[key] = true
+		}
+	}
+
+	// THEN every input is read by at least one of them
+	for _, input := range inputs {
+		if !covered[input.Key] {
+			t.Fatalf("input %s is not mapped to any command", input.Key)
+		}
+	}
+}
+
+func TestRun_ConfigFileBetweenEnvAndDefaults(t *testing.T) {
+	// GIVEN a config file setting the platform, build type and tags, with tags also in the env
+	app, _, _ := newTestCLI(t)
+	clearEnv(t, "PLATFORM", "TEST_BUILD_TYPE", "CONFIG_FILE")
+	t.Setenv("TAGS", "smoke")
+	path := filepath.Join(t.TempDir(), "patrol.yaml")
+	if err := os.WriteFile(path, []byte("platform: ios\ntest_build_type: debug\ntags: regression\n"), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	seen := stubStage(t, &buildStage, nil, "PLATFORM", "TEST_BUILD_TYPE", "TAGS")
+
+	// WHEN building with a build type flag
+	code := app.Run(context.Background(), []string{"build", "--test-build-type", "release"})
+
+	// THEN the flag beats the file, the env beats the file and the file beats the defaults
+	if code != ExitOK {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	want := map[string]string{"PLATFORM": "ios", "TEST_BUILD_TYPE": "release", "TAGS": "smoke"}
+	for key, value := range want {
+		if seen[key] != value {
+			t.Fatalf("expected %s=%s, got %v", key, value, seen)
+		}
+	}
+}
+
+func TestRun_InvalidBuildSettingsFromConfigFile(t *testing.T) {
+	// GIVEN a config file with a platform the build parameters reject
+	app, _, _ := newTestCLI(t)
+	clearEnv(t, "PLATFORM")
+	path := filepath.Join(t.TempDir(), "patrol.yaml")
+	if err := os.WriteFile(path, []byte("platform: windows\n"), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	called := false
+	original := buildStage
+	buildStage = func(context.Context) error {
+		called = true
+		return nil
+	}
+	t.Cleanup(func() { buildStage = original })
+
+	// WHEN building
+	code := app.Run(context.Background(), []string{"build"})
+
+	// THEN the build never starts
+	if code != ExitFailed || called {
+		t.Fatalf("expected the invalid platform to stop the build, got %d (called %v)", code, called)
+	}
+}
+
+func TestRun_ReportsEveryInvalidInput(t *testing.T) {
+	// GIVEN an unknown platform and an invalid boolean
+	app, _, _ := newTestCLI(t)
+	t.Setenv("PLATFORM", "windows")
+	t.Setenv("CLEAN_BUILD_OUTPUTS", "maybe")
+	called := false
+	original := buildStage
+	buildStage = func(context.Context) error {
+		called = true
+		return nil
+	}
+	t.Cleanup(func() { buildStage = original })
+
+	// WHEN building
+	code := app.Run(context.Background(), []string{"build"})
+
+	// THEN the build never starts
+	if code != ExitFailed || called {
+		t.Fatalf("expected invalid inputs to stop the build, got %d (called %v)", code, called)
+	}
+}
+
+func TestRun_OptionsInAnotherCaseAreCanonical(t *testing.T) {
+	// GIVEN a platform in another case than its step.yml option
+	app, _, _ := newTestCLI(t)
+	t.Setenv("PLATFORM", "iOS")
+	seen := stubStage(t, &buildStage, nil, "PLATFORM")
+
+	// WHEN building
+	code := app.Run(context.Background(), []string{"build"})
+
+	// THEN it is accepted and the stages see the step.yml option
+	if code != ExitOK || seen["PLATFORM"] != "ios" {
+		t.Fatalf("expected PLATFORM=ios, got %d %v", code, seen)
+	}
+}
+
+func TestRun_RejectsInvalidMatrixConfiguration(t *testing.T) {
+	// GIVEN a build matrix with an unknown platform
+	app, _, _ := newTestCLI(t)
+	t.Setenv(build_constants.BuildMatrix, "platform=windows")
+	called := false
+	original := allStages
+	allStages = func(context.Context) error {
+		called = true
+		return nil
+	}
+	t.Cleanup(func() { allStages = original })
+
+	// WHEN running
+	code := app.Run(context.Background(), []string{"run"})
+
+	// THEN nothing runs
+	if code != ExitFailed || called {
+		t.Fatalf("expected the invalid configuration to stop the run, got %d (called %v)", code, called)
+	}
+}
+
+// outputsSpy records the exported outputs.
+type outputsSpy map[string]string
+
+func (s outputsSpy) Export(key, value string) error {
+	s[key] = value
+	return nil
+}
+
+func TestRunMatrix_BuildsAndExportsEachConfiguration(t *testing.T) {
+	// GIVEN a matrix of two configurations and stages recording the inputs they see
+	root := t.TempDir()
+	t.Setenv(build_constants.ArtifactsDir, root)
+	t.Setenv(build_constants.Platform, "both")
+	configurations, err := build_matrix.Parse("platform=android, test_build_type=debug|release, flavor=dev", build_matrix.Configuration{})
+	if err != nil {
+		t.Fatalf("parse matrix: %v", err)
+	}
+	var calls []string
+	record := func(stage string) func(context.Context) error {
+		return func(context.Context) error {
+			calls = append(calls, stage+" "+os.Getenv(build_constants.BuildType)+" "+os.Getenv(build_constants.ArtifactsDir))
+			return nil
+		}
+	}
+	originalBuild, originalExport := buildStage, exportStage
+	buildStage, exportStage = record("build"), record("export")
+	t.Cleanup(func() { buildStage, exportStage = originalBuild, originalExport })
+	outputs := outputsSpy{}
+	export_artifacts_utils.SetEnvExporter(outputs)
+	t.Cleanup(func() { export_artifacts_utils.SetEnvExporter(nil) })
+	summary.Reset()
+
+	// WHEN running the matrix
+	err = runMatrix(context.Background(), configurations)
+
+	// THEN each configuration is built then exported into its own folder, and the inputs are restored
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := []string{
+		"build debug " + filepath.Join(root, "android-debug-dev"),
+		"export debug " + filepath.Join(root, "android-debug-dev"),
+		"build release " + filepath.Join(root, "android-release-dev"),
+		"export release " + filepath.Join(root, "android-release-dev"),
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected stage calls:\n%s", strings.Join(calls, "\n"))
+	}
+	if os.Getenv(build_constants.ArtifactsDir) != root || os.Getenv(build_constants.Platform) != "both" {
+		t.Fatal("expected the inputs to be restored")
+	}
+	if stages := summary.Current().Stages; len(stages) != 4 || stages[3].Name != "export android-release-dev" {
+		t.Fatalf("unexpected summary stages %+v", stages)
+	}
+	if outputs["PATROL_BUILD_CONFIGURATIONS"] != "android-debug-dev,android-release-dev" {
+		t.Fatalf("unexpected outputs %v", outputs)
+	}
+}
+
+func TestRunMatrix_StopsAtFirstFailure(t *testing.T) {
+	// GIVEN a matrix whose first build fails
+	t.Setenv(build_constants.ArtifactsDir, t.TempDir())
+	configurations, err := build_matrix.Parse("platform=android|ios, test_build_type=debug", build_matrix.Configuration{})
+	if err != nil {
+		t.Fatalf("parse matrix: %v", err)
+	}
+	buildErr := errors.New("build failed")
+	stubStage(t, &buildStage, buildErr)
+	exported := stubStage(t, &exportStage, nil, build_constants.Platform)
+	summary.Reset()
+
+	// WHEN running the matrix
+	err = runMatrix(context.Background(), configurations)
+
+	// THEN the failure is returned and no other stage runs
+	if !errors.Is(err, buildErr) {
+		t.Fatalf("expected the build error, got %v", err)
+	}
+	if len(exported) != 0 || len(summary.Current().Stages) != 1 {
+		t.Fatalf("expected only the failed build to run, got %+v", summary.Current().Stages)
+	}
+}
+
+func TestRunAll_StopsWhenInstallFails(t *testing.T) {
+	// GIVEN an installer failing without cancellation
+	t.Setenv(build_constants.ArtifactsDir, t.TempDir())
+	clearEnv(t, build_constants.BuildMatrix, build_constants.DryRun)
+	installErr := errors.New("pub global activate failed")
+	original := installCLIStage
+	installCLIStage = func(context.Context) (*v.Version, error) { return nil, installErr }
+	t.Cleanup(func() { installCLIStage = original })
+	built := stubStage(t, &buildStage, nil, build_constants.Platform)
+	t.Setenv(build_constants.Platform, "android")
+	summary.Reset()
+
+	// WHEN running every stage
+	err := runAll(context.Background())
+
+	// THEN the install error is returned and neither validation nor the build run
+	if !errors.Is(err, installErr) {
+		t.Fatalf("expected the install error, got %v", err)
+	}
+	if len(built) != 0 || len(summary.Current().Stages) != 1 {
+		t.Fatalf("expected only the failed install to run, got %+v", summary.Current().Stages)
+	}
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"patrol_install/utils/step_config"
+	"patrol_install/utils/step_inputs"
+)
+
+func (c *CLI) usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\n", ProgramName)
+	fmt.Fprintln(w, "Builds Patrol tests for Flutter apps, locally or on any CI.")
+	fmt.Fprintln(w, "Without a command every stage runs, configured by environment variables only.")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "  %-10s %s\n", "version", "Print the version")
+	fmt.Fprintf(w, "\nRun '%s <command> --help' for the flags of a command.\n", ProgramName)
+}
+
+// commandUsage lists the flags of cmd with the title, env variable, default and options declared
+// for each input in step.yml.
+func (c *CLI) commandUsage(w io.Writer, cmd command, inputs []step_inputs.Input) {
+	fmt.Fprintf(w, "Usage: %s %s [flags]\n\n%s.\n", ProgramName, cmd.name, cmd.summary)
+	if len(inputs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nFlags override environment variables, which override the config file (%s by default),\nwhich overrides the step.yml defaults.\n", step_config.DefaultFileName)
+	fmt.Fprintln(w, "\nFlags:")
+	for _, input := range inputs {
+		name := "--" + flagName(input)
+		if !input.IsBool() {
+			name += " value"
+		}
+		fmt.Fprintf(w, "  %s\n", name)
+		fmt.Fprintf(w, "        %s\n", input.Summary)
+		fmt.Fprintf(w, "        %s\n", inputDetails(input))
+	}
+}
+
+func inputDetails(input step_inputs.Input) string {
+	details := []string{"env " + input.EnvKey()}
+	if input.Default != "" {
+		details = append(details, fmt.Sprintf("default %q", input.Default))
+	}
+	if len(input.ValueOptions) > 0 && !input.IsBool() {
+		details = append(details, "one of "+strings.Join(input.ValueOptions, ", "))
+	}
+	if input.IsRequired {
+		details = append(details, "required")
+	}
+	return "(" + strings.Join(details, "; ") + ")"
+}
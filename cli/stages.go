@@ -0,0 +1,220 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	v "github.com/Masterminds/semver/v3"
+
+	build "patrol_install/steps/build"
+	"patrol_install/steps/build_matrix"
+	"patrol_install/steps/dry_run"
+	"patrol_install/steps/export_artifacts"
+	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
+	"patrol_install/steps/install_patrol_cli"
+	"patrol_install/steps/validate"
+	"patrol_install/utils/interrupt"
+	"patrol_install/utils/print"
+	"patrol_install/utils/summary"
+)
+
+// The stages run by the commands. They are variables so tests can replace them.
+var (
+	installStage    = install
+	installCLIStage = installCLI
+	validateStage   = validateInstalled
+	buildStage      = runBuild
+	exportStage     = runExport
+	allStages       = runAll
+)
+
+func install(ctx context.Context) error {
+	_, err := installCLI(ctx)
+	return err
+}
+
+func installCLI(ctx context.Context) (*v.Version, error) {
+	cliVersion, err := install_patrol_cli.Run(ctx, &install_patrol_cli.InstallerRunner{})
+	if err != nil {
+		print.Error("❌ Setup failed")
+		print.Error(err.Error())
+		print.Error("Please check the logs for more details.")
+		return nil, err
+	}
+	print.Success("✅ Installing CLI Completed Successfully")
+	return cliVersion, nil
+}
+
+// validateInstalled validates against the Patrol CLI already installed, without installing it.
+func validateInstalled(ctx context.Context) error {
+	cliVersion, err := (&install_patrol_cli.InstallerRunner{}).GetPatrolCLIVersion(ctx)
+	if err != nil {
+		print.Error("❌ Patrol CLI is not installed, run the install command first")
+		return err
+	}
+	return runValidate(ctx, cliVersion)
+}
+
+func runValidate(ctx context.Context, cliVersion *v.Version) error {
+	validatorParams := validate.ValidatorRunParams{
+		Runner:     &validate.ValidatorRunner{},
+		CliVersion: cliVersion,
+	}
+	if err := validate.Run(ctx, validatorParams); err != nil {
+		print.Error("❌ Validation failed")
+		print.Error(err.Error())
+		print.Error("Please check the logs for more details.")
+		return err
+	}
+	return nil
+}
+
+func runBuild(ctx context.Context) error {
+	if err := build.Run(ctx, &build.BuilderRunner{}, buildOutputs{}); err != nil {
+		print.Error("❌ Build failed")
+		print.Error(err.Error())
+		print.Error("Please check the logs for more details.")
+		return err
+	}
+	return nil
+}
+
+// buildOutputs publishes the outputs of the build stage through the exporter selected by the output inputs.
+type buildOutputs struct{}
+
+func (buildOutputs) Export(key, value string) error {
+	exporter, err := export_artifacts_utils.EnvExporterFromEnv()
+	if err != nil {
+		return err
+	}
+	export_artifacts_utils.SetEnvExporter(exporter)
+	return export_artifacts_utils.ExportValues([]string{value}, []string{key})
+}
+
+func runExport(ctx context.Context) error {
+	if err := export_artifacts.Run(ctx, &export_artifacts.ExporterRunner{}); err != nil {
+		print.Error("❌ Export failed")
+		print.Error(err.Error())
+		print.Error("Please check the logs for more details.")
+		return err
+	}
+	return nil
+}
+
+// runAll runs every stage, or prints the plan when DRY_RUN is set, and writes the run summary.
+// With a BUILD_MATRIX, install and validate run once and every configuration is built and exported in turn.
+func runAll(ctx context.Context) error {
+	configurations, err := build_matrix.FromEnv()
+	if err != nil {
+		print.Error(err.Error())
+		return err
+	}
+	dryRun, err := dry_run.EnabledFromEnv()
+	if err != nil {
+		print.Error(err.Error())
+		return err
+	}
+	if dryRun {
+		return planAll(ctx, configurations)
+	}
+
+	defer writeSummary(ctx)
+
+	installStage := summary.Begin("install")
+	cliVersion, installError := installCLIStage(ctx)
+	installStage.End(installError)
+	if installError != nil {
+		return installError
+	}
+
+	validateStage := summary.Begin("validate")
+	validationError := runValidate(ctx, cliVersion)
+	validateStage.End(validationError)
+	if validationError != nil {
+		return validationError
+	}
+
+	if len(configurations) > 0 {
+		return runMatrix(ctx, configurations)
+	}
+	return buildAndExport(ctx, "")
+}
+
+// buildAndExport runs the build and export stages, naming them after configuration when set.
+func buildAndExport(ctx context.Context, configuration string) error {
+	stageName := func(name string) string {
+		if configuration == "" {
+			return name
+		}
+		return name + " " + configuration
+	}
+
+	buildSummary := summary.Begin(stageName("build"))
+	buildError := buildStage(ctx)
+	buildSummary.End(buildError)
+	if buildError != nil {
+		return buildError
+	}
+
+	exportSummary := summary.Begin(stageName("export"))
+	exportError := exportStage(ctx)
+	exportSummary.End(exportError)
+	return exportError
+}
+
+// runMatrix builds and exports each configuration into its own subfolder of the artifacts folder,
+// stopping at the first failure, then combines their manifests.
+func runMatrix(ctx context.Context, configurations []build_matrix.Configuration) error {
+	root := export_artifacts_utils.ArtifactsRootFromEnv()
+	ids := make([]string, 0, len(configurations))
+	for i, configuration := range configurations {
+		print.StepInitiated(fmt.Sprintf("Configuration %d of %d: %s", i+1, len(configurations), configuration.ID()))
+		restore := configuration.Apply(root)
+		err := buildAndExport(ctx, configuration.ID())
+		restore()
+		if err != nil {
+			return err
+		}
+		ids = append(ids, configuration.ID())
+	}
+	return export_artifacts.ExportMatrix(root, ids)
+}
+
+// planAll prints the plan of the run, once per build matrix configuration.
+func planAll(ctx context.Context, configurations []build_matrix.Configuration) error {
+	if len(configurations) == 0 {
+		configurations = []build_matrix.Configuration{{}}
+	}
+	root := export_artifacts_utils.ArtifactsRootFromEnv()
+	var errs []error
+	for _, configuration := range configurations {
+		restore := func() {}
+		if configuration != (build_matrix.Configuration{}) {
+			print.StepInitiated("Configuration " + configuration.ID())
+			restore = configuration.Apply(root)
+		}
+		errs = append(errs, dry_run.Run(ctx, &dry_run.PlanRunner{}))
+		restore()
+	}
+	if err := errors.Join(errs...); err != nil {
+		print.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// writeSummary prints the run summary and saves it next to the exported artifacts. An interrupted
+// run still gets its summary, covering the stages up to the interruption.
+func writeSummary(ctx context.Context) {
+	runSummary := summary.Current()
+	if reason := interrupt.Reason(ctx); reason != "" {
+		runSummary.Interrupt(reason)
+	}
+	runSummary.Print()
+	path := filepath.Join(export_artifacts_utils.ArtifactsRootFromEnv(), summary.FileName)
+	if err := runSummary.Save(path); err != nil {
+		print.Warning(fmt.Sprintf("Could not save the run summary: %v", err))
+	}
+}
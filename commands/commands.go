@@ -17,6 +17,12 @@ var FlutterVersion = Command{
 	Args: []string{"--version"},
 }
 
+// / Get the Flutter SDK metadata as JSON
+var FlutterVersionMachine = Command{
+	Name: "flutter",
+	Args: []string{"--version", "--machine"},
+}
+
 // / Get patrol verbose with extra information
 var PatrolDoctor = Command{
 	Name: "patrol",
@@ -29,6 +35,13 @@ var PatrolInstall = Command{
 	Args: []string{"pub", "global", "activate", "patrol_cli"},
 }
 
+// / List the files changed since the merge base with a ref, relative to the working directory.
+// / The range, e.g. origin/main...HEAD, is appended.
+var GitChangedFiles = Command{
+	Name: "git",
+	Args: []string{"diff", "--name-only", "--relative"},
+}
+
 var CreatePatrolFolder = Command{
 	Name: "mkdir",
 	Args: []string{"patrol"},
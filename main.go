@@ -1,50 +1,30 @@
 package main
 
 import (
-	build "patrol_install/steps/build"
-	"patrol_install/steps/export_artifacts"
-	"patrol_install/steps/install_patrol_cli"
-	"patrol_install/steps/validate"
+	"context"
+	_ "embed"
+	"os"
+
+	"patrol_install/cli"
+	"patrol_install/utils/interrupt"
 	"patrol_install/utils/print"
 )
 
-func main() {
-	cliVersion, installError := install_patrol_cli.Run(&install_patrol_cli.InstallerRunner{})
-	if installError != nil {
-		print.Error("❌ Setup failed")
-		print.Error(installError.Error())
-		print.Error("Please check the logs for more details.")
-	} else {
-		print.Success("✅ Installing CLI Completed Successfully")
-	}
+//go:embed step.yml
+var stepYml []byte
 
-	validatorParams := validate.ValidatorRunParams{
-		Runner:     &validate.ValidatorRunner{},
-		CliVersion: cliVersion,
-	}
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
 
-	validationError := validate.Run(validatorParams)
-	if validationError != nil {
-		print.Error("❌ Validation failed")
-		print.Error(validationError.Error())
-		print.Error("Please check the logs for more details.")
-		return
-	}
-
-	buildError := build.Run(&build.BuilderRunner{})
-	if buildError != nil {
-		print.Error("❌ Build failed")
-		print.Error(buildError.Error())
-		print.Error("Please check the logs for more details.")
-		return
-	}
-
-	exportError := export_artifacts.Run(&export_artifacts.ExporterRunner{})
-	if exportError != nil {
-		print.Error("❌ Export failed")
-		print.Error(exportError.Error())
-		print.Error("Please check the logs for more details.")
-		return
+func main() {
+	app, err := cli.New(stepYml, version)
+	if err != nil {
+		print.Error(err.Error())
+		os.Exit(cli.ExitFailed)
 	}
 
+	ctx, stop := interrupt.Context(context.Background())
+	code := app.Run(ctx, os.Args[1:])
+	stop()
+	os.Exit(code)
 }
@@ -1,21 +1,43 @@
 package builder
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 
+	build_constants "patrol_install/steps/build/constants"
+	"patrol_install/steps/build/steps/changed_tests"
+	"patrol_install/steps/build/steps/prepare_outputs"
+	"patrol_install/steps/flutter_sdk"
+	"patrol_install/utils/failure"
 	"patrol_install/utils/print"
+	"patrol_install/utils/retry"
+	"patrol_install/utils/stream"
 )
 
 type Builder interface {
 	BuildParametersFromEnv() ([]string, error)
+	PrepareOutputs() error
+	RecordOutputs() error
 }
 
-func Run(installer Builder) error {
+// OutputExporter publishes an output of the build stage, such as the category of a failed build.
+type OutputExporter interface {
+	Export(key, value string) error
+}
+
+// Run executes every build command and publishes the category of a failed one through outputs.
+// Cancelling ctx stops the running command and skips the rest.
+func Run(ctx context.Context, installer Builder, outputs OutputExporter) error {
 	print.StepInitiated("--- Starting Build Process ---")
 
+	if err := selectChangedTests(); err != nil {
+		print.Error(fmt.Sprintf("❌ Failed to select the changed tests: %s", err))
+		return err
+	}
+
 	commands, err := installer.BuildParametersFromEnv()
 
 	if err != nil {
@@ -23,55 +45,133 @@ func Run(installer Builder) error {
 		return err
 	}
 
+	policy, err := retry.PolicyFromEnv(build_constants.RetryCount, build_constants.RetryInitialDelay)
+	if err != nil {
+		print.Error(fmt.Sprintf("❌ Invalid retry settings: %s", err))
+		return err
+	}
+
+	env, err := buildEnv()
+	if err != nil {
+		print.Error(fmt.Sprintf("❌ Failed to resolve the Flutter SDK: %s", err))
+		return err
+	}
+
+	if err := installer.PrepareOutputs(); err != nil {
+		print.Error(fmt.Sprintf("❌ Failed to prepare build outputs: %s", err))
+		return err
+	}
+
+	for _, variable := range env {
+		print.Action(fmt.Sprintf("Build environment: %s", variable))
+	}
 	for _, cmd := range commands {
 		print.Action(fmt.Sprintf("Executing build command: %s", cmd))
 
-		if err := executeCommand(cmd); err != nil {
+		err := retry.Do(ctx, "Build command", policy, func() error {
+			return executeCommand(ctx, cmd, env)
+		})
+		if err != nil {
 			print.Error(fmt.Sprintf("❌ Command failed: %s\n", err))
+			if ctx.Err() == nil {
+				reportFailureCategory(outputs, err)
+			}
 			return fmt.Errorf("build aborted: failed to execute '%s': %w", cmd, err)
 		}
 
 		print.Success(fmt.Sprintf("✅ Command '%s' executed successfully.\n", cmd))
 	}
 
+	if err := installer.RecordOutputs(); err != nil {
+		print.Error(fmt.Sprintf("❌ Failed to record build outputs: %s", err))
+		return err
+	}
+
 	print.StepCompleted("✅ All build commands executed successfully.")
 	return nil
 }
 
-func executeCommand(command string) error {
-	// Use 'sh -c' to allow complex shell expressions
-	cmd := exec.Command("sh", "-c", command)
+// BuildPlan describes what Run would do.
+type BuildPlan struct {
+	Commands []string
+	// Env holds the variables set for the build commands, as KEY=value.
+	Env []string
+	// CleanRoots are the output folders removed before building.
+	CleanRoots []string
+	// ChangedTests is the target selected from the changes since CHANGED_TESTS_BASE_REF, which
+	// replaces TEST_TARGET_DIRECTORY when the build runs. Empty when every test is built.
+	ChangedTests string
+}
 
-	stdoutPipe, err := cmd.StdoutPipe()
+// Plan resolves the build commands and settings the way Run does, without running or removing anything.
+func Plan(installer Builder) (*BuildPlan, error) {
+	changed, err := changedTarget()
 	if err != nil {
-		return fmt.Errorf("failed to get stdout: %w", err)
+		return nil, err
 	}
-
-	stderrPipe, err := cmd.StderrPipe()
+	commands, err := installer.BuildParametersFromEnv()
 	if err != nil {
-		return fmt.Errorf("failed to get stderr: %w", err)
+		return nil, err
 	}
-
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start command: %w", err)
+	if _, err := retry.PolicyFromEnv(build_constants.RetryCount, build_constants.RetryInitialDelay); err != nil {
+		return nil, err
+	}
+	env, err := buildEnv()
+	if err != nil {
+		return nil, err
+	}
+	clean, err := prepare_outputs.CleanFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	plan := &BuildPlan{Commands: commands, Env: env, ChangedTests: changed}
+	if clean {
+		plan.CleanRoots = prepare_outputs.OutputRoots
 	}
+	return plan, nil
+}
+
+var (
+	selectChangedTests = changed_tests.ApplyFromEnv
+	changedTarget      = changed_tests.TargetFromEnv
+)
 
-	// Stream output in real time
-	go streamOutput(stdoutPipe)
-	go streamOutput(stderrPipe)
+var detectSDK = flutter_sdk.FromEnv
 
-	// Wait for the command to complete
-	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("command failed: %w", err)
+// buildEnv points the Patrol CLI and the dart running it at the Flutter SDK pinned by FVM or Puro.
+// Without a pinned SDK the environment is left as is.
+func buildEnv() ([]string, error) {
+	sdk, err := detectSDK()
+	if err != nil {
+		return nil, err
 	}
+	return sdk.Env(), nil
+}
 
-	return nil
+// buildOutput receives the live output of every build command.
+var buildOutput io.Writer = os.Stdout
+
+// executeCommand runs command through 'sh -c' to allow complex shell expressions, with env added to
+// the environment, streaming its output until fully drained. Failures carry the last lines of output
+// and their classification.
+func executeCommand(ctx context.Context, command string, env []string) error {
+	cmd := exec.Command("sh", "-c", command)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	classifier := failure.NewClassifier()
+	err := stream.Run(ctx, cmd, io.MultiWriter(classifier, buildOutput), stream.DefaultTailLines)
+	return failure.Wrap(err, classifier.Classification())
 }
 
-func streamOutput(pipe io.ReadCloser) {
-	scanner := bufio.NewScanner(pipe)
-	for scanner.Scan() {
-		fmt.Println(scanner.Text())
+// reportFailureCategory exports the category attached to err for dashboards. An export failure is
+// only logged so it does not hide the build error.
+func reportFailureCategory(outputs OutputExporter, err error) {
+	classification, ok := failure.ClassificationOf(err)
+	if !ok {
+		return
+	}
+	if err := outputs.Export(FailureCategoryEnvKey, string(classification.Category)); err != nil {
+		print.Warning(fmt.Sprintf("Could not export the failure category: %v", err))
 	}
 }
@@ -3,7 +3,9 @@ package builder
 import (
 	"fmt"
 
+	"patrol_install/steps/build/steps/check_tags"
 	getEnv "patrol_install/steps/build/steps/create_parameters"
+	"patrol_install/steps/build/steps/prepare_outputs"
 	"patrol_install/utils/print"
 )
 
@@ -16,6 +18,11 @@ func (p *BuilderRunner) BuildParametersFromEnv() ([]string, error) {
 		return []string{}, err
 	}
 
+	if err := check_tags.CheckFromEnv(); err != nil {
+		print.Error(fmt.Sprintf("Build failed: %s", err))
+		return []string{}, err
+	}
+
 	finalCommand := command.Command()
 	if finalCommand == nil {
 		print.Error(fmt.Sprintf("Build failed: %s", err))
@@ -24,3 +31,11 @@ func (p *BuilderRunner) BuildParametersFromEnv() ([]string, error) {
 
 	return finalCommand, nil
 }
+
+func (p *BuilderRunner) PrepareOutputs() error {
+	return prepare_outputs.PrepareOutputsFromEnv()
+}
+
+func (p *BuilderRunner) RecordOutputs() error {
+	return prepare_outputs.RecordOutputsFromEnv()
+}
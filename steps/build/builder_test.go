@@ -0,0 +1,139 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	constants "patrol_install/steps/build/constants"
+	"patrol_install/steps/flutter_sdk"
+	"patrol_install/utils/failure"
+	"patrol_install/utils/stream"
+)
+
+type builderStub struct {
+	commands []string
+}
+
+func (b *builderStub) BuildParametersFromEnv() ([]string, error) {
+	return b.commands, nil
+}
+
+func (b *builderStub) PrepareOutputs() error {
+	return nil
+}
+
+func (b *builderStub) RecordOutputs() error {
+	return nil
+}
+
+// outputsStub records the failure categories exported by the build.
+type outputsStub struct {
+	categories []failure.Category
+}
+
+func (o *outputsStub) Export(key, value string) error {
+	if key == FailureCategoryEnvKey {
+		o.categories = append(o.categories, failure.Category(value))
+	}
+	return nil
+}
+
+func captureBuild(t *testing.T) (*bytes.Buffer, *outputsStub) {
+	output := &bytes.Buffer{}
+	originalOutput := buildOutput
+	buildOutput = output
+	originalDetect := detectSDK
+	detectSDK = func() (flutter_sdk.SDK, error) { return flutter_sdk.SDK{}, nil }
+	t.Cleanup(func() {
+		buildOutput = originalOutput
+		detectSDK = originalDetect
+	})
+	return output, &outputsStub{}
+}
+
+func TestRun_UsesPinnedFlutterSDK(t *testing.T) {
+	// GIVEN a Flutter SDK pinned by FVM
+	output, outputs := captureBuild(t)
+	sdk := flutter_sdk.SDK{Manager: flutter_sdk.ManagerFVM, Version: "3.24.0", Root: "/fvm/versions/3.24.0"}
+	detectSDK = func() (flutter_sdk.SDK, error) { return sdk, nil }
+	builder := &builderStub{commands: []string{"echo \"$PATROL_FLUTTER_COMMAND\""}}
+
+	// WHEN running the build
+	err := Run(context.Background(), builder, outputs)
+
+	// THEN the build command gets the flutter of the pinned SDK
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := strings.TrimSpace(output.String()); got != sdk.Flutter() {
+		t.Fatalf("expected PATROL_FLUTTER_COMMAND=%s, got %q", sdk.Flutter(), got)
+	}
+}
+
+func TestRun_ClassifiesFailedCommand(t *testing.T) {
+	// GIVEN a build command failing with a Dart compile error
+	output, outputs := captureBuild(t)
+	builder := &builderStub{commands: []string{"echo \"lib/main.dart:3:1: Error: Undefined name 'foo'.\" >&2; exit 1"}}
+
+	// WHEN running the build
+	err := Run(context.Background(), builder, outputs)
+
+	// THEN the error carries the category, the output tail and the category is exported
+	classification, ok := failure.ClassificationOf(err)
+	if !ok || classification.Category != failure.CategoryDartCompile {
+		t.Fatalf("expected dart compile failure, got %v", err)
+	}
+	var cmdErr *stream.CommandError
+	if !errors.As(err, &cmdErr) || len(cmdErr.Tail) != 1 {
+		t.Fatalf("expected the output tail in the error, got %v", err)
+	}
+	if len(outputs.categories) != 1 || outputs.categories[0] != failure.CategoryDartCompile {
+		t.Fatalf("expected the category to be exported, got %v", outputs.categories)
+	}
+	if output.Len() == 0 {
+		t.Fatal("expected the output to be streamed")
+	}
+}
+
+func TestRun_SucceedsWithoutExportingCategory(t *testing.T) {
+	// GIVEN a succeeding build command
+	_, outputs := captureBuild(t)
+	builder := &builderStub{commands: []string{"echo built"}}
+
+	// WHEN running the build
+	err := Run(context.Background(), builder, outputs)
+
+	// THEN nothing is exported
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(outputs.categories) != 0 {
+		t.Fatalf("expected no category export, got %v", outputs.categories)
+	}
+}
+
+func TestRun_RetriesTransientFailure(t *testing.T) {
+	// GIVEN a build command hitting a network error on its first attempt only
+	_, outputs := captureBuild(t)
+	t.Setenv(constants.RetryCount, "1")
+	t.Setenv(constants.RetryInitialDelay, "0")
+	marker := filepath.Join(t.TempDir(), "attempted")
+	command := fmt.Sprintf("if [ -f %[1]s ]; then echo built; else touch %[1]s; echo 'Connection reset by peer'; exit 1; fi", marker)
+	builder := &builderStub{commands: []string{command}}
+
+	// WHEN running the build
+	err := Run(context.Background(), builder, outputs)
+
+	// THEN the second attempt succeeds
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(outputs.categories) != 0 {
+		t.Fatalf("expected no category export, got %v", outputs.categories)
+	}
+}
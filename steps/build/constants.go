@@ -0,0 +1,5 @@
+package builder
+
+const (
+	FailureCategoryEnvKey = "PATROL_FAILURE_CATEGORY"
+)
@@ -7,9 +7,36 @@ const (
 	BuildType              = "TEST_BUILD_TYPE"           // Required, using release as default
 	Tags                   = "TAGS"                      // optional, using empty string as default
 	ExcludedTags           = "EXCLUDED_TAGS"             // optional, using empty string as default
+	Flavor                 = "FLAVOR"                    // optional, building without a flavor when empty
+	TagCheck               = "TAG_CHECK"                 // optional, using warn as default
 	IsVerboseMode          = "IS_VERBOSE_MODE"           // optional, using false as default
+	CleanBuildOutputs      = "CLEAN_BUILD_OUTPUTS"       // optional, using false as default
+	SymlinkPolicy          = "SYMLINK_POLICY"            // optional, using rewrite as default
+	HardlinkArtifacts      = "HARDLINK_ARTIFACTS"        // optional, using false as default
+	ArtifactsDir           = "ARTIFACTS_DIR"             // optional, using $BITRISE_DEPLOY_DIR/patrol as default
+	ArtifactNameTemplate   = "ARTIFACT_NAME_TEMPLATE"    // optional, keeping original file names when empty
+	OutputExporter         = "OUTPUT_EXPORTER"           // optional, detecting the CI when empty or auto
+	OutputFile             = "OUTPUT_FILE"               // optional, used by the gitlab, dotenv and json exporters
+	ExportMode             = "EXPORT_MODE"               // optional, using strict as default
+	RetryCount             = "RETRY_COUNT"               // optional, using 2 as default
+	RetryInitialDelay      = "RETRY_INITIAL_DELAY"       // optional, using 10 seconds as default
+	DryRun                 = "DRY_RUN"                   // optional, using false as default
+	ConfigFile             = "CONFIG_FILE"               // optional, using patrol_build.yaml as default
+	ShardCount             = "SHARD_COUNT"               // optional, not sharding when empty or 0
+	ShardTimingsFile       = "SHARD_TIMINGS_FILE"        // optional, sharding by test count when empty
+	BuildMatrix            = "BUILD_MATRIX"              // optional, building a single configuration when empty
+	ChangedTestsBaseRef    = "CHANGED_TESTS_BASE_REF"    // optional, building every test when empty
+	ChangedTestsMapping    = "CHANGED_TESTS_MAPPING"     // optional, selecting only edited tests when empty
+
+	BitriseDeployDir   = "BITRISE_DEPLOY_DIR"
+	BitriseGitCommit   = "BITRISE_GIT_COMMIT"
+	GitCloneCommitHash = "GIT_CLONE_COMMIT_HASH"
 
 	PlatformAndroid = "android"
 	PlatformIOS     = "ios"
 	PlatformBoth    = "both"
+
+	AndroidBuildOutputsPath = "build/app/outputs"
+	IOSBuildOutputsPath     = "build/ios_integ"
+	BuildRecordPath         = "build/patrol_build_record.json"
 )
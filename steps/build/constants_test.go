@@ -0,0 +1,31 @@
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestOutputKeysMatchStepYml(t *testing.T) {
+	// GIVEN step.yml contents
+	stepYmlPath := filepath.Join("..", "..", "step.yml")
+	contents, err := os.ReadFile(stepYmlPath)
+	if err != nil {
+		t.Fatalf("read step.yml: %v", err)
+	}
+
+	// WHEN we search for the build output keys
+	outputKeys := []string{
+		FailureCategoryEnvKey,
+	}
+
+	// THEN each key exists in step.yml outputs
+	for _, key := range outputKeys {
+		pattern := fmt.Sprintf(`(?m)^\s*-\s+%s:`, regexp.QuoteMeta(key))
+		if !regexp.MustCompile(pattern).Match(contents) {
+			t.Fatalf("expected output key %s in step.yml", key)
+		}
+	}
+}
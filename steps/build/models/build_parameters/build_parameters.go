@@ -1,6 +1,7 @@
 package build_parameters
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -13,45 +14,50 @@ type BuildParameters struct {
 	Target       string
 	Platform     string
 	BuildType    string
+	Flavor       string
 	Tags         string
 	ExcludedTags string
 	IsVerbose    string
 }
 
+type field struct {
+	key      string
+	required bool
+	set      func(*BuildParameters, string) error
+}
+
+// fields are applied in this order; every invalid one is reported.
+var fields = []field{
+	{"platform", true, SetPlatform},
+	{"buildType", true, SetBuildType},
+	{"target", false, SetTarget},
+	{"flavor", false, SetFlavor},
+	{"tags", false, SetTags},
+	{"excludedTags", false, SetExcludedTags},
+	{"verbose", false, SetVerbose},
+}
+
 // NewBuildParameters builds a BuildParameters struct from a map of environment variables.
+// Inputs are validated against step.yml before; the setters convert the values and keep the
+// invariants of the struct for callers that do not go through that validation.
 func NewBuildParameters(envMap map[string]string) (*BuildParameters, error) {
 	bp := &BuildParameters{}
 
-	requiredFields := map[string]func(*BuildParameters, string) error{
-		"platform":  SetPlatform,
-		"buildType": SetBuildType,
-	}
-
-	optionalFields := map[string]func(*BuildParameters, string) error{
-		"tags":         SetTags,
-		"target":       SetTarget,
-		"excludedTags": SetExcludedTags,
-		"verbose":      SetVerbose,
-	}
-
-	// Apply required setters
-	for key, setter := range requiredFields {
-		val, ok := envMap[key]
-		if !ok || strings.TrimSpace(val) == "" {
-			return nil, fmt.Errorf("missing required field: %s", key)
+	var errs []error
+	for _, f := range fields {
+		val := envMap[f.key]
+		if strings.TrimSpace(val) == "" {
+			if f.required {
+				errs = append(errs, fmt.Errorf("missing required field: %s", f.key))
+			}
+			continue
 		}
-		if err := setter(bp, val); err != nil {
-			return nil, err
+		if err := f.set(bp, val); err != nil {
+			errs = append(errs, err)
 		}
 	}
-
-	// Apply optional setters
-	for key, setter := range optionalFields {
-		if val, ok := envMap[key]; ok && strings.TrimSpace(val) != "" {
-			if err := setter(bp, val); err != nil {
-				return nil, err
-			}
-		}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
 	}
 
 	return bp, nil
@@ -69,6 +75,9 @@ func (bp *BuildParameters) Command() []string {
 	if bp.Target != "" {
 		args = append(args, "--target", bp.Target)
 	}
+	if bp.Flavor != "" {
+		args = append(args, "--flavor", bp.Flavor)
+	}
 	if bp.Tags != "" {
 		args = append(args, "--tags", bp.Tags)
 	}
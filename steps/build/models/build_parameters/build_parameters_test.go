@@ -0,0 +1,82 @@
+package build_parameters
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewBuildParameters_ReportsEveryInvalidField(t *testing.T) {
+	// GIVEN a missing build type, an unknown platform and an invalid verbose flag
+	envMap := map[string]string{"platform": "windows", "verbose": "yes"}
+
+	// WHEN building the parameters
+	_, err := NewBuildParameters(envMap)
+
+	// THEN every problem is reported
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"invalid platform", "missing required field: buildType", "invalid value for verbose"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestNewBuildParameters(t *testing.T) {
+	// GIVEN valid inputs
+	envMap := map[string]string{"platform": "Android", "buildType": "debug", "tags": "smoke, login", "verbose": "true"}
+
+	// WHEN building the parameters
+	bp, err := NewBuildParameters(envMap)
+
+	// THEN the setters convert the values
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if bp.Platform != "android" || bp.Tags != "'( smoke && login )'" || bp.IsVerbose != "--verbose" {
+		t.Fatalf("unexpected parameters %+v", bp)
+	}
+}
+
+func TestNewBuildParameters_Flavor(t *testing.T) {
+	// GIVEN a flavored android build and an invalid flavor
+	valid := map[string]string{"platform": "android", "buildType": "release", "flavor": "staging"}
+	invalid := map[string]string{"platform": "android", "buildType": "release", "flavor": "stag ing"}
+
+	// WHEN building the parameters
+	bp, err := NewBuildParameters(valid)
+	_, invalidErr := NewBuildParameters(invalid)
+
+	// THEN the flavor is passed to patrol build and the invalid one is rejected
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if command := bp.Command(); len(command) != 1 || !strings.Contains(command[0], "--flavor staging") {
+		t.Fatalf("expected --flavor in %v", command)
+	}
+	if invalidErr == nil || !strings.Contains(invalidErr.Error(), "invalid flavor") {
+		t.Fatalf("expected an invalid flavor error, got %v", invalidErr)
+	}
+}
+
+func TestNewBuildParameters_TagExpressions(t *testing.T) {
+	// GIVEN a tag expression and a malformed excluded tags expression
+	valid := map[string]string{"platform": "ios", "buildType": "debug", "tags": "(smoke || critical) && !flaky"}
+	invalid := map[string]string{"platform": "ios", "buildType": "debug", "excludedTags": "flaky ||"}
+
+	// WHEN building the parameters
+	bp, err := NewBuildParameters(valid)
+	_, invalidErr := NewBuildParameters(invalid)
+
+	// THEN the expression is quoted for the shell and the syntax error names the input
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if bp.Tags != "'( (smoke || critical) && !flaky )'" {
+		t.Fatalf("unexpected tags %s", bp.Tags)
+	}
+	if invalidErr == nil || !strings.Contains(invalidErr.Error(), "invalid excluded tags: invalid tag expression") {
+		t.Fatalf("expected a syntax error, got %v", invalidErr)
+	}
+}
@@ -3,19 +3,21 @@ package build_parameters
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
+
+	tag_expression "patrol_install/steps/build/models/tag_expression"
+	step_inputs "patrol_install/utils/step_inputs"
 )
 
-// SetPlatform sets the build platform. Accepted: "android", "iOS".
+var flavorRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// SetPlatform sets the build platform. Accepted in any case: "android", "ios", "both".
 func SetPlatform(bp *BuildParameters, value string) error {
-	var platform = strings.ToLower(value)
-	switch platform {
-	case "android", "ios":
+	switch platform := strings.ToLower(value); platform {
+	case "android", "ios", "both":
 		bp.Platform = platform
 		return nil
-	case "both":
-		bp.Platform = value
-		return nil
 	default:
 		return errors.New("invalid platform: expected 'android', 'ios' or 'both'")
 	}
@@ -30,23 +32,44 @@ func SetTarget(bp *BuildParameters, value string) error {
 	return nil
 }
 
+// SetFlavor sets the product flavor, passed to Gradle and used as the Xcode scheme.
+func SetFlavor(bp *BuildParameters, value string) error {
+	flavor := strings.TrimSpace(value)
+	if !flavorRegex.MatchString(flavor) {
+		return fmt.Errorf("invalid flavor %q: expected letters, digits, '-' or '_'", value)
+	}
+	bp.Flavor = flavor
+	return nil
+}
+
+// SetBuildType sets the build type. Accepted in any case: "release", "debug".
 func SetBuildType(bp *BuildParameters, value string) error {
-	switch value {
+	switch buildType := strings.ToLower(value); buildType {
 	case "release", "debug":
-		bp.BuildType = value
+		bp.BuildType = buildType
 		return nil
 	default:
 		return errors.New("invalid build type: expected 'release' or 'debug'")
 	}
 }
 
+// SetTags sets the tag expression selecting the tests to build, see tag_expression.Parse.
 func SetTags(bp *BuildParameters, value string) error {
-	bp.Tags = formatTags(value)
+	tags, err := formatTags(value)
+	if err != nil {
+		return fmt.Errorf("invalid tags: %w", err)
+	}
+	bp.Tags = tags
 	return nil
 }
 
+// SetExcludedTags sets the tag expression selecting the tests to leave out, see tag_expression.Parse.
 func SetExcludedTags(bp *BuildParameters, value string) error {
-	bp.ExcludedTags = formatTags(value)
+	tags, err := formatTags(value)
+	if err != nil {
+		return fmt.Errorf("invalid excluded tags: %w", err)
+	}
+	bp.ExcludedTags = tags
 	return nil
 }
 
@@ -54,29 +77,24 @@ func SetVerbose(bp *BuildParameters, value string) error {
 	return setFlag(value, "--verbose", &bp.IsVerbose, "verbose")
 }
 
-// formatTags converts comma-separated values to '( tag1 && tag2 )' format.
-func formatTags(input string) string {
-	tags := strings.Split(input, ",")
-	var trimmed []string
-	for _, t := range tags {
-		if tag := strings.TrimSpace(t); tag != "" {
-			trimmed = append(trimmed, tag)
-		}
+// formatTags parses a tag expression and quotes its canonical form for the shell as '( expression )'.
+// Comma separated tags keep meaning every tag, e.g. 'smoke, login' becomes '( smoke && login )'.
+func formatTags(input string) (string, error) {
+	expression, err := tag_expression.Parse(input)
+	if err != nil || expression == nil {
+		return "", err
 	}
-	if len(trimmed) == 0 {
-		return ""
-	}
-	return "'( " + strings.Join(trimmed, " && ") + " )'"
+	return "'( " + expression.String() + " )'", nil
 }
 
 func setFlag(value, flag string, target *string, name string) error {
-	switch strings.ToLower(value) {
-	case "true":
+	enabled, err := step_inputs.ParseBool(name, value)
+	if err != nil {
+		return err
+	}
+	*target = ""
+	if enabled {
 		*target = flag
-	case "false":
-		*target = ""
-	default:
-		return fmt.Errorf("invalid value for %s: expected 'true' or 'false'", name)
 	}
 	return nil
 }
@@ -0,0 +1,169 @@
+package build_record
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrStaleArtifact is returned when an artifact was not produced by the recorded build.
+var ErrStaleArtifact = errors.New("stale build artifact")
+
+// ModTimeTolerance absorbs coarse filesystem timestamps (HFS+ and FAT store whole seconds).
+const ModTimeTolerance = 2 * time.Second
+
+// StartedEnvKey holds the start time of the build stage run by this process, so the export stage can
+// tell the record of that build from one left behind by an earlier run.
+const StartedEnvKey = "PATROL_BUILD_STARTED_AT"
+
+// Record describes the outputs of the build stage so the export stage can tell them from leftovers.
+type Record struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// Files maps every file below the build output roots to its fingerprint when the build finished.
+	Files map[string]string `json:"files"`
+}
+
+// New fingerprints every file below the given output roots once the build finished.
+// A missing root holds no file.
+func New(startedAt, finishedAt time.Time, outputRoots []string) (*Record, error) {
+	record := &Record{StartedAt: startedAt, FinishedAt: finishedAt, Files: map[string]string{}}
+	for _, root := range outputRoots {
+		if _, err := os.Stat(root); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		err := walkFiles(root, func(path string, info fs.FileInfo) {
+			record.Files[path] = fingerprint(info)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fingerprint %s: %w", root, err)
+		}
+	}
+	return record, nil
+}
+
+// fingerprint identifies a version of a file by its size and modification time.
+func fingerprint(info fs.FileInfo) string {
+	return fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+}
+
+// walkFiles calls fn with the absolute path of every regular file or symlink at or below path.
+func walkFiles(path string, fn func(path string, info fs.FileInfo)) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(abs, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fn(p, info)
+		return nil
+	})
+}
+
+// Save writes the record as JSON, creating parent folders as needed.
+func (r *Record) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create folder for %s: %w", path, err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Load reads a record written by Save.
+func Load(path string) (*Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	record := &Record{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("invalid build record %s: %w", path, err)
+	}
+	return record, nil
+}
+
+// CheckFresh returns ErrStaleArtifact listing every artifact that differs from the recorded build
+// outputs: a file the build did not leave behind, one changed since, a bundle missing files, or an
+// artifact last modified before the build started, i.e. a leftover the build did not rewrite.
+func (r *Record) CheckFresh(artifacts []string) error {
+	var stale []string
+	for _, artifact := range artifacts {
+		problem, err := r.check(artifact)
+		if err != nil {
+			return err
+		}
+		if problem != "" {
+			stale = append(stale, problem)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w:\n  - %s", ErrStaleArtifact, strings.Join(stale, "\n  - "))
+}
+
+// check compares the files of artifact with the record, returning the first difference found.
+// A bundle is as recent as its newest file, since rebuilding it does not rewrite unchanged resources.
+func (r *Record) check(artifact string) (string, error) {
+	var problem string
+	var newest time.Time
+	found := 0
+	err := walkFiles(artifact, func(path string, info fs.FileInfo) {
+		if problem != "" {
+			return
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		recorded, ok := r.Files[path]
+		switch {
+		case !ok:
+			problem = fmt.Sprintf("%s was not produced by the build finished at %s", path, r.FinishedAt.Format(time.RFC3339))
+		case recorded != fingerprint(info):
+			problem = fmt.Sprintf("%s changed after the build finished at %s", path, r.FinishedAt.Format(time.RFC3339))
+		}
+		found++
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect %s: %w", artifact, err)
+	}
+	if problem != "" {
+		return problem, nil
+	}
+	if found > 0 && newest.Before(r.StartedAt.Add(-ModTimeTolerance)) {
+		return fmt.Sprintf("%s was last modified %s, before the build started at %s",
+			artifact, newest.Format(time.RFC3339), r.StartedAt.Format(time.RFC3339)), nil
+	}
+
+	abs, err := filepath.Abs(artifact)
+	if err != nil {
+		return "", err
+	}
+	recorded := 0
+	for path := range r.Files {
+		if path == abs || strings.HasPrefix(path, abs+string(filepath.Separator)) {
+			recorded++
+		}
+	}
+	if recorded != found {
+		return fmt.Sprintf("%s holds %d files but the build left %d", artifact, found, recorded), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,170 @@
+package build_record
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeArtifact(t *testing.T, path string, modTime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("apk"), 0644); err != nil {
+		t.Fatalf("write artifact: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+}
+
+func TestCheckFresh_ArtifactWrittenDuringBuild(t *testing.T) {
+	// GIVEN an artifact written by the recorded build
+	root := filepath.Join(t.TempDir(), "outputs")
+	artifact := filepath.Join(root, "apk", "app-release.apk")
+	writeArtifact(t, artifact, time.Now())
+	record, err := New(time.Now().Add(-time.Minute), time.Now(), []string{root})
+	if err != nil {
+		t.Fatalf("new record: %v", err)
+	}
+
+	// WHEN checking freshness
+	err = record.CheckFresh([]string{artifact})
+
+	// THEN the artifact is accepted
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestCheckFresh_LeftoverOlderThanBuild(t *testing.T) {
+	// GIVEN an artifact from yesterday left in the output root by an earlier build
+	root := filepath.Join(t.TempDir(), "outputs")
+	artifact := filepath.Join(root, "apk", "app-release.apk")
+	writeArtifact(t, artifact, time.Now().Add(-24*time.Hour))
+	record, err := New(time.Now().Add(-time.Minute), time.Now(), []string{root})
+	if err != nil {
+		t.Fatalf("new record: %v", err)
+	}
+
+	// WHEN checking freshness
+	err = record.CheckFresh([]string{artifact})
+
+	// THEN it is rejected although the build recorded it
+	if !errors.Is(err, ErrStaleArtifact) || !strings.Contains(err.Error(), "before the build started") {
+		t.Fatalf("expected ErrStaleArtifact, got %v", err)
+	}
+}
+
+func TestCheckFresh_BundleUsesNewestFile(t *testing.T) {
+	// GIVEN a rebuilt bundle whose unchanged resources keep their old modification time
+	root := filepath.Join(t.TempDir(), "outputs")
+	bundle := filepath.Join(root, "Runner.app")
+	writeArtifact(t, filepath.Join(bundle, "Info.plist"), time.Now().Add(-24*time.Hour))
+	writeArtifact(t, filepath.Join(bundle, "Runner"), time.Now())
+	record, err := New(time.Now().Add(-time.Minute), time.Now(), []string{root})
+	if err != nil {
+		t.Fatalf("new record: %v", err)
+	}
+
+	// WHEN checking freshness
+	err = record.CheckFresh([]string{bundle})
+
+	// THEN the bundle is accepted
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestCheckFresh_ArtifactNotLeftByBuild(t *testing.T) {
+	// GIVEN an artifact written after the build was recorded
+	root := filepath.Join(t.TempDir(), "outputs")
+	record, err := New(time.Now(), time.Now(), []string{root})
+	if err != nil {
+		t.Fatalf("new record: %v", err)
+	}
+	artifact := filepath.Join(root, "app-release.apk")
+	writeArtifact(t, artifact, time.Now())
+
+	// WHEN checking freshness
+	err = record.CheckFresh([]string{artifact})
+
+	// THEN it is rejected as stale
+	if !errors.Is(err, ErrStaleArtifact) || !strings.Contains(err.Error(), "was not produced by the build") {
+		t.Fatalf("expected ErrStaleArtifact, got %v", err)
+	}
+}
+
+func TestCheckFresh_BundleChangedAfterBuild(t *testing.T) {
+	// GIVEN a recorded bundle, one file of which changed since
+	root := filepath.Join(t.TempDir(), "outputs")
+	bundle := filepath.Join(root, "Runner.app")
+	writeArtifact(t, filepath.Join(bundle, "Info.plist"), time.Now().Add(-time.Hour))
+	writeArtifact(t, filepath.Join(bundle, "Runner"), time.Now().Add(-time.Hour))
+	record, err := New(time.Now(), time.Now(), []string{root})
+	if err != nil {
+		t.Fatalf("new record: %v", err)
+	}
+	writeArtifact(t, filepath.Join(bundle, "Runner"), time.Now())
+
+	// WHEN checking freshness
+	err = record.CheckFresh([]string{bundle})
+
+	// THEN the bundle is rejected
+	if !errors.Is(err, ErrStaleArtifact) || !strings.Contains(err.Error(), "changed after the build") {
+		t.Fatalf("expected ErrStaleArtifact, got %v", err)
+	}
+}
+
+func TestCheckFresh_BundleMissingFiles(t *testing.T) {
+	// GIVEN a recorded bundle, one file of which was removed since
+	root := filepath.Join(t.TempDir(), "outputs")
+	bundle := filepath.Join(root, "Runner.app")
+	writeArtifact(t, filepath.Join(bundle, "Info.plist"), time.Now())
+	writeArtifact(t, filepath.Join(bundle, "Runner"), time.Now())
+	record, err := New(time.Now(), time.Now(), []string{root})
+	if err != nil {
+		t.Fatalf("new record: %v", err)
+	}
+	if err := os.Remove(filepath.Join(bundle, "Runner")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	// WHEN checking freshness
+	err = record.CheckFresh([]string{bundle})
+
+	// THEN the bundle is rejected
+	if !errors.Is(err, ErrStaleArtifact) {
+		t.Fatalf("expected ErrStaleArtifact, got %v", err)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	// GIVEN a record
+	root := t.TempDir()
+	file := filepath.Join(root, "file")
+	writeArtifact(t, file, time.Now())
+	record, err := New(time.Now().Round(0), time.Now().Round(0), []string{root})
+	if err != nil {
+		t.Fatalf("new record: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "build", "record.json")
+
+	// WHEN saving and loading it
+	if err := record.Save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err := Load(path)
+
+	// THEN the values round-trip
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !loaded.StartedAt.Equal(record.StartedAt) || loaded.Files[file] == "" || loaded.Files[file] != record.Files[file] {
+		t.Fatalf("expected %+v, got %+v", record, loaded)
+	}
+}
@@ -0,0 +1,191 @@
+package tag_expression
+
+import "fmt"
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenTag
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+	tokenComma
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+var punctuation = map[byte]tokenKind{'!': tokenNot, '(': tokenOpen, ')': tokenClose, ',': tokenComma}
+
+// parser is a recursive descent parser over the grammar, loosest operator first:
+//
+//	list    = or { "," or }
+//	or      = and { "||" and }
+//	and     = not { "&&" not }
+//	not     = "!" not | primary
+//	primary = tag | "(" or ")"
+type parser struct {
+	input  string
+	tokens []token
+	next   int
+}
+
+// isTagByte follows package:test, whose tags are Dart identifiers that may also contain dashes.
+func isTagByte(c byte, first bool) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == '-':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	default:
+		return false
+	}
+}
+
+func (p *parser) tokenize() error {
+	input := p.input
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '&' || c == '|':
+			if i+1 >= len(input) || input[i+1] != c {
+				return &SyntaxError{Input: input, Offset: i, Message: fmt.Sprintf("expected %c%c", c, c)}
+			}
+			kind := tokenAnd
+			if c == '|' {
+				kind = tokenOr
+			}
+			p.tokens = append(p.tokens, token{kind: kind, text: input[i : i+2], offset: i})
+			i += 2
+		case punctuation[c] != tokenEnd:
+			p.tokens = append(p.tokens, token{kind: punctuation[c], text: string(c), offset: i})
+			i++
+		case isTagByte(c, true):
+			start := i
+			for i < len(input) && isTagByte(input[i], false) {
+				i++
+			}
+			p.tokens = append(p.tokens, token{kind: tokenTag, text: input[start:i], offset: start})
+		default:
+			return &SyntaxError{Input: input, Offset: i, Message: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	p.tokens = append(p.tokens, token{kind: tokenEnd, offset: len(input)})
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) errorAt(t token, message string) error {
+	return &SyntaxError{Input: p.input, Offset: t.offset, Message: message}
+}
+
+// parseList reads the legacy comma separated form, where every item must match. Empty items
+// are skipped like before.
+func (p *parser) parseList() (node, error) {
+	var list node
+	for {
+		for p.peek().kind == tokenComma {
+			p.advance()
+		}
+		if p.peek().kind == tokenEnd {
+			return list, nil
+		}
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if list == nil {
+			list = item
+		} else {
+			list = binaryNode{and: true, left: list, right: item}
+		}
+		if next := p.peek(); next.kind != tokenComma && next.kind != tokenEnd {
+			return nil, p.errorAt(next, fmt.Sprintf("unexpected %q, expected an operator", next.text))
+		}
+	}
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.advance()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.peek().kind == tokenNot {
+		p.advance()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokenTag:
+		return tagNode{name: t.text}, nil
+	case tokenOpen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.peek(); closing.kind != tokenClose {
+			return nil, p.errorAt(closing, "missing closing parenthesis")
+		}
+		p.advance()
+		return inner, nil
+	case tokenEnd:
+		return nil, p.errorAt(t, "expected a tag")
+	default:
+		return nil, p.errorAt(t, fmt.Sprintf("expected a tag, got %q", t.text))
+	}
+}
@@ -0,0 +1,131 @@
+package tag_expression
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Expression is a parsed tag selector in the boolean selector syntax of package:test, as accepted
+// by `patrol build --tags` and `--excludedTags`: tags combined with `&&`, `||`, `!` and parentheses.
+// A comma separated list of tags, the format the inputs always accepted, is read as tags joined
+// with `&&`.
+type Expression struct {
+	root node
+}
+
+// SyntaxError reports where an expression could not be parsed.
+type SyntaxError struct {
+	Input string
+	// Offset is the byte offset of the problem in Input.
+	Offset  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid tag expression %q: %s at position %d", e.Input, e.Message, e.Offset+1)
+}
+
+// Parse reads input. It returns a nil Expression when input holds no tag.
+func Parse(input string) (*Expression, error) {
+	p := &parser{input: input}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseList()
+	if err != nil || root == nil {
+		return nil, err
+	}
+	return &Expression{root: root}, nil
+}
+
+// Match reports whether a test carrying tags is selected by the expression.
+func (e *Expression) Match(tags []string) bool {
+	set := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	return e.root.evaluate(set)
+}
+
+// Tags returns every tag the expression refers to, sorted.
+func (e *Expression) Tags() []string {
+	set := map[string]bool{}
+	e.root.collect(set)
+	tags := make([]string, 0, len(set))
+	for tag := range set {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// String returns the expression in canonical form, with parentheses only where needed.
+func (e *Expression) String() string {
+	var b strings.Builder
+	e.root.format(&b, precedenceOr)
+	return b.String()
+}
+
+// Operator precedences, loosest first.
+const (
+	precedenceOr = iota
+	precedenceAnd
+	precedenceNot
+)
+
+type node interface {
+	evaluate(tags map[string]bool) bool
+	collect(tags map[string]bool)
+	format(b *strings.Builder, parent int)
+}
+
+type tagNode struct{ name string }
+
+func (n tagNode) evaluate(tags map[string]bool) bool { return tags[n.name] }
+func (n tagNode) collect(tags map[string]bool)       { tags[n.name] = true }
+func (n tagNode) format(b *strings.Builder, _ int)   { b.WriteString(n.name) }
+
+type notNode struct{ operand node }
+
+func (n notNode) evaluate(tags map[string]bool) bool { return !n.operand.evaluate(tags) }
+func (n notNode) collect(tags map[string]bool)       { n.operand.collect(tags) }
+func (n notNode) format(b *strings.Builder, _ int) {
+	b.WriteString("!")
+	n.operand.format(b, precedenceNot)
+}
+
+type binaryNode struct {
+	and         bool
+	left, right node
+}
+
+func (n binaryNode) evaluate(tags map[string]bool) bool {
+	if n.and {
+		return n.left.evaluate(tags) && n.right.evaluate(tags)
+	}
+	return n.left.evaluate(tags) || n.right.evaluate(tags)
+}
+
+func (n binaryNode) collect(tags map[string]bool) {
+	n.left.collect(tags)
+	n.right.collect(tags)
+}
+
+func (n binaryNode) format(b *strings.Builder, parent int) {
+	precedence, operator := precedenceOr, " || "
+	if n.and {
+		precedence, operator = precedenceAnd, " && "
+	}
+	parenthesize := precedence < parent
+	if parenthesize {
+		b.WriteString("(")
+	}
+	n.left.format(b, precedence)
+	b.WriteString(operator)
+	// Both operators are associative, so only a looser right operand needs parentheses.
+	n.right.format(b, precedence)
+	if parenthesize {
+		b.WriteString(")")
+	}
+}
@@ -0,0 +1,107 @@
+package tag_expression
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse_CanonicalForm(t *testing.T) {
+	// GIVEN expressions using every operator and the legacy comma list
+	cases := map[string]string{
+		"smoke":                         "smoke",
+		"smoke, login":                  "smoke && login",
+		" smoke ,, login , ":            "smoke && login",
+		"smoke || critical":             "smoke || critical",
+		"!flaky":                        "!flaky",
+		"(smoke || critical) && !flaky": "(smoke || critical) && !flaky",
+		"smoke || critical && !flaky":   "smoke || critical && !flaky",
+		"!(a && b)":                     "!(a && b)",
+		"((a))":                         "a",
+		"slow-test, android_only":       "slow-test && android_only",
+		"a || b, c":                     "(a || b) && c",
+	}
+
+	for input, want := range cases {
+		// WHEN parsing it
+		expression, err := Parse(input)
+
+		// THEN it is printed back in canonical form
+		if err != nil {
+			t.Fatalf("Parse(%q) returned %v", input, err)
+		}
+		if got := expression.String(); got != want {
+			t.Fatalf("Parse(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestParse_Empty(t *testing.T) {
+	// GIVEN inputs without any tag
+	for _, input := range []string{"", "  ", ",", " , "} {
+		// WHEN parsing them
+		expression, err := Parse(input)
+
+		// THEN there is no expression
+		if err != nil || expression != nil {
+			t.Fatalf("Parse(%q) = %v, %v, want nil", input, expression, err)
+		}
+	}
+}
+
+func TestParse_SyntaxErrors(t *testing.T) {
+	// GIVEN malformed expressions
+	cases := map[string]string{
+		"smoke &&":         "expected a tag at position 9",
+		"smoke & login":    "expected && at position 7",
+		"smoke | login":    "expected || at position 7",
+		"(smoke || login":  "missing closing parenthesis at position 16",
+		"smoke)":           `unexpected ")", expected an operator at position 6`,
+		"smoke login":      `unexpected "login", expected an operator at position 7`,
+		"smoke && 'login'": `unexpected character '\'' at position 10`,
+		"|| smoke":         `expected a tag, got "||" at position 1`,
+		"2fast":            `unexpected character '2' at position 1`,
+	}
+
+	for input, want := range cases {
+		// WHEN parsing them
+		_, err := Parse(input)
+
+		// THEN the problem and its position are reported
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Fatalf("Parse(%q) returned %v, want a SyntaxError", input, err)
+		}
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("Parse(%q) error %q does not contain %q", input, err, want)
+		}
+	}
+}
+
+func TestExpression_MatchAndTags(t *testing.T) {
+	// GIVEN an expression mixing every operator
+	expression, err := Parse("(smoke || critical) && !flaky")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	// WHEN matching tests with various tags
+	// THEN only the selected ones match
+	cases := []struct {
+		tags []string
+		want bool
+	}{
+		{[]string{"smoke"}, true},
+		{[]string{"critical", "login"}, true},
+		{[]string{"smoke", "flaky"}, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := expression.Match(c.tags); got != c.want {
+			t.Fatalf("Match(%v) = %v, want %v", c.tags, got, c.want)
+		}
+	}
+	if tags := strings.Join(expression.Tags(), ","); tags != "critical,flaky,smoke" {
+		t.Fatalf("unexpected tags %s", tags)
+	}
+}
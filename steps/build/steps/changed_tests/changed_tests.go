@@ -0,0 +1,214 @@
+package changed_tests
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"patrol_install/commands"
+	constants "patrol_install/steps/build/constants"
+	"patrol_install/steps/test_discovery"
+	"patrol_install/utils/exec"
+	print "patrol_install/utils/print"
+)
+
+// Rule maps changed source paths to the tests covering them.
+type Rule struct {
+	// Source is a file or folder, e.g. lib/features/login.
+	Source string
+	// Tests are test files or folders, e.g. patrol_test/login.
+	Tests []string
+}
+
+// SelectedTargetEnvKey holds the target selected by the build stage, empty when every test is built.
+// The later stages and the next build matrix configurations reuse it instead of listing the changes again.
+const SelectedTargetEnvKey = "PATROL_CHANGED_TESTS_TARGET"
+
+// ignoredSuffixes name changed files that never affect a test.
+var ignoredSuffixes = []string{".md"}
+
+var (
+	changedFiles = func(baseRef string) ([]string, error) {
+		args := append(slices.Clone(commands.GitChangedFiles.Args), baseRef+"...HEAD")
+		output, err := exec.Command(commands.GitChangedFiles.CopyWith(nil, args))
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, line := range strings.Split(output, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				files = append(files, line)
+			}
+		}
+		return files, nil
+	}
+	testFiles = func() ([]string, error) {
+		return test_discovery.Files(test_discovery.RootsFromEnv())
+	}
+)
+
+// ValidateFromEnv checks CHANGED_TESTS_MAPPING without listing the changes.
+func ValidateFromEnv() error {
+	_, err := ParseMapping(os.Getenv(constants.ChangedTestsMapping))
+	return err
+}
+
+// ApplyFromEnv selects the changed tests once per run and points TEST_TARGET_DIRECTORY at them, so
+// the build command, the tag check and the test inventory and shard plan of the export all use
+// the same tests. It does nothing when no base ref is set or every test must be built.
+func ApplyFromEnv() error {
+	if _, ok := os.LookupEnv(SelectedTargetEnvKey); ok {
+		return nil
+	}
+	target, err := TargetFromEnv()
+	if err != nil || strings.TrimSpace(os.Getenv(constants.ChangedTestsBaseRef)) == "" {
+		return err
+	}
+	if err := os.Setenv(SelectedTargetEnvKey, target); err != nil {
+		return err
+	}
+	if target == "" {
+		return nil
+	}
+	return os.Setenv(constants.TestTargetDirectory, target)
+}
+
+// TargetFromEnv returns the test files affected by the changes since CHANGED_TESTS_BASE_REF, comma
+// separated for --target, or the target ApplyFromEnv already selected. It returns an empty target,
+// building every test, when no base ref is set or the changes cannot be mapped to tests. Only an
+// invalid CHANGED_TESTS_MAPPING is an error.
+func TargetFromEnv() (string, error) {
+	if target, ok := os.LookupEnv(SelectedTargetEnvKey); ok {
+		return target, nil
+	}
+	baseRef := strings.TrimSpace(os.Getenv(constants.ChangedTestsBaseRef))
+	if baseRef == "" {
+		return "", nil
+	}
+	rules, err := ParseMapping(os.Getenv(constants.ChangedTestsMapping))
+	if err != nil {
+		return "", err
+	}
+
+	print.StepInitiated("--- Selecting Changed Tests ---")
+	changed, err := changedFiles(baseRef)
+	if err != nil {
+		print.Warning(fmt.Sprintf("Building all tests: cannot list the changes since %s: %v", baseRef, err))
+		return "", nil
+	}
+	tests, err := testFiles()
+	if err != nil {
+		print.Warning(fmt.Sprintf("Building all tests: %v", err))
+		return "", nil
+	}
+	targets, reason := Select(changed, tests, rules)
+	if reason != "" {
+		print.Warning(fmt.Sprintf("Building all tests: %s", reason))
+		return "", nil
+	}
+	print.Success(fmt.Sprintf("%d changed files select %d of %d test files: %s", len(changed), len(targets), len(tests), strings.Join(targets, ", ")))
+	return strings.Join(targets, ","), nil
+}
+
+// ParseMapping reads one rule per line as `source = test, test`, e.g.
+//
+//	lib/features/login = patrol_test/login, patrol_test/smoke_test.dart
+//
+// Empty lines and lines starting with # are skipped. Every invalid line is reported.
+func ParseMapping(value string) ([]Rule, error) {
+	var rules []Rule
+	var errs []string
+	for i, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		source, tests, ok := strings.Cut(line, "=")
+		rule := Rule{Source: cleanPath(source)}
+		for _, test := range strings.Split(tests, ",") {
+			if test = cleanPath(test); test != "" {
+				rule.Tests = append(rule.Tests, test)
+			}
+		}
+		if !ok || rule.Source == "" || len(rule.Tests) == 0 {
+			errs = append(errs, fmt.Sprintf("line %d: expected 'source = test, test'", i+1))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid %s: %s", constants.ChangedTestsMapping, strings.Join(errs, "; "))
+	}
+	return rules, nil
+}
+
+// Select returns the test files among tests affected by the changed files: edited test files, and
+// the tests mapped to edited sources by rules. Other test files, e.g. deleted or unit tests, and
+// documentation are skipped. When any other file changed, or nothing selects a test, it returns
+// why every test must be built instead.
+func Select(changed, tests []string, rules []Rule) ([]string, string) {
+	isTest := map[string]bool{}
+	for _, test := range tests {
+		isTest[cleanPath(test)] = true
+	}
+
+	selected := map[string]bool{}
+	for _, file := range changed {
+		file = cleanPath(file)
+		switch {
+		case isTest[file]:
+			selected[file] = true
+		case strings.HasSuffix(file, "_test.dart"):
+			// A deleted test, or one outside the test directory such as a unit test.
+		case slices.ContainsFunc(ignoredSuffixes, func(suffix string) bool { return strings.HasSuffix(file, suffix) }):
+		default:
+			matched := false
+			for _, rule := range rules {
+				if !contains(rule.Source, file) {
+					continue
+				}
+				matched = true
+				for _, target := range rule.Tests {
+					found := false
+					for test := range isTest {
+						if contains(target, test) {
+							selected[test] = true
+							found = true
+						}
+					}
+					if !found {
+						return nil, fmt.Sprintf("%s is mapped to %s, which holds no test", rule.Source, target)
+					}
+				}
+			}
+			if !matched {
+				return nil, fmt.Sprintf("%s is not mapped to any test", file)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, "no test is affected by the changes"
+	}
+
+	targets := make([]string, 0, len(selected))
+	for test := range selected {
+		targets = append(targets, test)
+	}
+	slices.Sort(targets)
+	return targets, ""
+}
+
+// contains reports whether file is parent or a file in the folder parent.
+func contains(parent, file string) bool {
+	return file == parent || strings.HasPrefix(file, strings.TrimSuffix(parent, "/")+"/")
+}
+
+func cleanPath(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	return path.Clean(value)
+}
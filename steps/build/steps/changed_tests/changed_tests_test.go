@@ -0,0 +1,184 @@
+package changed_tests
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	constants "patrol_install/steps/build/constants"
+)
+
+var suite = []string{
+	"patrol_test/checkout/pay_test.dart",
+	"patrol_test/checkout/refund_test.dart",
+	"patrol_test/login_test.dart",
+	"patrol_test/smoke_test.dart",
+}
+
+func stubGit(t *testing.T, changed []string, err error) {
+	originalChanged, originalTests := changedFiles, testFiles
+	changedFiles = func(string) ([]string, error) { return changed, err }
+	testFiles = func() ([]string, error) { return suite, nil }
+	t.Cleanup(func() { changedFiles, testFiles = originalChanged, originalTests })
+}
+
+func TestParseMapping(t *testing.T) {
+	// GIVEN a mapping with comments, trailing slashes and an invalid line
+	value := "# login\nlib/login/ = patrol_test/login_test.dart\n\nlib/checkout = patrol_test/checkout/, patrol_test/smoke_test.dart\nlib/broken"
+
+	// WHEN parsing it
+	_, err := ParseMapping(value)
+
+	// THEN the invalid line is reported
+	if err == nil || !strings.Contains(err.Error(), "line 5") {
+		t.Fatalf("expected line 5 to be reported, got %v", err)
+	}
+
+	// AND without it, every rule is read with clean paths
+	rules, err := ParseMapping(strings.TrimSuffix(value, "lib/broken"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(rules) != 2 || rules[0].Source != "lib/login" || !slices.Equal(rules[1].Tests, []string{"patrol_test/checkout", "patrol_test/smoke_test.dart"}) {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	rules := []Rule{
+		{Source: "lib/checkout", Tests: []string{"patrol_test/checkout"}},
+		{Source: "lib/login/login_page.dart", Tests: []string{"patrol_test/login_test.dart"}},
+		{Source: "lib/legacy", Tests: []string{"patrol_test/legacy"}},
+	}
+	tests := []struct {
+		name    string
+		changed []string
+		targets []string
+		reason  string
+	}{
+		{
+			name:    "edited tests and mapped sources",
+			changed: []string{"patrol_test/smoke_test.dart", "lib/checkout/cart.dart", "README.md", "test/unit_test.dart"},
+			targets: []string{"patrol_test/checkout/pay_test.dart", "patrol_test/checkout/refund_test.dart", "patrol_test/smoke_test.dart"},
+		},
+		{
+			name:    "deleted test",
+			changed: []string{"patrol_test/old_test.dart", "lib/login/login_page.dart"},
+			targets: []string{"patrol_test/login_test.dart"},
+		},
+		{
+			name:    "unmapped source",
+			changed: []string{"patrol_test/smoke_test.dart", "pubspec.yaml"},
+			reason:  "pubspec.yaml is not mapped to any test",
+		},
+		{
+			name:    "folder prefix is not a parent",
+			changed: []string{"lib/checkout_v2/cart.dart"},
+			reason:  "lib/checkout_v2/cart.dart is not mapped to any test",
+		},
+		{
+			name:    "test helper",
+			changed: []string{"patrol_test/common.dart"},
+			reason:  "patrol_test/common.dart is not mapped to any test",
+		},
+		{
+			name:    "mapping to missing tests",
+			changed: []string{"lib/legacy/old.dart"},
+			reason:  "lib/legacy is mapped to patrol_test/legacy, which holds no test",
+		},
+		{
+			name:    "documentation only",
+			changed: []string{"docs/guide.md"},
+			reason:  "no test is affected by the changes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN the changed files
+			// WHEN selecting the affected tests
+			targets, reason := Select(tt.changed, suite, rules)
+
+			// THEN the affected test files are selected, or every test is built
+			if reason != tt.reason || !slices.Equal(targets, tt.targets) {
+				t.Fatalf("expected %v (%q), got %v (%q)", tt.targets, tt.reason, targets, reason)
+			}
+		})
+	}
+}
+
+func TestTargetFromEnv(t *testing.T) {
+	// GIVEN a base ref and a change mapped to the login test
+	stubGit(t, []string{"lib/login/form.dart"}, nil)
+	t.Setenv(constants.ChangedTestsBaseRef, "origin/main")
+	t.Setenv(constants.ChangedTestsMapping, "lib/login = patrol_test/login_test.dart, patrol_test/smoke_test.dart")
+
+	// WHEN resolving the target
+	target, err := TargetFromEnv()
+
+	// THEN only the mapped tests are targeted
+	if err != nil || target != "patrol_test/login_test.dart,patrol_test/smoke_test.dart" {
+		t.Fatalf("unexpected target %q, error %v", target, err)
+	}
+}
+
+func TestTargetFromEnv_FallsBackWhenGitFails(t *testing.T) {
+	// GIVEN a base ref that was not fetched
+	stubGit(t, nil, errors.New("unknown revision origin/main"))
+	t.Setenv(constants.ChangedTestsBaseRef, "origin/main")
+	t.Setenv(constants.ChangedTestsMapping, "")
+
+	// WHEN resolving the target
+	target, err := TargetFromEnv()
+
+	// THEN every test is built
+	if err != nil || target != "" {
+		t.Fatalf("expected every test to be built, got %q, error %v", target, err)
+	}
+}
+
+func TestTargetFromEnv_InvalidMapping(t *testing.T) {
+	// GIVEN a mapping line without tests
+	stubGit(t, nil, nil)
+	t.Setenv(constants.ChangedTestsBaseRef, "origin/main")
+	t.Setenv(constants.ChangedTestsMapping, "lib/login =")
+
+	// WHEN resolving the target
+	_, err := TargetFromEnv()
+
+	// THEN the configuration error fails the build
+	if err == nil || !strings.Contains(err.Error(), constants.ChangedTestsMapping) {
+		t.Fatalf("expected a mapping error, got %v", err)
+	}
+}
+
+func TestApplyFromEnv_SelectsOnce(t *testing.T) {
+	// GIVEN a change mapped to the login test, and no target selected yet
+	calls := 0
+	stubGit(t, []string{"lib/login/form.dart"}, nil)
+	changedFiles = func(string) ([]string, error) {
+		calls++
+		return []string{"lib/login/form.dart"}, nil
+	}
+	t.Setenv(constants.ChangedTestsBaseRef, "origin/main")
+	t.Setenv(constants.ChangedTestsMapping, "lib/login = patrol_test/login_test.dart")
+	t.Setenv(constants.TestTargetDirectory, "patrol_test")
+	t.Setenv(SelectedTargetEnvKey, "")
+	os.Unsetenv(SelectedTargetEnvKey)
+
+	// WHEN applying the selection twice, as the configurations of a build matrix do
+	for range 2 {
+		if err := ApplyFromEnv(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// THEN the changes are listed once and the test target points at the selected tests
+	if calls != 1 || os.Getenv(constants.TestTargetDirectory) != "patrol_test/login_test.dart" {
+		t.Fatalf("expected one selection of the login test, got %d calls and target %q", calls, os.Getenv(constants.TestTargetDirectory))
+	}
+	if target, err := TargetFromEnv(); err != nil || target != "patrol_test/login_test.dart" {
+		t.Fatalf("expected the selected target to be reused, got %q, error %v", target, err)
+	}
+}
@@ -0,0 +1,112 @@
+package check_tags
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	constants "patrol_install/steps/build/constants"
+	tag_expression "patrol_install/steps/build/models/tag_expression"
+	"patrol_install/steps/test_discovery"
+	print "patrol_install/utils/print"
+)
+
+// Modes accepted by TAG_CHECK.
+const (
+	ModeWarn = "warn"
+	ModeFail = "fail"
+	ModeOff  = "off"
+)
+
+var discoverTests = test_discovery.DiscoverFromEnv
+
+// ModeFromEnv reads TAG_CHECK, defaulting to warn.
+func ModeFromEnv() (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv(constants.TagCheck))); mode {
+	case "":
+		return ModeWarn, nil
+	case ModeWarn, ModeFail, ModeOff:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid value for %s: expected '%s', '%s' or '%s'", constants.TagCheck, ModeWarn, ModeFail, ModeOff)
+	}
+}
+
+// CheckFromEnv compares TAGS and EXCLUDED_TAGS with the tags used by the tests under the test
+// directory. Problems are printed as warnings, or fail the build when TAG_CHECK is fail. Tests that
+// cannot be scanned never fail the build since the scanner only understands literal tags.
+func CheckFromEnv() error {
+	mode, err := ModeFromEnv()
+	if err != nil || mode == ModeOff {
+		return err
+	}
+	include, err := tag_expression.Parse(os.Getenv(constants.Tags))
+	if err != nil {
+		return err
+	}
+	exclude, err := tag_expression.Parse(os.Getenv(constants.ExcludedTags))
+	if err != nil {
+		return err
+	}
+	if include == nil && exclude == nil {
+		return nil
+	}
+
+	print.StepInitiated("--- Checking Test Tags ---")
+	tests, err := discoverTests()
+	if err != nil {
+		print.Warning(fmt.Sprintf("Skipping the tag check: %v", err))
+		return nil
+	}
+	if len(tests) == 0 {
+		print.Warning("Skipping the tag check: no patrolTest found in the test directory")
+		return nil
+	}
+	known := test_discovery.KnownTags(tests)
+	print.Action(fmt.Sprintf("Known tags: %s", orNone(known)))
+
+	problems := Check(tests, include, exclude)
+	if len(problems) == 0 {
+		print.Success(fmt.Sprintf("%d of %d tests match the tag filters", len(test_discovery.Filter(tests, include, exclude)), len(tests)))
+		return nil
+	}
+	err = errors.Join(problems...)
+	if mode == ModeFail {
+		print.Error(err.Error())
+		return fmt.Errorf("tag check failed: %w", err)
+	}
+	print.Warning(fmt.Sprintf("%v\nSet %s to %s to stop the build on these problems.", err, constants.TagCheck, ModeFail))
+	return nil
+}
+
+// Check reports each tag of include or exclude no test carries, and filters selecting no test.
+func Check(tests []test_discovery.Test, include, exclude *tag_expression.Expression) []error {
+	known := test_discovery.KnownTags(tests)
+	var problems []error
+	for _, filter := range []struct {
+		input      string
+		expression *tag_expression.Expression
+	}{{"tags", include}, {"excluded_tags", exclude}} {
+		if filter.expression == nil {
+			continue
+		}
+		for _, tag := range filter.expression.Tags() {
+			if _, found := slices.BinarySearch(known, tag); !found {
+				problems = append(problems, fmt.Errorf("tag %q in %s is not used by any test", tag, filter.input))
+			}
+		}
+	}
+	if len(test_discovery.Filter(tests, include, exclude)) == 0 {
+		problems = append(problems, fmt.Errorf("the tag filters select none of the %d tests", len(tests)))
+	}
+	return problems
+}
+
+func orNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,86 @@
+package check_tags
+
+import (
+	"strings"
+	"testing"
+
+	constants "patrol_install/steps/build/constants"
+	"patrol_install/steps/test_discovery"
+)
+
+func stubTests(t *testing.T, tests ...test_discovery.Test) {
+	original := discoverTests
+	discoverTests = func() ([]test_discovery.Test, error) { return tests, nil }
+	t.Cleanup(func() { discoverTests = original })
+}
+
+var suite = []test_discovery.Test{
+	{Name: "logs in", Tags: []string{"smoke"}},
+	{Name: "pays", Tags: []string{"flaky", "smoke"}},
+}
+
+func TestCheckFromEnv_WarnsByDefault(t *testing.T) {
+	// GIVEN a misspelled tag and the default mode
+	stubTests(t, suite...)
+	t.Setenv(constants.TagCheck, "")
+	t.Setenv(constants.Tags, "smok")
+	t.Setenv(constants.ExcludedTags, "")
+
+	// WHEN checking the tags
+	err := CheckFromEnv()
+
+	// THEN the build goes on
+	if err != nil {
+		t.Fatalf("expected a warning only, got %v", err)
+	}
+}
+
+func TestCheckFromEnv_FailMode(t *testing.T) {
+	// GIVEN an unknown excluded tag and tags excluding every test, with the fail mode
+	stubTests(t, suite...)
+	t.Setenv(constants.TagCheck, "fail")
+	t.Setenv(constants.Tags, "smoke")
+	t.Setenv(constants.ExcludedTags, "smoke || wip")
+
+	// WHEN checking the tags
+	err := CheckFromEnv()
+
+	// THEN every problem fails the build
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{`tag "wip" in excluded_tags is not used by any test`, "the tag filters select none of the 2 tests"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestCheckFromEnv_SkipsWithoutTests(t *testing.T) {
+	// GIVEN a test directory where no patrolTest could be found
+	stubTests(t)
+	t.Setenv(constants.TagCheck, "fail")
+	t.Setenv(constants.Tags, "smoke")
+	t.Setenv(constants.ExcludedTags, "")
+
+	// WHEN checking the tags
+	err := CheckFromEnv()
+
+	// THEN the check is skipped rather than failing on what the scanner cannot see
+	if err != nil {
+		t.Fatalf("expected the check to be skipped, got %v", err)
+	}
+}
+
+func TestModeFromEnv_Invalid(t *testing.T) {
+	// GIVEN an unknown mode
+	t.Setenv(constants.TagCheck, "strict")
+
+	// WHEN reading it
+	_, err := ModeFromEnv()
+
+	// THEN it is rejected
+	if err == nil || !strings.Contains(err.Error(), constants.TagCheck) {
+		t.Fatalf("expected an invalid mode error, got %v", err)
+	}
+}
@@ -12,6 +12,7 @@ func BuildParametersFromEnv() (*bp.BuildParameters, error) {
 		"platform":     os.Getenv(constants.Platform),
 		"target":       os.Getenv(constants.TestTargetDirectory),
 		"buildType":    os.Getenv(constants.BuildType),
+		"flavor":       os.Getenv(constants.Flavor),
 		"tags":         os.Getenv(constants.Tags),
 		"excludedTags": os.Getenv(constants.ExcludedTags),
 		"verbose":      os.Getenv(constants.IsVerboseMode),
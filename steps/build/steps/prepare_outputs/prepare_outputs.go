@@ -0,0 +1,78 @@
+package prepare_outputs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	constants "patrol_install/steps/build/constants"
+	build_record "patrol_install/steps/build/models/build_record"
+	print "patrol_install/utils/print"
+	step_inputs "patrol_install/utils/step_inputs"
+)
+
+// OutputRoots are the folders patrol build writes its artifacts into.
+var OutputRoots = []string{constants.AndroidBuildOutputsPath, constants.IOSBuildOutputsPath}
+
+var now = time.Now
+
+// PrepareOutputsFromEnv reads CLEAN_BUILD_OUTPUTS, prepares the output folders for a new build and
+// keeps its start time in PATROL_BUILD_STARTED_AT for RecordOutputsFromEnv and the export stage.
+func PrepareOutputsFromEnv() error {
+	clean, err := CleanFromEnv()
+	if err != nil {
+		return err
+	}
+	startedAt, err := PrepareOutputs(clean, OutputRoots, constants.BuildRecordPath)
+	if err != nil {
+		return err
+	}
+	return os.Setenv(build_record.StartedEnvKey, startedAt.Format(time.RFC3339Nano))
+}
+
+// CleanFromEnv reports whether CLEAN_BUILD_OUTPUTS asks for the output roots to be removed.
+func CleanFromEnv() (bool, error) {
+	return step_inputs.ParseBool(constants.CleanBuildOutputs, os.Getenv(constants.CleanBuildOutputs))
+}
+
+// PrepareOutputs optionally removes the output roots, then removes the record of the previous build
+// so a failed build leaves none behind, and returns the start time of the new build.
+func PrepareOutputs(clean bool, roots []string, recordPath string) (time.Time, error) {
+	if clean {
+		for _, root := range roots {
+			print.Action(fmt.Sprintf("Removing previous build outputs in %s", root))
+			if err := os.RemoveAll(root); err != nil {
+				return time.Time{}, fmt.Errorf("failed to clean %s: %w", root, err)
+			}
+		}
+	}
+	if err := os.Remove(recordPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, fmt.Errorf("failed to remove the previous build record: %w", err)
+	}
+	return now().Round(0), nil
+}
+
+// RecordOutputsFromEnv records the outputs of the build started at PATROL_BUILD_STARTED_AT.
+func RecordOutputsFromEnv() error {
+	startedAt, err := time.Parse(time.RFC3339Nano, os.Getenv(build_record.StartedEnvKey))
+	if err != nil {
+		return fmt.Errorf("the start of the build was not recorded: %w", err)
+	}
+	_, err = RecordOutputs(startedAt, OutputRoots, constants.BuildRecordPath)
+	return err
+}
+
+// RecordOutputs fingerprints the files the build left in roots, so the export stage can reject
+// artifacts the build did not produce or that changed since.
+func RecordOutputs(startedAt time.Time, roots []string, recordPath string) (*build_record.Record, error) {
+	record, err := build_record.New(startedAt, now().Round(0), roots)
+	if err != nil {
+		return nil, err
+	}
+	if err := record.Save(recordPath); err != nil {
+		return nil, fmt.Errorf("failed to save build record: %w", err)
+	}
+	return record, nil
+}
@@ -0,0 +1,88 @@
+package prepare_outputs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	build_record "patrol_install/steps/build/models/build_record"
+)
+
+func TestPrepareOutputs_Clean(t *testing.T) {
+	// GIVEN an output root with a leftover artifact and the record of the previous build
+	root := filepath.Join(t.TempDir(), "outputs")
+	leftover := filepath.Join(root, "app-release.apk")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(leftover, []byte("old"), 0644); err != nil {
+		t.Fatalf("write leftover: %v", err)
+	}
+	recordPath := filepath.Join(t.TempDir(), "record.json")
+	if err := (&build_record.Record{}).Save(recordPath); err != nil {
+		t.Fatalf("save record: %v", err)
+	}
+
+	// WHEN preparing with clean enabled
+	_, err := PrepareOutputs(true, []string{root}, recordPath)
+
+	// THEN the root and the previous record are removed
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Fatalf("expected leftover to be removed, got %v", err)
+	}
+	if _, err := os.Stat(recordPath); !os.IsNotExist(err) {
+		t.Fatalf("expected the previous record to be removed, got %v", err)
+	}
+}
+
+func TestRecordOutputs_FingerprintsBuildOutputs(t *testing.T) {
+	// GIVEN an output root kept from an earlier build
+	root := t.TempDir()
+	leftover := filepath.Join(root, "app-release.apk")
+	if err := os.WriteFile(leftover, []byte("old"), 0644); err != nil {
+		t.Fatalf("write leftover: %v", err)
+	}
+	started := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	original := now
+	now = func() time.Time { return started }
+	t.Cleanup(func() { now = original })
+	recordPath := filepath.Join(t.TempDir(), "record.json")
+
+	// WHEN preparing without cleaning and recording the outputs after the build
+	startedAt, err := PrepareOutputs(false, []string{root}, recordPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	record, err := RecordOutputs(startedAt, []string{root}, recordPath)
+
+	// THEN the artifact stays, is fingerprinted and the record is saved
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := os.Stat(leftover); err != nil {
+		t.Fatalf("expected leftover to remain: %v", err)
+	}
+	if record.Files[leftover] == "" || !record.StartedAt.Equal(started) {
+		t.Fatalf("unexpected record %+v", record)
+	}
+	if _, err := build_record.Load(recordPath); err != nil {
+		t.Fatalf("expected record to be saved: %v", err)
+	}
+}
+
+func TestPrepareOutputsFromEnv_InvalidFlag(t *testing.T) {
+	// GIVEN an invalid clean flag
+	t.Setenv("CLEAN_BUILD_OUTPUTS", "yes")
+
+	// WHEN preparing from env
+	err := PrepareOutputsFromEnv()
+
+	// THEN the value is rejected
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
@@ -0,0 +1,180 @@
+package build_matrix
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	build_constants "patrol_install/steps/build/constants"
+	build_parameters "patrol_install/steps/build/models/build_parameters"
+	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
+)
+
+// Keys accepted in a matrix line. They are the step inputs a configuration overrides.
+const (
+	KeyPlatform  = "platform"
+	KeyBuildType = "test_build_type"
+	KeyFlavor    = "flavor"
+)
+
+// Configuration is one build of a matrix.
+type Configuration struct {
+	Platform  string
+	BuildType string
+	Flavor    string
+}
+
+// ID names the configuration, e.g. android-release-staging. It names the artifacts subfolder
+// and, upper-cased, suffixes the outputs of the configuration.
+func (c Configuration) ID() string {
+	parts := []string{c.Platform, c.BuildType}
+	if c.Flavor != "" {
+		parts = append(parts, c.Flavor)
+	}
+	return strings.Join(parts, "-")
+}
+
+// OutputSuffix is appended to the outputs exported for the configuration, e.g. _ANDROID_RELEASE_STAGING.
+func (c Configuration) OutputSuffix() string {
+	return "_" + strings.ToUpper(strings.ReplaceAll(c.ID(), "-", "_"))
+}
+
+// FromEnv parses BUILD_MATRIX. Keys missing from a line take the value of the matching input.
+// It returns no configuration when the matrix is empty.
+func FromEnv() ([]Configuration, error) {
+	defaults := Configuration{
+		Platform:  os.Getenv(build_constants.Platform),
+		BuildType: os.Getenv(build_constants.BuildType),
+		Flavor:    os.Getenv(build_constants.Flavor),
+	}
+	return Parse(os.Getenv(build_constants.BuildMatrix), defaults)
+}
+
+// Parse reads one configuration per line as comma separated key=value pairs, e.g.
+//
+//	platform=android, test_build_type=debug|release, flavor=dev|prod
+//
+// Values separated by | expand into every combination. Empty lines and lines starting with # are
+// skipped. Every invalid line and duplicated configuration is reported.
+func Parse(value string, defaults Configuration) ([]Configuration, error) {
+	var configurations []Configuration
+	var errs []error
+	seen := map[string]int{}
+	for i, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		expanded, err := parseLine(line, defaults)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("build matrix line %d: %w", i+1, err))
+			continue
+		}
+		for _, configuration := range expanded {
+			id := strings.ToLower(configuration.ID())
+			if previous, ok := seen[id]; ok {
+				errs = append(errs, fmt.Errorf("build matrix line %d: configuration %s is already built by line %d", i+1, configuration.ID(), previous))
+				continue
+			}
+			seen[id] = i + 1
+			configurations = append(configurations, configuration)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return configurations, nil
+}
+
+func parseLine(line string, defaults Configuration) ([]Configuration, error) {
+	values := map[string][]string{
+		KeyPlatform:  {defaults.Platform},
+		KeyBuildType: {defaults.BuildType},
+		KeyFlavor:    {defaults.Flavor},
+	}
+	for _, pair := range strings.Split(line, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", strings.TrimSpace(pair))
+		}
+		if _, known := values[key]; !known {
+			return nil, fmt.Errorf("unknown key %q: expected %s, %s or %s", key, KeyPlatform, KeyBuildType, KeyFlavor)
+		}
+		var alternatives []string
+		for _, alternative := range strings.Split(value, "|") {
+			alternatives = append(alternatives, strings.TrimSpace(alternative))
+		}
+		values[key] = alternatives
+	}
+
+	var configurations []Configuration
+	var errs []error
+	for _, platform := range values[KeyPlatform] {
+		for _, buildType := range values[KeyBuildType] {
+			for _, flavor := range values[KeyFlavor] {
+				configuration, err := newConfiguration(platform, buildType, flavor)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				configurations = append(configurations, configuration)
+			}
+		}
+	}
+	return configurations, errors.Join(errs...)
+}
+
+// newConfiguration validates the values through the build parameter setters, which also bring the
+// platform and build type to the case of their step.yml options.
+func newConfiguration(platform, buildType, flavor string) (Configuration, error) {
+	bp := &build_parameters.BuildParameters{}
+	errs := []error{build_parameters.SetPlatform(bp, platform), build_parameters.SetBuildType(bp, buildType)}
+	if flavor != "" {
+		errs = append(errs, build_parameters.SetFlavor(bp, flavor))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Configuration{}, err
+	}
+	return Configuration{Platform: bp.Platform, BuildType: bp.BuildType, Flavor: bp.Flavor}, nil
+}
+
+// Inputs returns the values of the inputs the configuration overrides, by environment variable.
+func (c Configuration) Inputs() map[string]string {
+	return map[string]string{
+		build_constants.Platform:  c.Platform,
+		build_constants.BuildType: c.BuildType,
+		build_constants.Flavor:    c.Flavor,
+	}
+}
+
+// Apply points the build and export inputs at the configuration: its artifacts go to its own
+// subfolder of root and its outputs are exported with its suffix. The returned func restores the
+// previous inputs.
+func (c Configuration) Apply(root string) (restore func()) {
+	values := c.Inputs()
+	values[build_constants.ArtifactsDir] = filepath.Join(root, c.ID())
+	previous := make(map[string]*string, len(values))
+	for key, value := range values {
+		if old, ok := os.LookupEnv(key); ok {
+			previous[key] = &old
+		} else {
+			previous[key] = nil
+		}
+		_ = os.Setenv(key, value)
+	}
+	export_artifacts_utils.SetOutputSuffix(c.OutputSuffix())
+
+	return func() {
+		for key, old := range previous {
+			if old == nil {
+				_ = os.Unsetenv(key)
+			} else {
+				_ = os.Setenv(key, *old)
+			}
+		}
+		export_artifacts_utils.SetOutputSuffix("")
+	}
+}
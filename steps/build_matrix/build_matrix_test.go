@@ -0,0 +1,99 @@
+package build_matrix
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	build_constants "patrol_install/steps/build/constants"
+	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
+)
+
+func TestParse_ExpandsAlternatives(t *testing.T) {
+	// GIVEN a matrix with alternatives, a comment and a line relying on the inputs
+	matrix := `
+# flavored android builds
+platform=android, test_build_type=debug|release, flavor=dev|prod
+platform=iOS
+`
+	defaults := Configuration{Platform: "both", BuildType: "release"}
+
+	// WHEN parsing it
+	configurations, err := Parse(matrix, defaults)
+
+	// THEN every combination is built in order, missing keys taking the inputs
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var ids []string
+	for _, configuration := range configurations {
+		ids = append(ids, configuration.ID())
+	}
+	want := "android-debug-dev,android-debug-prod,android-release-dev,android-release-prod,ios-release"
+	if strings.Join(ids, ",") != want {
+		t.Fatalf("expected %s, got %v", want, ids)
+	}
+	if suffix := configurations[3].OutputSuffix(); suffix != "_ANDROID_RELEASE_PROD" {
+		t.Fatalf("unexpected output suffix %s", suffix)
+	}
+}
+
+func TestParse_ReportsEveryInvalidLine(t *testing.T) {
+	// GIVEN lines with an unknown key, an invalid build type and a duplicated configuration
+	matrix := "platform=android, arch=arm64\nplatform=ios, test_build_type=profile\nplatform=android\nplatform=android"
+
+	// WHEN parsing it
+	_, err := Parse(matrix, Configuration{BuildType: "debug"})
+
+	// THEN each problem is reported with its line
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"line 1: unknown key \"arch\"", "line 2: invalid build type", "line 4: configuration android-debug is already built by line 3"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestParse_EmptyMatrix(t *testing.T) {
+	// GIVEN an empty matrix
+	// WHEN parsing it
+	configurations, err := Parse(" \n", Configuration{Platform: "android", BuildType: "debug"})
+
+	// THEN there is no configuration to build
+	if err != nil || len(configurations) != 0 {
+		t.Fatalf("expected no configuration, got %v, %v", configurations, err)
+	}
+}
+
+func TestApply_SetsAndRestoresInputs(t *testing.T) {
+	// GIVEN inputs for a single build
+	t.Setenv(build_constants.Platform, "both")
+	t.Setenv(build_constants.BuildType, "release")
+	t.Setenv(build_constants.ArtifactsDir, "out")
+	t.Setenv(build_constants.Flavor, "")
+	_ = os.Unsetenv(build_constants.Flavor)
+	configuration := Configuration{Platform: "android", BuildType: "debug", Flavor: "dev"}
+
+	// WHEN applying a configuration
+	restore := configuration.Apply("out")
+
+	// THEN the inputs and output keys point at it until restored
+	if os.Getenv(build_constants.Platform) != "android" || os.Getenv(build_constants.Flavor) != "dev" ||
+		os.Getenv(build_constants.ArtifactsDir) != filepath.Join("out", "android-debug-dev") {
+		t.Fatalf("unexpected env after apply")
+	}
+	if key := export_artifacts_utils.OutputKey("ANDROID_APK_PATH"); key != "ANDROID_APK_PATH_ANDROID_DEBUG_DEV" {
+		t.Fatalf("unexpected output key %s", key)
+	}
+	restore()
+	if _, ok := os.LookupEnv(build_constants.Flavor); ok || os.Getenv(build_constants.Platform) != "both" ||
+		os.Getenv(build_constants.ArtifactsDir) != "out" {
+		t.Fatalf("expected the inputs to be restored")
+	}
+	if key := export_artifacts_utils.OutputKey("ANDROID_APK_PATH"); key != "ANDROID_APK_PATH" {
+		t.Fatalf("expected the output suffix to be cleared, got %s", key)
+	}
+}
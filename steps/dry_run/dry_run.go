@@ -0,0 +1,153 @@
+package dry_run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	v "github.com/Masterminds/semver/v3"
+
+	"patrol_install/commands"
+	build "patrol_install/steps/build"
+	constants "patrol_install/steps/build/constants"
+	"patrol_install/steps/export_artifacts"
+	install_cli_tool "patrol_install/steps/install_patrol_cli/install_cli_tool"
+	"patrol_install/steps/validate"
+	"patrol_install/utils/print"
+	"patrol_install/utils/step_inputs"
+)
+
+// Planner resolves every stage without side effects. Version detection runs read-only commands.
+type Planner interface {
+	validate.Validator
+	GetPatrolCLIVersion(ctx context.Context) (*v.Version, error)
+	PlanBuild() (*build.BuildPlan, error)
+	PlanExport() (*export_artifacts.ExportPlan, error)
+}
+
+// EnabledFromEnv reports whether DRY_RUN is set.
+func EnabledFromEnv() (bool, error) {
+	return step_inputs.ParseBool(constants.DryRun, os.Getenv(constants.DryRun))
+}
+
+// Run prints what the step would install, build, copy and export. Versions are detected and
+// checked for compatibility, but nothing is installed, built or copied. Every problem found is
+// reported, not only the first one.
+func Run(ctx context.Context, planner Planner) error {
+	print.StepInitiated("--- Dry run: nothing will be installed, built or exported ---")
+
+	cliVersion := planInstall(ctx, planner)
+
+	var errs []error
+	if err := planValidation(ctx, planner, cliVersion); err != nil {
+		errs = append(errs, err)
+	}
+	if err := planBuild(planner); err != nil {
+		errs = append(errs, fmt.Errorf("build inputs: %w", err))
+	}
+	if err := planExport(planner); err != nil {
+		errs = append(errs, fmt.Errorf("export inputs: %w", err))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		print.Error("❌ Dry run found problems, a real run would fail")
+		return err
+	}
+	print.StepCompleted("✅ Dry run completed, the configuration is valid")
+	return nil
+}
+
+// planInstall returns the Patrol CLI version the run would use, or nil when only installing tells.
+func planInstall(ctx context.Context, planner Planner) *v.Version {
+	print.StepInitiated("--- Install ---")
+	version, err := planner.GetPatrolCLIVersion(ctx)
+	if err == nil {
+		print.Action(fmt.Sprintf("Patrol CLI %s is already installed, nothing would be installed", version))
+		return version
+	}
+
+	installCmd, err := install_cli_tool.InstallCommandFromEnv()
+	if err != nil {
+		print.Warning(fmt.Sprintf("Could not resolve the install command: %v", err))
+	} else {
+		print.Action("Would run: " + commandLine(installCmd))
+	}
+	custom := strings.TrimSpace(os.Getenv(constants.CustomPatrolCLIVersion))
+	if custom == "" {
+		return nil
+	}
+	version, err = v.NewVersion(custom)
+	if err != nil {
+		print.Warning(fmt.Sprintf("Custom Patrol CLI version %q is not a semantic version", custom))
+		return nil
+	}
+	return version
+}
+
+func planValidation(ctx context.Context, planner Planner, cliVersion *v.Version) error {
+	if cliVersion != nil {
+		return validate.Run(ctx, validate.ValidatorRunParams{Runner: planner, CliVersion: cliVersion})
+	}
+
+	print.Warning("Skipping the compatibility check: the Patrol CLI version is only known after installing the latest release")
+	flutterInfo, flutterErr := planner.GetFlutterVersion(ctx)
+	if flutterErr == nil {
+		flutterSummary := validate.FlutterSummary(flutterInfo)
+		print.Action(flutterSummary.String())
+	}
+	patrolVersion, patrolErr := planner.GetPatrolVersion(ctx)
+	if patrolErr == nil {
+		print.Action("Patrol Version: " + patrolVersion.String())
+	}
+	return errors.Join(flutterErr, patrolErr)
+}
+
+func planBuild(planner Planner) error {
+	print.StepInitiated("--- Build ---")
+	plan, err := planner.PlanBuild()
+	if err != nil {
+		print.Error(err.Error())
+		return err
+	}
+	for _, root := range plan.CleanRoots {
+		print.Action("Would remove previous build outputs in " + root)
+	}
+	if plan.ChangedTests != "" {
+		print.Action("Would build only the tests affected by the changes: " + plan.ChangedTests)
+	}
+	for _, variable := range plan.Env {
+		print.Action("Would set for the build: " + variable)
+	}
+	for _, command := range plan.Commands {
+		argv := fmt.Sprintf("%q", append([]string{"sh", "-c"}, command))
+		print.Action(fmt.Sprintf("Would run: %s\n  argv: %s", command, argv))
+	}
+	return nil
+}
+
+func planExport(planner Planner) error {
+	print.StepInitiated("--- Export ---")
+	plan, err := planner.PlanExport()
+	if err != nil {
+		print.Error(err.Error())
+		return err
+	}
+	for _, artifact := range plan.Artifacts {
+		print.Action(fmt.Sprintf("Would copy %s %s: %s -> %s", artifact.Platform, artifact.Role, artifact.Path, artifact.Destination))
+	}
+	print.Action(fmt.Sprintf("Would export with the %s exporter:", plan.Exporter))
+	for _, output := range plan.Outputs {
+		value := output.Value
+		if value == "" {
+			value = "(read from the built app)"
+		}
+		print.Vanilla(fmt.Sprintf("  %s=%s", output.Key, value))
+	}
+	return nil
+}
+
+func commandLine(cmd commands.Command) string {
+	return strings.Join(append([]string{cmd.Name}, cmd.Args...), " ")
+}
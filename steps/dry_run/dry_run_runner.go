@@ -0,0 +1,40 @@
+package dry_run
+
+import (
+	"context"
+
+	v "github.com/Masterminds/semver/v3"
+
+	build "patrol_install/steps/build"
+	"patrol_install/steps/export_artifacts"
+	"patrol_install/steps/install_patrol_cli"
+	"patrol_install/steps/validate"
+	flutter "patrol_install/steps/validate/get_flutter_version"
+)
+
+type PlanRunner struct {
+	installer install_patrol_cli.InstallerRunner
+	validator validate.ValidatorRunner
+	builder   build.BuilderRunner
+	exporter  export_artifacts.ExporterRunner
+}
+
+func (p *PlanRunner) GetPatrolCLIVersion(ctx context.Context) (*v.Version, error) {
+	return p.installer.GetPatrolCLIVersion(ctx)
+}
+
+func (p *PlanRunner) GetFlutterVersion(ctx context.Context) (*flutter.VersionInfo, error) {
+	return p.validator.GetFlutterVersion(ctx)
+}
+
+func (p *PlanRunner) GetPatrolVersion(ctx context.Context) (*v.Version, error) {
+	return p.validator.GetPatrolVersion(ctx)
+}
+
+func (p *PlanRunner) PlanBuild() (*build.BuildPlan, error) {
+	return build.Plan(&p.builder)
+}
+
+func (p *PlanRunner) PlanExport() (*export_artifacts.ExportPlan, error) {
+	return p.exporter.Plan()
+}
@@ -0,0 +1,102 @@
+package dry_run
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	v "github.com/Masterminds/semver/v3"
+
+	build "patrol_install/steps/build"
+	constants "patrol_install/steps/build/constants"
+	"patrol_install/steps/export_artifacts"
+	flutter "patrol_install/steps/validate/get_flutter_version"
+)
+
+type plannerStub struct {
+	cliErr        error
+	buildErr      error
+	exportErr     error
+	exportPlanned bool
+}
+
+func (p *plannerStub) GetPatrolCLIVersion(_ context.Context) (*v.Version, error) {
+	if p.cliErr != nil {
+		return nil, p.cliErr
+	}
+	return v.MustParse("3.4.0"), nil
+}
+
+func (p *plannerStub) GetFlutterVersion(_ context.Context) (*flutter.VersionInfo, error) {
+	return &flutter.VersionInfo{Version: v.MustParse("3.24.0"), Channel: "stable", DartVersion: v.MustParse("3.5.0")}, nil
+}
+
+func (p *plannerStub) GetPatrolVersion(_ context.Context) (*v.Version, error) {
+	return v.MustParse("3.13.0"), nil
+}
+
+func (p *plannerStub) PlanBuild() (*build.BuildPlan, error) {
+	if p.buildErr != nil {
+		return nil, p.buildErr
+	}
+	return &build.BuildPlan{Commands: []string{"patrol build android --release"}}, nil
+}
+
+func (p *plannerStub) PlanExport() (*export_artifacts.ExportPlan, error) {
+	p.exportPlanned = true
+	if p.exportErr != nil {
+		return nil, p.exportErr
+	}
+	return &export_artifacts.ExportPlan{Exporter: "json"}, nil
+}
+
+func TestRun_ReportsEveryProblem(t *testing.T) {
+	// GIVEN a missing CLI, invalid build inputs and invalid export inputs
+	t.Setenv(constants.CustomPatrolCLIVersion, "")
+	planner := &plannerStub{
+		cliErr:    errors.New("patrol: not found"),
+		buildErr:  errors.New("missing required field: platform"),
+		exportErr: errors.New("invalid export mode"),
+	}
+
+	// WHEN running the dry run
+	err := Run(context.Background(), planner)
+
+	// THEN both input problems are reported and the export is still planned
+	if err == nil || !strings.Contains(err.Error(), "missing required field") || !strings.Contains(err.Error(), "invalid export mode") {
+		t.Fatalf("expected both problems, got %v", err)
+	}
+	if !planner.exportPlanned {
+		t.Fatal("expected the export to be planned despite the build error")
+	}
+}
+
+func TestRun_UsesCustomCLIVersionForCompatibility(t *testing.T) {
+	// GIVEN a missing CLI and an incompatible custom CLI version to install
+	t.Setenv(constants.CustomPatrolCLIVersion, "1.0.0")
+	planner := &plannerStub{cliErr: errors.New("patrol: not found")}
+
+	// WHEN running the dry run
+	err := Run(context.Background(), planner)
+
+	// THEN the compatibility check runs against the version that would be installed
+	if err == nil || !strings.Contains(err.Error(), "not compatible") {
+		t.Fatalf("expected a compatibility error, got %v", err)
+	}
+}
+
+func TestEnabledFromEnv(t *testing.T) {
+	t.Setenv(constants.DryRun, "")
+	if enabled, err := EnabledFromEnv(); err != nil || enabled {
+		t.Fatalf("expected disabled by default, got %v (%v)", enabled, err)
+	}
+	t.Setenv(constants.DryRun, "true")
+	if enabled, err := EnabledFromEnv(); err != nil || !enabled {
+		t.Fatalf("expected enabled, got %v (%v)", enabled, err)
+	}
+	t.Setenv(constants.DryRun, "yes")
+	if _, err := EnabledFromEnv(); err == nil {
+		t.Fatal("expected an invalid value to be rejected")
+	}
+}
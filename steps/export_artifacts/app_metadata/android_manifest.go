@@ -0,0 +1,289 @@
+package app_metadata
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf16"
+)
+
+const (
+	AndroidManifestEntry = "AndroidManifest.xml"
+
+	chunkStringPool   = 0x0001
+	chunkXML          = 0x0003
+	chunkResourceMap  = 0x0180
+	chunkStartElement = 0x0102
+
+	stringPoolUTF8Flag = 1 << 8
+	noEntry            = 0xFFFFFFFF
+
+	typeString     = 0x03
+	typeIntDec     = 0x10
+	typeIntHex     = 0x11
+	typeIntBoolean = 0x12
+
+	attrName          = 0x01010003
+	attrTargetPackage = 0x01010021
+	attrVersionCode   = 0x0101021b
+	attrVersionName   = 0x0101021c
+)
+
+var errNotBinaryXML = errors.New("not a binary XML document")
+
+// AndroidManifest holds the values read from a compiled AndroidManifest.xml.
+type AndroidManifest struct {
+	Package               string
+	VersionName           string
+	VersionCode           string
+	InstrumentationRunner string
+	InstrumentationTarget string
+}
+
+// ReadApkManifest opens the APK at apkPath and decodes its binary AndroidManifest.xml.
+func ReadApkManifest(apkPath string) (*AndroidManifest, error) {
+	archive, err := zip.OpenReader(apkPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", apkPath, err)
+	}
+	defer archive.Close()
+
+	for _, entry := range archive.File {
+		if entry.Name != AndroidManifestEntry {
+			continue
+		}
+		reader, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s in %s: %w", AndroidManifestEntry, apkPath, err)
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s in %s: %w", AndroidManifestEntry, apkPath, err)
+		}
+		return DecodeAndroidManifest(data)
+	}
+	return nil, fmt.Errorf("%s not found in %s", AndroidManifestEntry, apkPath)
+}
+
+// DecodeAndroidManifest parses the binary XML format used by aapt for AndroidManifest.xml.
+// Only the manifest and instrumentation elements are inspected.
+func DecodeAndroidManifest(data []byte) (*AndroidManifest, error) {
+	if len(data) < 8 || binary.LittleEndian.Uint16(data) != chunkXML {
+		return nil, errNotBinaryXML
+	}
+
+	manifest := &AndroidManifest{}
+	var pool []string
+	var resourceIDs []uint32
+
+	offset := int(binary.LittleEndian.Uint16(data[2:]))
+	for offset+8 <= len(data) {
+		chunkType := binary.LittleEndian.Uint16(data[offset:])
+		chunkSize := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if chunkSize < 8 || offset+chunkSize > len(data) {
+			return nil, fmt.Errorf("malformed chunk at offset %d", offset)
+		}
+		chunk := data[offset : offset+chunkSize]
+
+		switch chunkType {
+		case chunkStringPool:
+			decoded, err := decodeStringPool(chunk)
+			if err != nil {
+				return nil, err
+			}
+			pool = decoded
+		case chunkResourceMap:
+			headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+			for i := headerSize; i+4 <= len(chunk); i += 4 {
+				resourceIDs = append(resourceIDs, binary.LittleEndian.Uint32(chunk[i:]))
+			}
+		case chunkStartElement:
+			element, err := decodeStartElement(chunk, pool, resourceIDs)
+			if err != nil {
+				return nil, err
+			}
+			applyElement(manifest, element)
+		}
+
+		offset += chunkSize
+	}
+
+	if manifest.Package == "" {
+		return nil, errors.New("manifest package attribute not found")
+	}
+	return manifest, nil
+}
+
+type xmlAttribute struct {
+	name       string
+	resourceID uint32
+	value      string
+}
+
+type xmlElement struct {
+	name       string
+	attributes []xmlAttribute
+}
+
+func (e xmlElement) attribute(name string, resourceID uint32) string {
+	for _, attr := range e.attributes {
+		if (resourceID != 0 && attr.resourceID == resourceID) || attr.name == name {
+			return attr.value
+		}
+	}
+	return ""
+}
+
+func applyElement(manifest *AndroidManifest, element xmlElement) {
+	switch element.name {
+	case "manifest":
+		manifest.Package = element.attribute("package", 0)
+		manifest.VersionName = element.attribute("versionName", attrVersionName)
+		manifest.VersionCode = element.attribute("versionCode", attrVersionCode)
+	case "instrumentation":
+		if manifest.InstrumentationRunner != "" {
+			return
+		}
+		manifest.InstrumentationRunner = element.attribute("name", attrName)
+		manifest.InstrumentationTarget = element.attribute("targetPackage", attrTargetPackage)
+	}
+}
+
+func decodeStartElement(chunk []byte, pool []string, resourceIDs []uint32) (xmlElement, error) {
+	headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+	if headerSize+20 > len(chunk) {
+		return xmlElement{}, errors.New("malformed start element")
+	}
+	ext := chunk[headerSize:]
+	element := xmlElement{name: stringAt(pool, binary.LittleEndian.Uint32(ext[4:]))}
+
+	attributeStart := int(binary.LittleEndian.Uint16(ext[8:]))
+	attributeSize := int(binary.LittleEndian.Uint16(ext[10:]))
+	attributeCount := int(binary.LittleEndian.Uint16(ext[12:]))
+	for i := 0; i < attributeCount; i++ {
+		start := attributeStart + i*attributeSize
+		if start+20 > len(ext) {
+			return xmlElement{}, errors.New("malformed attribute")
+		}
+		raw := ext[start:]
+		nameIndex := binary.LittleEndian.Uint32(raw[4:])
+		attr := xmlAttribute{name: stringAt(pool, nameIndex)}
+		if int(nameIndex) < len(resourceIDs) {
+			attr.resourceID = resourceIDs[nameIndex]
+		}
+		attr.value = attributeValue(pool, binary.LittleEndian.Uint32(raw[8:]), raw[15], binary.LittleEndian.Uint32(raw[16:]))
+		element.attributes = append(element.attributes, attr)
+	}
+	return element, nil
+}
+
+func attributeValue(pool []string, rawValue uint32, dataType byte, data uint32) string {
+	if rawValue != noEntry {
+		return stringAt(pool, rawValue)
+	}
+	switch dataType {
+	case typeString:
+		return stringAt(pool, data)
+	case typeIntDec:
+		return strconv.FormatInt(int64(int32(data)), 10)
+	case typeIntHex:
+		return fmt.Sprintf("0x%x", data)
+	case typeIntBoolean:
+		return strconv.FormatBool(data != 0)
+	default:
+		return ""
+	}
+}
+
+func stringAt(pool []string, index uint32) string {
+	if index == noEntry || int(index) >= len(pool) {
+		return ""
+	}
+	return pool[index]
+}
+
+func decodeStringPool(chunk []byte) ([]string, error) {
+	if len(chunk) < 28 {
+		return nil, errors.New("malformed string pool")
+	}
+	count := int(binary.LittleEndian.Uint32(chunk[8:]))
+	flags := binary.LittleEndian.Uint32(chunk[16:])
+	stringsStart := int(binary.LittleEndian.Uint32(chunk[20:]))
+	headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+	isUTF8 := flags&stringPoolUTF8Flag != 0
+
+	if headerSize+count*4 > len(chunk) {
+		return nil, errors.New("malformed string pool offsets")
+	}
+
+	decoded := make([]string, count)
+	for i := 0; i < count; i++ {
+		start := stringsStart + int(binary.LittleEndian.Uint32(chunk[headerSize+i*4:]))
+		if start >= len(chunk) {
+			return nil, fmt.Errorf("string %d out of bounds", i)
+		}
+		var err error
+		if isUTF8 {
+			decoded[i], err = decodeUTF8String(chunk[start:])
+		} else {
+			decoded[i], err = decodeUTF16String(chunk[start:])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return decoded, nil
+}
+
+func decodeUTF8String(data []byte) (string, error) {
+	// The UTF-16 length precedes the UTF-8 byte length; only the latter is needed.
+	_, n := decodeUTF8Length(data)
+	if n == 0 {
+		return "", errors.New("malformed UTF-8 string")
+	}
+	length, m := decodeUTF8Length(data[n:])
+	if m == 0 || n+m+length > len(data) {
+		return "", errors.New("malformed UTF-8 string")
+	}
+	return string(data[n+m : n+m+length]), nil
+}
+
+func decodeUTF8Length(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	if data[0]&0x80 == 0 {
+		return int(data[0]), 1
+	}
+	if len(data) < 2 {
+		return 0, 0
+	}
+	return int(data[0]&0x7F)<<8 | int(data[1]), 2
+}
+
+func decodeUTF16String(data []byte) (string, error) {
+	if len(data) < 2 {
+		return "", errors.New("malformed UTF-16 string")
+	}
+	length := int(binary.LittleEndian.Uint16(data))
+	start := 2
+	if length&0x8000 != 0 {
+		if len(data) < 4 {
+			return "", errors.New("malformed UTF-16 string")
+		}
+		length = (length&0x7FFF)<<16 | int(binary.LittleEndian.Uint16(data[2:]))
+		start = 4
+	}
+	if start+length*2 > len(data) {
+		return "", errors.New("malformed UTF-16 string")
+	}
+	units := make([]uint16, length)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[start+i*2:])
+	}
+	return string(utf16.Decode(units)), nil
+}
@@ -0,0 +1,234 @@
+package app_metadata
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+type testAttribute struct {
+	name       string
+	resourceID uint32
+	value      string
+	intValue   uint32
+	isInt      bool
+}
+
+type testElement struct {
+	name       string
+	attributes []testAttribute
+}
+
+// encodeManifest builds a minimal binary XML document with the given elements.
+func encodeManifest(t *testing.T, utf8Pool bool, elements ...testElement) []byte {
+	t.Helper()
+	var pool []string
+	var resourceIDs []uint32
+	index := func(s string) uint32 {
+		for i, existing := range pool {
+			if existing == s {
+				return uint32(i)
+			}
+		}
+		pool = append(pool, s)
+		return uint32(len(pool) - 1)
+	}
+
+	// Attribute names with resource IDs must come first so the resource map lines up.
+	for _, element := range elements {
+		for _, attr := range element.attributes {
+			if attr.resourceID != 0 {
+				index(attr.name)
+				resourceIDs = append(resourceIDs, attr.resourceID)
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	for _, element := range elements {
+		var ext bytes.Buffer
+		write(&ext, uint32(noEntry), index(element.name), uint16(20), uint16(20), uint16(len(element.attributes)), uint16(0), uint16(0), uint16(0))
+		for _, attr := range element.attributes {
+			raw := uint32(noEntry)
+			dataType := byte(typeIntDec)
+			data := attr.intValue
+			if !attr.isInt {
+				raw = index(attr.value)
+				dataType = typeString
+				data = raw
+			}
+			write(&ext, uint32(noEntry), index(attr.name), raw, uint16(8), byte(0), dataType, data)
+		}
+		write(&body, uint16(chunkStartElement), uint16(16), uint32(16+ext.Len()), uint32(1), uint32(noEntry))
+		body.Write(ext.Bytes())
+	}
+
+	var strs bytes.Buffer
+	offsets := make([]uint32, len(pool))
+	for i, s := range pool {
+		offsets[i] = uint32(strs.Len())
+		if utf8Pool {
+			write(&strs, byte(len(s)), byte(len(s)))
+			strs.WriteString(s)
+			strs.WriteByte(0)
+		} else {
+			units := utf16.Encode([]rune(s))
+			write(&strs, uint16(len(units)), units, uint16(0))
+		}
+	}
+	for strs.Len()%4 != 0 {
+		strs.WriteByte(0)
+	}
+	flags := uint32(0)
+	if utf8Pool {
+		flags = stringPoolUTF8Flag
+	}
+	var stringPool bytes.Buffer
+	stringsStart := uint32(28 + 4*len(pool))
+	write(&stringPool, uint16(chunkStringPool), uint16(28), stringsStart+uint32(strs.Len()), uint32(len(pool)), uint32(0), flags, stringsStart, uint32(0), offsets)
+	stringPool.Write(strs.Bytes())
+
+	var resourceMap bytes.Buffer
+	write(&resourceMap, uint16(chunkResourceMap), uint16(8), uint32(8+4*len(resourceIDs)), resourceIDs)
+
+	var doc bytes.Buffer
+	total := 8 + stringPool.Len() + resourceMap.Len() + body.Len()
+	write(&doc, uint16(chunkXML), uint16(8), uint32(total))
+	doc.Write(stringPool.Bytes())
+	doc.Write(resourceMap.Bytes())
+	doc.Write(body.Bytes())
+	return doc.Bytes()
+}
+
+func write(buf *bytes.Buffer, values ...any) {
+	for _, v := range values {
+		_ = binary.Write(buf, binary.LittleEndian, v)
+	}
+}
+
+func appManifestElements() []testElement {
+	return []testElement{
+		{name: "manifest", attributes: []testAttribute{
+			{name: "versionCode", resourceID: attrVersionCode, intValue: 42, isInt: true},
+			{name: "versionName", resourceID: attrVersionName, value: "1.4.0"},
+			{name: "package", value: "com.example.app"},
+		}},
+		{name: "application"},
+	}
+}
+
+func TestDecodeAndroidManifest_AppManifest(t *testing.T) {
+	// GIVEN an app manifest encoded with a UTF-16 string pool
+	data := encodeManifest(t, false, appManifestElements()...)
+
+	// WHEN decoding it
+	manifest, err := DecodeAndroidManifest(data)
+
+	// THEN package and version values are returned
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if manifest.Package != "com.example.app" {
+		t.Fatalf("expected package com.example.app, got %q", manifest.Package)
+	}
+	if manifest.VersionName != "1.4.0" || manifest.VersionCode != "42" {
+		t.Fatalf("expected version 1.4.0 (42), got %q (%q)", manifest.VersionName, manifest.VersionCode)
+	}
+	if manifest.InstrumentationRunner != "" {
+		t.Fatalf("expected no instrumentation, got %q", manifest.InstrumentationRunner)
+	}
+}
+
+func TestDecodeAndroidManifest_InstrumentationManifest(t *testing.T) {
+	// GIVEN a test manifest encoded with a UTF-8 string pool
+	data := encodeManifest(t, true,
+		testElement{name: "manifest", attributes: []testAttribute{
+			{name: "package", value: "com.example.app.test"},
+		}},
+		testElement{name: "instrumentation", attributes: []testAttribute{
+			{name: "name", resourceID: attrName, value: "pl.leancode.patrol.PatrolJUnitRunner"},
+			{name: "targetPackage", resourceID: attrTargetPackage, value: "com.example.app"},
+		}},
+	)
+
+	// WHEN decoding it
+	manifest, err := DecodeAndroidManifest(data)
+
+	// THEN the instrumentation runner and target are returned
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if manifest.Package != "com.example.app.test" {
+		t.Fatalf("expected test package, got %q", manifest.Package)
+	}
+	if manifest.InstrumentationRunner != "pl.leancode.patrol.PatrolJUnitRunner" {
+		t.Fatalf("unexpected runner %q", manifest.InstrumentationRunner)
+	}
+	if manifest.InstrumentationTarget != "com.example.app" {
+		t.Fatalf("unexpected target package %q", manifest.InstrumentationTarget)
+	}
+}
+
+func TestDecodeAndroidManifest_NotBinary(t *testing.T) {
+	// GIVEN a plain text manifest
+	data := []byte(`<manifest package="com.example.app"/>`)
+
+	// WHEN decoding it
+	_, err := DecodeAndroidManifest(data)
+
+	// THEN it is rejected
+	if err != errNotBinaryXML {
+		t.Fatalf("expected errNotBinaryXML, got %v", err)
+	}
+}
+
+func TestReadApkManifest(t *testing.T) {
+	// GIVEN an APK containing a binary manifest
+	apkPath := filepath.Join(t.TempDir(), "app-release.apk")
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	entry, err := writer.Create(AndroidManifestEntry)
+	if err != nil {
+		t.Fatalf("create zip entry: %v", err)
+	}
+	if _, err := entry.Write(encodeManifest(t, false, appManifestElements()...)); err != nil {
+		t.Fatalf("write zip entry: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	if err := os.WriteFile(apkPath, archive.Bytes(), 0644); err != nil {
+		t.Fatalf("write apk: %v", err)
+	}
+
+	// WHEN reading the manifest
+	manifest, err := ReadApkManifest(apkPath)
+
+	// THEN it is decoded from the archive
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if manifest.Package != "com.example.app" {
+		t.Fatalf("expected package com.example.app, got %q", manifest.Package)
+	}
+}
+
+func TestReadApkManifest_NotAnArchive(t *testing.T) {
+	// GIVEN a file that is not a zip archive
+	apkPath := filepath.Join(t.TempDir(), "app-release.apk")
+	if err := os.WriteFile(apkPath, []byte("dummy"), 0644); err != nil {
+		t.Fatalf("write apk: %v", err)
+	}
+
+	// WHEN reading the manifest
+	_, err := ReadApkManifest(apkPath)
+
+	// THEN an error is returned
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
@@ -0,0 +1,38 @@
+package app_metadata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"howett.net/plist"
+)
+
+const InfoPlistName = "Info.plist"
+
+// BundleInfo holds the identifying values from an .app bundle's Info.plist.
+type BundleInfo struct {
+	BundleIdentifier string `plist:"CFBundleIdentifier"`
+	ShortVersion     string `plist:"CFBundleShortVersionString"`
+	BundleVersion    string `plist:"CFBundleVersion"`
+	Executable       string `plist:"CFBundleExecutable"`
+}
+
+// ReadBundleInfo decodes the Info.plist at the root of an iOS .app bundle.
+// Both XML and binary property lists are supported.
+func ReadBundleInfo(appPath string) (*BundleInfo, error) {
+	plistPath := filepath.Join(appPath, InfoPlistName)
+	data, err := os.ReadFile(plistPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", plistPath, err)
+	}
+
+	info := &BundleInfo{}
+	if _, err := plist.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", plistPath, err)
+	}
+	if info.BundleIdentifier == "" {
+		return nil, fmt.Errorf("CFBundleIdentifier missing in %s", plistPath)
+	}
+	return info, nil
+}
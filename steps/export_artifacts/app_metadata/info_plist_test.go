@@ -0,0 +1,90 @@
+package app_metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"howett.net/plist"
+)
+
+func writeInfoPlist(t *testing.T, format int, values map[string]string) string {
+	t.Helper()
+	appPath := filepath.Join(t.TempDir(), "Runner.app")
+	if err := os.MkdirAll(appPath, 0755); err != nil {
+		t.Fatalf("mkdir app: %v", err)
+	}
+	data, err := plist.Marshal(values, format)
+	if err != nil {
+		t.Fatalf("marshal plist: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(appPath, InfoPlistName), data, 0644); err != nil {
+		t.Fatalf("write plist: %v", err)
+	}
+	return appPath
+}
+
+func TestReadBundleInfo_Binary(t *testing.T) {
+	// GIVEN a bundle with a binary Info.plist
+	appPath := writeInfoPlist(t, plist.BinaryFormat, map[string]string{
+		"CFBundleIdentifier":         "com.example.app",
+		"CFBundleShortVersionString": "1.4.0",
+		"CFBundleVersion":            "42",
+		"CFBundleExecutable":         "Runner",
+	})
+
+	// WHEN reading the bundle info
+	info, err := ReadBundleInfo(appPath)
+
+	// THEN all fields are decoded
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.BundleIdentifier != "com.example.app" || info.ShortVersion != "1.4.0" || info.BundleVersion != "42" || info.Executable != "Runner" {
+		t.Fatalf("unexpected bundle info %+v", info)
+	}
+}
+
+func TestReadBundleInfo_XML(t *testing.T) {
+	// GIVEN a bundle with an XML Info.plist
+	appPath := writeInfoPlist(t, plist.XMLFormat, map[string]string{
+		"CFBundleIdentifier": "com.example.app.RunnerUITests.xctrunner",
+	})
+
+	// WHEN reading the bundle info
+	info, err := ReadBundleInfo(appPath)
+
+	// THEN the identifier is decoded
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.BundleIdentifier != "com.example.app.RunnerUITests.xctrunner" {
+		t.Fatalf("unexpected bundle identifier %q", info.BundleIdentifier)
+	}
+}
+
+func TestReadBundleInfo_MissingIdentifier(t *testing.T) {
+	// GIVEN an Info.plist without CFBundleIdentifier
+	appPath := writeInfoPlist(t, plist.XMLFormat, map[string]string{"CFBundleVersion": "1"})
+
+	// WHEN reading the bundle info
+	_, err := ReadBundleInfo(appPath)
+
+	// THEN an error is returned
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestReadBundleInfo_MissingPlist(t *testing.T) {
+	// GIVEN a bundle without Info.plist
+	appPath := t.TempDir()
+
+	// WHEN reading the bundle info
+	_, err := ReadBundleInfo(appPath)
+
+	// THEN an error is returned
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
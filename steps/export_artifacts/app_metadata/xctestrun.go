@@ -0,0 +1,83 @@
+package app_metadata
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"howett.net/plist"
+)
+
+const xctestrunMetadataKey = "__xctestrun_metadata__"
+
+// XCTestRunTarget describes one test target entry of an .xctestrun file.
+type XCTestRunTarget struct {
+	Name                        string `plist:"BlueprintName"`
+	TestHostPath                string `plist:"TestHostPath"`
+	TestHostBundleIdentifier    string `plist:"TestHostBundleIdentifier"`
+	UITargetAppPath             string `plist:"UITargetAppPath"`
+	UITargetAppBundleIdentifier string `plist:"UITargetAppBundleIdentifier"`
+}
+
+type xctestrunV2 struct {
+	TestConfigurations []struct {
+		TestTargets []XCTestRunTarget `plist:"TestTargets"`
+	} `plist:"TestConfigurations"`
+}
+
+// ReadXCTestRunTargets decodes the test targets of an .xctestrun file.
+// Both format version 1 (targets keyed by name) and version 2 (TestConfigurations) are supported.
+func ReadXCTestRunTargets(path string) ([]XCTestRunTarget, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	v2 := xctestrunV2{}
+	if _, err := plist.Unmarshal(data, &v2); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	var targets []XCTestRunTarget
+	for _, configuration := range v2.TestConfigurations {
+		targets = append(targets, configuration.TestTargets...)
+	}
+	if len(targets) > 0 {
+		return targets, nil
+	}
+
+	v1 := map[string]any{}
+	if _, err := plist.Unmarshal(data, &v1); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	names := make([]string, 0, len(v1))
+	for name := range v1 {
+		if name != xctestrunMetadataKey {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entry, ok := v1[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		targets = append(targets, XCTestRunTarget{
+			Name:                        name,
+			TestHostPath:                stringValue(entry, "TestHostPath"),
+			TestHostBundleIdentifier:    stringValue(entry, "TestHostBundleIdentifier"),
+			UITargetAppPath:             stringValue(entry, "UITargetAppPath"),
+			UITargetAppBundleIdentifier: stringValue(entry, "UITargetAppBundleIdentifier"),
+		})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no test targets found in %s", path)
+	}
+	return targets, nil
+}
+
+func stringValue(entry map[string]any, key string) string {
+	if value, ok := entry[key].(string); ok {
+		return value
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package app_metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"howett.net/plist"
+)
+
+func writeXCTestRun(t *testing.T, value any) string {
+	t.Helper()
+	data, err := plist.Marshal(value, plist.XMLFormat)
+	if err != nil {
+		t.Fatalf("marshal xctestrun: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "Runner.xctestrun")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("write xctestrun: %v", err)
+	}
+	return path
+}
+
+func TestReadXCTestRunTargets_FormatVersion2(t *testing.T) {
+	// GIVEN an xctestrun file using TestConfigurations
+	path := writeXCTestRun(t, map[string]any{
+		"TestConfigurations": []any{
+			map[string]any{
+				"Name": "Test Scheme Action",
+				"TestTargets": []any{
+					map[string]any{
+						"BlueprintName":            "RunnerUITests",
+						"TestHostPath":             "__TESTROOT__/Release-iphoneos/RunnerUITests-Runner.app",
+						"TestHostBundleIdentifier": "com.example.app.RunnerUITests.xctrunner",
+						"UITargetAppPath":          "__TESTROOT__/Release-iphoneos/Runner.app",
+					},
+				},
+			},
+		},
+		"__xctestrun_metadata__": map[string]any{"FormatVersion": 2},
+	})
+
+	// WHEN reading the targets
+	targets, err := ReadXCTestRunTargets(path)
+
+	// THEN the target is decoded
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(targets) != 1 {
+		t.Fatalf("expected 1 target, got %d", len(targets))
+	}
+	if targets[0].Name != "RunnerUITests" || targets[0].UITargetAppPath != "__TESTROOT__/Release-iphoneos/Runner.app" {
+		t.Fatalf("unexpected target %+v", targets[0])
+	}
+}
+
+func TestReadXCTestRunTargets_FormatVersion1(t *testing.T) {
+	// GIVEN an xctestrun file keyed by target name
+	path := writeXCTestRun(t, map[string]any{
+		"RunnerUITests": map[string]any{
+			"TestHostPath":                "__TESTROOT__/Debug-iphonesimulator/RunnerUITests-Runner.app",
+			"UITargetAppPath":             "__TESTROOT__/Debug-iphonesimulator/Runner.app",
+			"UITargetAppBundleIdentifier": "com.example.app",
+		},
+		"__xctestrun_metadata__": map[string]any{"FormatVersion": 1},
+	})
+
+	// WHEN reading the targets
+	targets, err := ReadXCTestRunTargets(path)
+
+	// THEN the target is named after its key
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(targets) != 1 || targets[0].Name != "RunnerUITests" {
+		t.Fatalf("unexpected targets %+v", targets)
+	}
+	if targets[0].UITargetAppBundleIdentifier != "com.example.app" {
+		t.Fatalf("unexpected bundle identifier %q", targets[0].UITargetAppBundleIdentifier)
+	}
+}
+
+func TestReadXCTestRunTargets_Invalid(t *testing.T) {
+	// GIVEN a file that is not a property list
+	path := filepath.Join(t.TempDir(), "Runner.xctestrun")
+	if err := os.WriteFile(path, []byte("run"), 0644); err != nil {
+		t.Fatalf("write xctestrun: %v", err)
+	}
+
+	// WHEN reading the targets
+	_, err := ReadXCTestRunTargets(path)
+
+	// THEN an error is returned
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
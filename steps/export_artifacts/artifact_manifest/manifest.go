@@ -0,0 +1,187 @@
+package artifact_manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileName is the name of the manifest written next to the exported artifacts.
+const FileName = "manifest.json"
+
+// ErrChecksumMismatch is returned when an exported copy differs from its source.
+var ErrChecksumMismatch = errors.New("exported artifact does not match its source")
+
+// Entry describes one exported artifact. Folders such as .app bundles are described by the
+// total size of their files and a digest over every entry path, file digest and link target.
+type Entry struct {
+	// Configuration is the build matrix configuration the artifact was built by, empty outside a matrix.
+	Configuration string `json:"configuration,omitempty"`
+	Platform      string `json:"platform"`
+	Role          string `json:"role"`
+	Path          string `json:"path"`
+	Size          int64  `json:"size"`
+	SHA256        string `json:"sha256"`
+}
+
+// Manifest lists every artifact exported in a run.
+type Manifest struct {
+	Artifacts []Entry `json:"artifacts"`
+}
+
+// Add appends an entry.
+func (m *Manifest) Add(entry Entry) {
+	m.Artifacts = append(m.Artifacts, entry)
+}
+
+// Save writes the manifest as JSON with entry paths relative to the manifest folder,
+// so the folder can be downloaded and moved as a whole.
+func (m *Manifest) Save(path string) error {
+	dir := filepath.Dir(path)
+	out := Manifest{Artifacts: make([]Entry, len(m.Artifacts))}
+	for i, entry := range m.Artifacts {
+		if rel, err := filepath.Rel(dir, entry.Path); err == nil {
+			entry.Path = filepath.ToSlash(rel)
+		}
+		out.Artifacts[i] = entry
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create folder for %s: %w", path, err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Load reads a manifest written by Save.
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid artifact manifest %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// Expected is what a transferred file must match: its size, and the digest of the bytes written
+// when it was copied. Cloned or linked files share their data with the source, so they have no digest.
+type Expected struct {
+	Size   int64
+	SHA256 string
+}
+
+// Verify hashes dst once and checks every file listed in expected, keyed by its path below dst,
+// or dst itself for a single file. It returns the size and digest of dst. Links are not compared
+// since the symlink policy may rewrite them.
+func Verify(dst string, expected map[string]Expected) (int64, string, error) {
+	size, digest, files, err := describe(dst)
+	if err != nil {
+		return 0, "", err
+	}
+
+	for path, want := range expected {
+		rel, err := filepath.Rel(dst, path)
+		if err != nil {
+			return 0, "", err
+		}
+		got := fileState{size: size, digest: digest}
+		if rel != "." {
+			var ok bool
+			if got, ok = files[rel]; !ok {
+				return 0, "", fmt.Errorf("%w: %s is missing from %s", ErrChecksumMismatch, rel, dst)
+			}
+		}
+		if got.size != want.Size {
+			return 0, "", fmt.Errorf("%w: %s (expected %d bytes, got %d)", ErrChecksumMismatch, path, want.Size, got.size)
+		}
+		if want.SHA256 != "" && got.digest != want.SHA256 {
+			return 0, "", fmt.Errorf("%w: %s (expected sha256 %s, got %s)", ErrChecksumMismatch, path, want.SHA256, got.digest)
+		}
+	}
+	return size, digest, nil
+}
+
+// fileState is the size and digest of one regular file.
+type fileState struct {
+	size   int64
+	digest string
+}
+
+// describe returns the size and digest of path. For folders it also returns the size and digest of
+// each regular file keyed by its relative path.
+func describe(path string) (int64, string, map[string]fileState, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	if !info.IsDir() {
+		digest, err := fileDigest(path)
+		return info.Size(), digest, nil, err
+	}
+
+	var size int64
+	files := map[string]fileState{}
+	tree := sha256.New()
+	err = filepath.WalkDir(path, func(entry string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, entry)
+		if err != nil || rel == "." {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			fmt.Fprintf(tree, "%s\x00dir\n", filepath.ToSlash(rel))
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(entry)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(tree, "%s\x00link\x00%s\n", filepath.ToSlash(rel), target)
+		default:
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			digest, err := fileDigest(entry)
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+			files[rel] = fileState{size: info.Size(), digest: digest}
+			fmt.Fprintf(tree, "%s\x00file\x00%s\n", filepath.ToSlash(rel), digest)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, "", nil, err
+	}
+	return size, hex.EncodeToString(tree.Sum(nil)), files, nil
+}
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,142 @@
+package artifact_manifest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+const apkDigest = "dd37c2d7274f7ea982cb83390c36918fee9ce8889073c44b68cdc00bdb8c3e04"
+
+func TestVerify_File(t *testing.T) {
+	// GIVEN a copied APK
+	dst := filepath.Join(t.TempDir(), "app.apk")
+	writeFile(t, dst, "apk")
+
+	// WHEN verifying it against the bytes written
+	size, digest, err := Verify(dst, map[string]Expected{dst: {Size: 3, SHA256: apkDigest}})
+
+	// THEN its size and digest are returned
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if size != 3 || digest != apkDigest {
+		t.Fatalf("unexpected size %d or digest %q", size, digest)
+	}
+}
+
+func TestVerify_TruncatedFile(t *testing.T) {
+	// GIVEN a copy shorter than its source
+	dst := filepath.Join(t.TempDir(), "app.apk")
+	writeFile(t, dst, "complete")
+
+	// WHEN verifying the copy
+	_, _, err := Verify(dst, map[string]Expected{dst: {Size: int64(len("complete apk"))}})
+
+	// THEN the mismatch is reported
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestVerify_CorruptedCopy(t *testing.T) {
+	// GIVEN a copy of the right size whose bytes differ from the ones written
+	dst := filepath.Join(t.TempDir(), "app.apk")
+	writeFile(t, dst, "apx")
+
+	// WHEN verifying the copy
+	_, _, err := Verify(dst, map[string]Expected{dst: {Size: 3, SHA256: apkDigest}})
+
+	// THEN the mismatch is reported
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestVerify_ClonedFileComparesSize(t *testing.T) {
+	// GIVEN a cloned file, which has no digest to compare
+	dst := filepath.Join(t.TempDir(), "app.apk")
+	writeFile(t, dst, "apk")
+
+	// WHEN verifying it
+	size, digest, err := Verify(dst, map[string]Expected{dst: {Size: 3}})
+
+	// THEN only its size is checked and its digest is still returned
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if size != 3 || digest != apkDigest {
+		t.Fatalf("unexpected size %d or digest %q", size, digest)
+	}
+}
+
+func TestVerify_BundleIgnoresRewrittenLinks(t *testing.T) {
+	// GIVEN a bundle copy whose absolute link was rewritten as a relative one
+	dst := filepath.Join(t.TempDir(), "Runner.app")
+	writeFile(t, filepath.Join(dst, "Frameworks", "App"), "binary")
+	if err := os.Symlink(filepath.Join("Frameworks", "App"), filepath.Join(dst, "App")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	// WHEN verifying the copy
+	size, _, err := Verify(dst, map[string]Expected{filepath.Join(dst, "Frameworks", "App"): {Size: int64(len("binary"))}})
+
+	// THEN it is accepted and sized by its files
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if size != int64(len("binary")) {
+		t.Fatalf("expected size %d, got %d", len("binary"), size)
+	}
+}
+
+func TestVerify_BundleMissingFile(t *testing.T) {
+	// GIVEN a bundle copy missing a file that was transferred
+	dst := filepath.Join(t.TempDir(), "Runner.app")
+	writeFile(t, filepath.Join(dst, "Info.plist"), "plist")
+	expected := map[string]Expected{
+		filepath.Join(dst, "Info.plist"): {Size: 5},
+		filepath.Join(dst, "Runner"):     {Size: 6},
+	}
+
+	// WHEN verifying the copy
+	_, _, err := Verify(dst, expected)
+
+	// THEN the missing file is reported
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	// GIVEN a manifest with an artifact next to it
+	dir := t.TempDir()
+	manifest := &Manifest{}
+	manifest.Add(Entry{Platform: "android", Role: "app", Path: filepath.Join(dir, "android", "app.apk"), Size: 3, SHA256: "abc"})
+	path := filepath.Join(dir, FileName)
+
+	// WHEN saving and loading it
+	if err := manifest.Save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err := Load(path)
+
+	// THEN paths are stored relative to the manifest
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(loaded.Artifacts) != 1 || loaded.Artifacts[0].Path != "android/app.apk" || loaded.Artifacts[0].SHA256 != "abc" {
+		t.Fatalf("unexpected manifest %+v", loaded)
+	}
+}
@@ -0,0 +1,133 @@
+package artifact_pairing
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	app_metadata "patrol_install/steps/export_artifacts/app_metadata"
+)
+
+// ErrArtifactsMismatch is returned when the exported app and test artifacts do not belong together.
+var ErrArtifactsMismatch = errors.New("app and test artifacts do not belong together")
+
+// ErrPairingUnverified is returned when the metadata needed to check the pairing cannot be read.
+// The export fails rather than publishing artifacts that may not belong together.
+var ErrPairingUnverified = errors.New("cannot verify that app and test artifacts belong together")
+
+// Report collects every pairing mismatch found for a platform, and why the pairing could not be verified.
+type Report struct {
+	Platform   string
+	Mismatches []string
+	Unverified []string
+}
+
+func (r *Report) addf(format string, args ...any) {
+	r.Mismatches = append(r.Mismatches, fmt.Sprintf(format, args...))
+}
+
+func (r *Report) unverifiedf(format string, args ...any) {
+	r.Unverified = append(r.Unverified, fmt.Sprintf(format, args...))
+}
+
+// Err returns nil when the pairing was verified, an error wrapping ErrArtifactsMismatch listing every
+// mismatch, or an error wrapping ErrPairingUnverified listing what could not be read.
+func (r Report) Err() error {
+	if len(r.Mismatches) > 0 {
+		return fmt.Errorf("%w (%s):\n  - %s", ErrArtifactsMismatch, r.Platform, strings.Join(r.Mismatches, "\n  - "))
+	}
+	if len(r.Unverified) > 0 {
+		return fmt.Errorf("%w (%s):\n  - %s", ErrPairingUnverified, r.Platform, strings.Join(r.Unverified, "\n  - "))
+	}
+	return nil
+}
+
+// CheckAndroid verifies that the instrumentation APK targets the app APK package.
+// readErr is the error met reading the manifests; the pairing is unverified when it is set or a manifest is missing.
+func CheckAndroid(app, test *app_metadata.AndroidManifest, readErr error) Report {
+	report := Report{Platform: "android"}
+	if readErr != nil {
+		report.unverifiedf("%v", readErr)
+		return report
+	}
+	if app == nil || test == nil {
+		report.unverifiedf("both the app and the instrumentation APK manifests are needed")
+		return report
+	}
+	if test.InstrumentationTarget == "" {
+		report.addf("instrumentation APK %s declares no targetPackage", test.Package)
+		return report
+	}
+	if test.InstrumentationTarget != app.Package {
+		report.addf("instrumentation APK targets %q but the app APK package is %q", test.InstrumentationTarget, app.Package)
+	}
+	return report
+}
+
+// IOSArtifacts groups the values needed to check the iOS pairing.
+type IOSArtifacts struct {
+	BuildDirName  string
+	AppName       string
+	RunnerName    string
+	App           *app_metadata.BundleInfo
+	Runner        *app_metadata.BundleInfo
+	XCTestRunFile string
+	XCTestTargets []app_metadata.XCTestRunTarget
+	// ReadErr is the error met reading the bundles or the xctestrun file.
+	ReadErr error
+}
+
+// CheckIOS verifies that the xctestrun file drives the exported Runner.app through the exported test runner.
+// Bundle identifiers are only compared when both sides are known. The pairing is unverified when
+// ReadErr is set or the xctestrun lists no test target.
+func CheckIOS(artifacts IOSArtifacts) Report {
+	report := Report{Platform: "ios"}
+	if artifacts.ReadErr != nil {
+		report.unverifiedf("%v", artifacts.ReadErr)
+	}
+	if len(artifacts.XCTestTargets) == 0 {
+		if artifacts.ReadErr == nil {
+			report.unverifiedf("%s lists no test target", path.Base(artifacts.XCTestRunFile))
+		}
+		return report
+	}
+
+	uiTargets := 0
+	for _, target := range artifacts.XCTestTargets {
+		if target.UITargetAppPath == "" {
+			continue
+		}
+		uiTargets++
+		checkBundlePath(&report, target.Name, "UITargetAppPath", target.UITargetAppPath, artifacts.BuildDirName, artifacts.AppName)
+		if target.TestHostPath != "" {
+			checkBundlePath(&report, target.Name, "TestHostPath", target.TestHostPath, artifacts.BuildDirName, artifacts.RunnerName)
+		}
+		if artifacts.App != nil && target.UITargetAppBundleIdentifier != "" && target.UITargetAppBundleIdentifier != artifacts.App.BundleIdentifier {
+			report.addf("%s: UITargetAppBundleIdentifier is %q but %s has %q",
+				target.Name, target.UITargetAppBundleIdentifier, artifacts.AppName, artifacts.App.BundleIdentifier)
+		}
+		if artifacts.Runner != nil && target.TestHostBundleIdentifier != "" && target.TestHostBundleIdentifier != artifacts.Runner.BundleIdentifier {
+			report.addf("%s: TestHostBundleIdentifier is %q but %s has %q",
+				target.Name, target.TestHostBundleIdentifier, artifacts.RunnerName, artifacts.Runner.BundleIdentifier)
+		}
+	}
+
+	if uiTargets == 0 {
+		report.addf("%s has no UI test target driving %s", path.Base(artifacts.XCTestRunFile), artifacts.AppName)
+	}
+	return report
+}
+
+// checkBundlePath compares an xctestrun path such as "__TESTROOT__/Release-iphoneos/Runner.app"
+// with the build directory and bundle name being exported.
+func checkBundlePath(report *Report, target, field, value, buildDirName, bundleName string) {
+	bundle := path.Base(value)
+	buildDir := path.Base(path.Dir(value))
+	if bundle != bundleName {
+		report.addf("%s: %s points to %s, expected %s", target, field, bundle, bundleName)
+	}
+	if buildDir != buildDirName {
+		report.addf("%s: %s is in %s but the exported build is %s", target, field, buildDir, buildDirName)
+	}
+}
@@ -0,0 +1,156 @@
+package artifact_pairing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	app_metadata "patrol_install/steps/export_artifacts/app_metadata"
+)
+
+func TestCheckAndroid_Matching(t *testing.T) {
+	// GIVEN an instrumentation APK targeting the app package
+	app := &app_metadata.AndroidManifest{Package: "com.example.app"}
+	test := &app_metadata.AndroidManifest{Package: "com.example.app.test", InstrumentationTarget: "com.example.app"}
+
+	// WHEN checking the pairing
+	err := CheckAndroid(app, test, nil).Err()
+
+	// THEN no error is returned
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestCheckAndroid_Mismatch(t *testing.T) {
+	// GIVEN an instrumentation APK targeting another package
+	app := &app_metadata.AndroidManifest{Package: "com.example.app"}
+	test := &app_metadata.AndroidManifest{Package: "com.other.test", InstrumentationTarget: "com.other"}
+
+	// WHEN checking the pairing
+	err := CheckAndroid(app, test, nil).Err()
+
+	// THEN a mismatch error names both packages
+	if !errors.Is(err, ErrArtifactsMismatch) {
+		t.Fatalf("expected ErrArtifactsMismatch, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "com.other") || !strings.Contains(err.Error(), "com.example.app") {
+		t.Fatalf("expected both packages in report, got %v", err)
+	}
+}
+
+func TestCheckAndroid_UnknownManifest(t *testing.T) {
+	// GIVEN a missing manifest
+	app := &app_metadata.AndroidManifest{Package: "com.example.app"}
+
+	// WHEN checking the pairing
+	err := CheckAndroid(app, nil, nil).Err()
+
+	// THEN the pairing is reported as unverified
+	if !errors.Is(err, ErrPairingUnverified) {
+		t.Fatalf("expected ErrPairingUnverified, got %v", err)
+	}
+}
+
+func TestCheckAndroid_ReadError(t *testing.T) {
+	// GIVEN a manifest that could not be decoded
+	app := &app_metadata.AndroidManifest{Package: "com.example.app"}
+
+	// WHEN checking the pairing
+	err := CheckAndroid(app, nil, errors.New("corrupt APK")).Err()
+
+	// THEN the read error is reported as unverified
+	if !errors.Is(err, ErrPairingUnverified) || !strings.Contains(err.Error(), "corrupt APK") {
+		t.Fatalf("expected ErrPairingUnverified naming the cause, got %v", err)
+	}
+}
+
+func iosArtifacts(targets ...app_metadata.XCTestRunTarget) IOSArtifacts {
+	return IOSArtifacts{
+		BuildDirName:  "Release-iphoneos",
+		AppName:       "Runner.app",
+		RunnerName:    "RunnerUITests-Runner.app",
+		App:           &app_metadata.BundleInfo{BundleIdentifier: "com.example.app"},
+		Runner:        &app_metadata.BundleInfo{BundleIdentifier: "com.example.app.RunnerUITests.xctrunner"},
+		XCTestRunFile: "build/ios_integ/Build/Products/Runner.xctestrun",
+		XCTestTargets: targets,
+	}
+}
+
+func TestCheckIOS_Matching(t *testing.T) {
+	// GIVEN an xctestrun target pointing at the exported bundles
+	artifacts := iosArtifacts(app_metadata.XCTestRunTarget{
+		Name:                     "RunnerUITests",
+		TestHostPath:             "__TESTROOT__/Release-iphoneos/RunnerUITests-Runner.app",
+		TestHostBundleIdentifier: "com.example.app.RunnerUITests.xctrunner",
+		UITargetAppPath:          "__TESTROOT__/Release-iphoneos/Runner.app",
+	})
+
+	// WHEN checking the pairing
+	err := CheckIOS(artifacts).Err()
+
+	// THEN no error is returned
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestCheckIOS_StaleBuildDirectory(t *testing.T) {
+	// GIVEN an xctestrun target from a simulator build
+	artifacts := iosArtifacts(app_metadata.XCTestRunTarget{
+		Name:                        "RunnerUITests",
+		TestHostPath:                "__TESTROOT__/Debug-iphonesimulator/RunnerUITests-Runner.app",
+		UITargetAppPath:             "__TESTROOT__/Debug-iphonesimulator/Runner.app",
+		UITargetAppBundleIdentifier: "com.other.app",
+	})
+
+	// WHEN checking the pairing
+	report := CheckIOS(artifacts)
+
+	// THEN every mismatch is reported
+	if !errors.Is(report.Err(), ErrArtifactsMismatch) {
+		t.Fatalf("expected ErrArtifactsMismatch, got %v", report.Err())
+	}
+	if len(report.Mismatches) != 3 {
+		t.Fatalf("expected 3 mismatches, got %v", report.Mismatches)
+	}
+}
+
+func TestCheckIOS_NoUITarget(t *testing.T) {
+	// GIVEN an xctestrun without UI test targets
+	artifacts := iosArtifacts(app_metadata.XCTestRunTarget{Name: "RunnerTests", TestHostPath: "__TESTROOT__/Release-iphoneos/Runner.app"})
+
+	// WHEN checking the pairing
+	err := CheckIOS(artifacts).Err()
+
+	// THEN a mismatch is reported
+	if !errors.Is(err, ErrArtifactsMismatch) {
+		t.Fatalf("expected ErrArtifactsMismatch, got %v", err)
+	}
+}
+
+func TestCheckIOS_Unverified(t *testing.T) {
+	tests := []struct {
+		name      string
+		artifacts IOSArtifacts
+	}{
+		{name: "no test target", artifacts: iosArtifacts()},
+		{name: "read error", artifacts: func() IOSArtifacts {
+			artifacts := iosArtifacts(app_metadata.XCTestRunTarget{UITargetAppPath: "__TESTROOT__/Release-iphoneos/Runner.app"})
+			artifacts.ReadErr = errors.New("invalid Info.plist")
+			return artifacts
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN artifacts whose pairing cannot be read
+			// WHEN checking the pairing
+			err := CheckIOS(tt.artifacts).Err()
+
+			// THEN the export is not allowed to go on
+			if !errors.Is(err, ErrPairingUnverified) {
+				t.Fatalf("expected ErrPairingUnverified, got %v", err)
+			}
+		})
+	}
+}
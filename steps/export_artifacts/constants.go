@@ -0,0 +1,17 @@
+package export_artifacts
+
+const (
+	ManifestPathEnvKey  = "PATROL_ARTIFACTS_MANIFEST"
+	ExportStatusEnvKey  = "PATROL_EXPORT_STATUS"
+	TestInventoryEnvKey = "PATROL_TEST_INVENTORY"
+	ShardPlanEnvKey     = "PATROL_SHARD_PLAN"
+	ShardCountEnvKey    = "PATROL_SHARD_COUNT"
+	// BuildConfigurationsEnvKey lists the IDs of the build matrix configurations, comma separated.
+	BuildConfigurationsEnvKey = "PATROL_BUILD_CONFIGURATIONS"
+
+	ExportStatusComplete = "complete"
+	ExportStatusPartial  = "partial"
+
+	ExportModeStrict     = "strict"
+	ExportModeBestEffort = "best_effort"
+)
@@ -0,0 +1,36 @@
+package export_artifacts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestOutputKeysMatchStepYml(t *testing.T) {
+	// GIVEN step.yml contents
+	stepYmlPath := filepath.Join("..", "..", "step.yml")
+	contents, err := os.ReadFile(stepYmlPath)
+	if err != nil {
+		t.Fatalf("read step.yml: %v", err)
+	}
+
+	// WHEN we search for the export output keys
+	outputKeys := []string{
+		ManifestPathEnvKey,
+		ExportStatusEnvKey,
+		TestInventoryEnvKey,
+		ShardPlanEnvKey,
+		ShardCountEnvKey,
+		BuildConfigurationsEnvKey,
+	}
+
+	// THEN each key exists in step.yml outputs
+	for _, key := range outputKeys {
+		pattern := fmt.Sprintf(`(?m)^\s*-\s+%s:`, regexp.QuoteMeta(key))
+		if !regexp.MustCompile(pattern).Match(contents) {
+			t.Fatalf("expected output key %s in step.yml", key)
+		}
+	}
+}
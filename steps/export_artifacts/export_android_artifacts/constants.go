@@ -1,12 +1,18 @@
 package export_android_artifacts
 
 const (
-	AndroidTestPath      = "build/app/outputs/apk/androidTest/"
-	AndroidAppPath       = "build/app/outputs/apk/"
-	DebugFolder          = "debug"
-	ReleaseFolder        = "release"
-	AndroidArtifactsPath = "patrol/android"
+	AndroidTestPath        = "build/app/outputs/apk/androidTest/"
+	AndroidAppPath         = "build/app/outputs/apk/"
+	DebugFolder            = "debug"
+	ReleaseFolder          = "release"
+	AndroidArtifactsFolder = "android"
 
 	InstrumentationPathEnvKey = "ANDROID_INSTRUMENTATION_APK_PATH"
 	ApkPathEnvKey             = "ANDROID_APK_PATH"
+
+	AppPackageEnvKey            = "ANDROID_APP_PACKAGE"
+	AppVersionNameEnvKey        = "ANDROID_APP_VERSION_NAME"
+	AppVersionCodeEnvKey        = "ANDROID_APP_VERSION_CODE"
+	TestPackageEnvKey           = "ANDROID_TEST_PACKAGE"
+	InstrumentationRunnerEnvKey = "ANDROID_TEST_INSTRUMENTATION_RUNNER"
 )
@@ -20,6 +20,11 @@ func TestAndroidOutputKeysMatchStepYml(t *testing.T) {
 	outputKeys := []string{
 		InstrumentationPathEnvKey,
 		ApkPathEnvKey,
+		AppPackageEnvKey,
+		AppVersionNameEnvKey,
+		AppVersionCodeEnvKey,
+		TestPackageEnvKey,
+		InstrumentationRunnerEnvKey,
 	}
 
 	// THEN each key exists in step.yml outputs
@@ -1,25 +1,32 @@
 package export_android_artifacts
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	regex "patrol_install/constants"
 	build_constants "patrol_install/steps/build/constants"
+	app_metadata "patrol_install/steps/export_artifacts/app_metadata"
+	artifact_manifest "patrol_install/steps/export_artifacts/artifact_manifest"
+	artifact_pairing "patrol_install/steps/export_artifacts/artifact_pairing"
 	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
 	print "patrol_install/utils/print"
 )
 
-// CopyAndroidArtifactsFromEnv derives paths from env and exports Android artifacts.
-func CopyAndroidArtifactsFromEnv() error {
+var readApkManifest = app_metadata.ReadApkManifest
+
+// CopyAndroidArtifactsFromEnv derives paths from env and exports Android artifacts, recording them in manifest.
+func CopyAndroidArtifactsFromEnv(manifest *artifact_manifest.Manifest) error {
 	isRelease := os.Getenv(build_constants.BuildType) == "release"
-	testPath, appPath := AndroidApkPaths(isRelease)
-	return CopyAndroidArtifacts(AndroidArtifactsPath, testPath, appPath)
+	testPath, appPath := AndroidApkPaths(isRelease, os.Getenv(build_constants.Flavor))
+	return CopyAndroidArtifacts(export_artifacts_utils.ArtifactsFolderFromEnv(AndroidArtifactsFolder), testPath, appPath, manifest)
 }
 
 // CopyAndroidArtifacts finds the first test and app APKs and copies them to the artifacts directory.
-func CopyAndroidArtifacts(artifactsPath, testPath, appPath string) error {
+// The copies are recorded in manifest unless it is nil.
+func CopyAndroidArtifacts(artifactsPath, testPath, appPath string, manifest *artifact_manifest.Manifest) error {
 	platform := os.Getenv(build_constants.Platform)
 	if !IsAndroidPlatform(platform) {
 		print.Action("No Android builds were selected to build")
@@ -27,19 +34,23 @@ func CopyAndroidArtifacts(artifactsPath, testPath, appPath string) error {
 	}
 
 	apkFiles := make([]string, 0, 2)
-	apkExportKeys := make([]string, 0, 2)
+	artifacts := make([]export_artifacts_utils.Artifact, 0, 2)
 
-	if testApk, err := FindFirstApkInDir(testPath); err != nil {
+	testApk, err := FindFirstApkInDir(testPath)
+	if err != nil {
 		return err
-	} else if testApk != "" {
+	}
+	if testApk != "" {
 		apkFiles = append(apkFiles, testApk)
-		apkExportKeys = append(apkExportKeys, InstrumentationPathEnvKey)
+		artifacts = append(artifacts, androidArtifact(testApk, InstrumentationPathEnvKey, export_artifacts_utils.RoleInstrumentation))
 	}
-	if appApk, err := FindFirstApkInDir(appPath); err != nil {
+	appApk, err := FindFirstApkInDir(appPath)
+	if err != nil {
 		return err
-	} else if appApk != "" {
+	}
+	if appApk != "" {
 		apkFiles = append(apkFiles, appApk)
-		apkExportKeys = append(apkExportKeys, ApkPathEnvKey)
+		artifacts = append(artifacts, androidArtifact(appApk, ApkPathEnvKey, export_artifacts_utils.RoleAppUnderTest))
 	}
 
 	if len(apkFiles) == 0 {
@@ -47,16 +58,60 @@ func CopyAndroidArtifacts(artifactsPath, testPath, appPath string) error {
 		return nil
 	}
 
+	if err := export_artifacts_utils.RejectStaleArtifacts(apkFiles); err != nil {
+		return err
+	}
+
+	appManifest, appErr := readManifest(appApk, "app")
+	testManifest, testErr := readManifest(testApk, "instrumentation")
+	if err := artifact_pairing.CheckAndroid(appManifest, testManifest, errors.Join(appErr, testErr)).Err(); err != nil {
+		print.Error(err.Error())
+		return err
+	}
+
 	if err := export_artifacts_utils.CreateFolder(artifactsPath); err != nil {
 		return err
 	}
 
-	if err := export_artifacts_utils.CopyFilesToFolder(apkFiles, artifactsPath, apkExportKeys); err != nil {
+	if err := export_artifacts_utils.CopyArtifactsToFolder(artifacts, artifactsPath, manifest); err != nil {
 		print.Error("Error by copying")
 		return err
 	}
 
-	return nil
+	return exportAndroidMetadata(appManifest, testManifest)
+}
+
+func androidArtifact(path, envKey, role string) export_artifacts_utils.Artifact {
+	return export_artifacts_utils.Artifact{Path: path, EnvKey: envKey, Platform: build_constants.PlatformAndroid, Role: role}
+}
+
+// readManifest decodes the manifest of apkPath. An absent or unreadable APK is an error.
+func readManifest(apkPath, role string) (*app_metadata.AndroidManifest, error) {
+	if apkPath == "" {
+		return nil, fmt.Errorf("no %s APK was found", role)
+	}
+	manifest, err := readApkManifest(apkPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the %s manifest from %s: %w", role, apkPath, err)
+	}
+	return manifest, nil
+}
+
+// exportAndroidMetadata exports package, version and runner values of the decoded manifests.
+func exportAndroidMetadata(appManifest, testManifest *app_metadata.AndroidManifest) error {
+	values := make([]string, 0, 5)
+	keys := make([]string, 0, 5)
+
+	if appManifest != nil {
+		values = append(values, appManifest.Package, appManifest.VersionName, appManifest.VersionCode)
+		keys = append(keys, AppPackageEnvKey, AppVersionNameEnvKey, AppVersionCodeEnvKey)
+	}
+	if testManifest != nil {
+		values = append(values, testManifest.Package, testManifest.InstrumentationRunner)
+		keys = append(keys, TestPackageEnvKey, InstrumentationRunnerEnvKey)
+	}
+
+	return export_artifacts_utils.ExportValues(values, keys)
 }
 
 // IsAndroidPlatform returns true if the platform is Android.
@@ -65,11 +120,16 @@ func IsAndroidPlatform(platform string) bool {
 }
 
 // AndroidApkPaths returns the test and app APK search paths for the given build type.
-func AndroidApkPaths(isRelease bool) (testPath, appPath string) {
+// Gradle nests flavored outputs in a folder named after the flavor.
+func AndroidApkPaths(isRelease bool, flavor string) (testPath, appPath string) {
+	folder := DebugFolder
 	if isRelease {
-		return AndroidTestPath + ReleaseFolder, AndroidAppPath + ReleaseFolder
+		folder = ReleaseFolder
+	}
+	if flavor != "" {
+		folder = flavor + "/" + folder
 	}
-	return AndroidTestPath + DebugFolder, AndroidAppPath + DebugFolder
+	return AndroidTestPath + folder, AndroidAppPath + folder
 }
 
 // FindFirstApkInDir returns the first APK file found in the given directory, or an empty string if none found.
@@ -94,3 +154,20 @@ func FindFirstApkInDir(root string) (string, error) {
 	}
 	return apkPath, nil
 }
+
+// MetadataEnvKeys lists the outputs read from the manifests of the exported APKs.
+var MetadataEnvKeys = []string{AppPackageEnvKey, AppVersionNameEnvKey, AppVersionCodeEnvKey, TestPackageEnvKey, InstrumentationRunnerEnvKey}
+
+// PlanAndroidArtifacts returns the APKs a build of buildType and flavor is expected to produce,
+// under the names Gradle gives them, without looking at the disk.
+func PlanAndroidArtifacts(buildType, flavor string) []export_artifacts_utils.Artifact {
+	testPath, appPath := AndroidApkPaths(buildType == "release", flavor)
+	variant := buildType
+	if flavor != "" {
+		variant = flavor + "-" + buildType
+	}
+	return []export_artifacts_utils.Artifact{
+		androidArtifact(filepath.Join(testPath, "app-"+variant+"-androidTest.apk"), InstrumentationPathEnvKey, export_artifacts_utils.RoleInstrumentation),
+		androidArtifact(filepath.Join(appPath, "app-"+variant+".apk"), ApkPathEnvKey, export_artifacts_utils.RoleAppUnderTest),
+	}
+}
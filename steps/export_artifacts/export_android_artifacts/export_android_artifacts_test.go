@@ -1,12 +1,15 @@
 package export_android_artifacts
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	build_constants "patrol_install/steps/build/constants"
+	app_metadata "patrol_install/steps/export_artifacts/app_metadata"
+	artifact_pairing "patrol_install/steps/export_artifacts/artifact_pairing"
 	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
 )
 
@@ -49,15 +52,20 @@ func TestIsAndroidPlatform(t *testing.T) {
 }
 
 func TestAndroidApkPaths(t *testing.T) {
-	testReleasePath, appReleasePath := AndroidApkPaths(true)
+	testReleasePath, appReleasePath := AndroidApkPaths(true, "")
 	if !strings.Contains(testReleasePath, "release") || !strings.Contains(appReleasePath, "release") {
 		t.Error("AndroidApkPaths(true) should return release paths")
 	}
 
-	testDebugPath, appDebugPath := AndroidApkPaths(false)
+	testDebugPath, appDebugPath := AndroidApkPaths(false, "")
 	if !strings.Contains(testDebugPath, "debug") || !strings.Contains(appDebugPath, "debug") {
 		t.Error("AndroidApkPaths(false) should return debug paths")
 	}
+
+	testFlavorPath, appFlavorPath := AndroidApkPaths(true, "staging")
+	if testFlavorPath != AndroidTestPath+"staging/release" || appFlavorPath != AndroidAppPath+"staging/release" {
+		t.Errorf("AndroidApkPaths(true, staging) should nest the flavor, got %s and %s", testFlavorPath, appFlavorPath)
+	}
 }
 
 func TestFindFirstApkInDir_NotFound(t *testing.T) {
@@ -114,7 +122,7 @@ func TestFindFirstApkInDir_MultipleApks(t *testing.T) {
 func TestCopyAndroidArtifacts_NoAndroid(t *testing.T) {
 	setupEnvExporterStub(t)
 	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
-	err := CopyAndroidArtifacts(t.TempDir(), t.TempDir(), t.TempDir())
+	err := CopyAndroidArtifacts(t.TempDir(), t.TempDir(), t.TempDir(), nil)
 	if err != nil {
 		t.Errorf("expected nil for ios platform, got %v", err)
 	}
@@ -127,7 +135,7 @@ func TestCopyAndroidArtifacts_NoApks(t *testing.T) {
 	artifactsPath := t.TempDir()
 	testPath := t.TempDir()
 	appPath := t.TempDir()
-	err := CopyAndroidArtifacts(artifactsPath, testPath, appPath)
+	err := CopyAndroidArtifacts(artifactsPath, testPath, appPath, nil)
 	if err != nil {
 		t.Errorf("expected nil when no APKs found, got %v", err)
 	}
@@ -137,6 +145,7 @@ func TestCopyAndroidArtifacts_Success(t *testing.T) {
 	setupEnvExporterStub(t)
 	t.Setenv(build_constants.Platform, build_constants.PlatformAndroid)
 	t.Setenv("BUILD_TYPE", "debug")
+	stubPairedManifests(t, "app-debug.apk", "app-debug-androidTest.apk")
 	testDir := t.TempDir()
 	appDir := t.TempDir()
 	testApk := filepath.Join(testDir, "app-debug-androidTest.apk")
@@ -148,7 +157,7 @@ func TestCopyAndroidArtifacts_Success(t *testing.T) {
 		t.Fatalf("failed to create app apk: %v", err)
 	}
 	artifactsPath := t.TempDir()
-	err := CopyAndroidArtifacts(artifactsPath, testDir, appDir)
+	err := CopyAndroidArtifacts(artifactsPath, testDir, appDir, nil)
 	if err != nil {
 		t.Fatalf("expected success, got %v", err)
 	}
@@ -174,6 +183,9 @@ func TestCopyAndroidArtifactsFromEnv_Release(t *testing.T) {
 	setupEnvExporterStub(t)
 	t.Setenv(build_constants.Platform, build_constants.PlatformAndroid)
 	t.Setenv("TEST_BUILD_TYPE", "release")
+	t.Setenv(build_constants.ArtifactsDir, "")
+	t.Setenv(build_constants.BitriseDeployDir, "")
+	stubPairedManifests(t, "app-release.apk", "app-release-androidTest.apk")
 	workDir := t.TempDir()
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -203,13 +215,13 @@ func TestCopyAndroidArtifactsFromEnv_Release(t *testing.T) {
 	}
 
 	// WHEN exporting using env-derived paths
-	err = CopyAndroidArtifactsFromEnv()
+	err = CopyAndroidArtifactsFromEnv(nil)
 
 	// THEN it succeeds and copies artifacts
 	if err != nil {
 		t.Fatalf("expected success, got %v", err)
 	}
-	entries, err := os.ReadDir(AndroidArtifactsPath)
+	entries, err := os.ReadDir(filepath.Join(export_artifacts_utils.DefaultArtifactsFolder, AndroidArtifactsFolder))
 	if err != nil {
 		t.Fatalf("read artifacts dir: %v", err)
 	}
@@ -217,3 +229,184 @@ func TestCopyAndroidArtifactsFromEnv_Release(t *testing.T) {
 		t.Fatalf("expected 2 artifacts, got %d", len(entries))
 	}
 }
+
+func stubApkManifests(t *testing.T, manifests map[string]*app_metadata.AndroidManifest) {
+	original := readApkManifest
+	readApkManifest = func(apkPath string) (*app_metadata.AndroidManifest, error) {
+		if manifest, ok := manifests[filepath.Base(apkPath)]; ok {
+			return manifest, nil
+		}
+		return nil, errors.New("no manifest")
+	}
+	t.Cleanup(func() {
+		readApkManifest = original
+	})
+}
+
+// stubPairedManifests decodes appApk and testApk as an app and the instrumentation APK targeting it.
+func stubPairedManifests(t *testing.T, appApk, testApk string) {
+	stubApkManifests(t, map[string]*app_metadata.AndroidManifest{
+		appApk:  {Package: "com.example.app"},
+		testApk: {Package: "com.example.app.test", InstrumentationTarget: "com.example.app"},
+	})
+}
+
+func TestCopyAndroidArtifacts_ExportsMetadata(t *testing.T) {
+	// GIVEN app and test APKs with decodable manifests
+	stub := setupEnvExporterStub(t)
+	t.Setenv(build_constants.Platform, build_constants.PlatformAndroid)
+	stubApkManifests(t, map[string]*app_metadata.AndroidManifest{
+		"app-debug.apk": {Package: "com.example.app", VersionName: "1.4.0", VersionCode: "42"},
+		"app-debug-androidTest.apk": {
+			Package:               "com.example.app.test",
+			InstrumentationRunner: "pl.leancode.patrol.PatrolJUnitRunner",
+			InstrumentationTarget: "com.example.app",
+		},
+	})
+	testDir := t.TempDir()
+	appDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(testDir, "app-debug-androidTest.apk"), []byte("test"), 0644); err != nil {
+		t.Fatalf("failed to create test apk: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(appDir, "app-debug.apk"), []byte("app"), 0644); err != nil {
+		t.Fatalf("failed to create app apk: %v", err)
+	}
+
+	// WHEN exporting the artifacts
+	err := CopyAndroidArtifacts(t.TempDir(), testDir, appDir, nil)
+
+	// THEN the manifest values are exported next to the paths
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	expected := map[string]string{
+		AppPackageEnvKey:            "com.example.app",
+		AppVersionNameEnvKey:        "1.4.0",
+		AppVersionCodeEnvKey:        "42",
+		TestPackageEnvKey:           "com.example.app.test",
+		InstrumentationRunnerEnvKey: "pl.leancode.patrol.PatrolJUnitRunner",
+	}
+	for key, value := range expected {
+		if stub.exported[key] != value {
+			t.Errorf("expected %s=%s, got %q", key, value, stub.exported[key])
+		}
+	}
+}
+
+func TestCopyAndroidArtifacts_NamingTemplate(t *testing.T) {
+	// GIVEN a naming template without a role placeholder
+	stub := setupEnvExporterStub(t)
+	t.Setenv(build_constants.Platform, build_constants.PlatformAndroid)
+	export_artifacts_utils.SetNaming(export_artifacts_utils.Naming{
+		Template:  "{app}-{platform}-{buildType}-{flavor}-{commit}.apk",
+		App:       "my_app",
+		BuildType: "debug",
+		Commit:    "abc1234",
+	})
+	t.Cleanup(func() {
+		export_artifacts_utils.SetNaming(export_artifacts_utils.Naming{})
+	})
+	stubPairedManifests(t, "app-debug.apk", "app-debug-androidTest.apk")
+	testDir := t.TempDir()
+	appDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(testDir, "app-debug-androidTest.apk"), []byte("test"), 0644); err != nil {
+		t.Fatalf("failed to create test apk: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(appDir, "app-debug.apk"), []byte("app"), 0644); err != nil {
+		t.Fatalf("failed to create app apk: %v", err)
+	}
+	artifactsDir := t.TempDir()
+
+	// WHEN exporting the artifacts
+	err := CopyAndroidArtifacts(artifactsDir, testDir, appDir, nil)
+
+	// THEN the copies are renamed and the outputs point at them
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	expected := map[string]string{
+		ApkPathEnvKey:             filepath.Join(artifactsDir, "my_app-android-debug-abc1234.apk"),
+		InstrumentationPathEnvKey: filepath.Join(artifactsDir, "my_app-android-debug-abc1234-test.apk"),
+	}
+	for key, path := range expected {
+		if stub.exported[key] != path {
+			t.Errorf("expected %s=%s, got %q", key, path, stub.exported[key])
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to exist: %v", path, err)
+		}
+	}
+}
+
+func TestCopyAndroidArtifacts_UnverifiedPairingFails(t *testing.T) {
+	tests := []struct {
+		name     string
+		testApk  bool
+		manifest map[string]*app_metadata.AndroidManifest
+	}{
+		{name: "unreadable manifest", testApk: true, manifest: map[string]*app_metadata.AndroidManifest{
+			"app-debug.apk": {Package: "com.example.app"},
+		}},
+		{name: "missing instrumentation APK", manifest: map[string]*app_metadata.AndroidManifest{
+			"app-debug.apk": {Package: "com.example.app"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN APKs whose pairing cannot be read
+			stub := setupEnvExporterStub(t)
+			t.Setenv(build_constants.Platform, build_constants.PlatformAndroid)
+			stubApkManifests(t, tt.manifest)
+			testDir := t.TempDir()
+			appDir := t.TempDir()
+			if tt.testApk {
+				if err := os.WriteFile(filepath.Join(testDir, "app-debug-androidTest.apk"), []byte("test"), 0644); err != nil {
+					t.Fatalf("failed to create test apk: %v", err)
+				}
+			}
+			if err := os.WriteFile(filepath.Join(appDir, "app-debug.apk"), []byte("app"), 0644); err != nil {
+				t.Fatalf("failed to create app apk: %v", err)
+			}
+
+			// WHEN exporting the artifacts
+			err := CopyAndroidArtifacts(t.TempDir(), testDir, appDir, nil)
+
+			// THEN the export fails before anything is published
+			if !errors.Is(err, artifact_pairing.ErrPairingUnverified) {
+				t.Fatalf("expected ErrPairingUnverified, got %v", err)
+			}
+			if len(stub.exported) != 0 {
+				t.Fatalf("expected no exports, got %v", stub.exported)
+			}
+		})
+	}
+}
+
+func TestCopyAndroidArtifacts_MismatchedPairFails(t *testing.T) {
+	// GIVEN an instrumentation APK targeting a different app
+	stub := setupEnvExporterStub(t)
+	t.Setenv(build_constants.Platform, build_constants.PlatformAndroid)
+	stubApkManifests(t, map[string]*app_metadata.AndroidManifest{
+		"app-debug.apk":             {Package: "com.example.app"},
+		"app-debug-androidTest.apk": {Package: "com.stale.app.test", InstrumentationTarget: "com.stale.app"},
+	})
+	testDir := t.TempDir()
+	appDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(testDir, "app-debug-androidTest.apk"), []byte("test"), 0644); err != nil {
+		t.Fatalf("failed to create test apk: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(appDir, "app-debug.apk"), []byte("app"), 0644); err != nil {
+		t.Fatalf("failed to create app apk: %v", err)
+	}
+
+	// WHEN exporting the artifacts
+	err := CopyAndroidArtifacts(t.TempDir(), testDir, appDir, nil)
+
+	// THEN the export fails before anything is published
+	if !errors.Is(err, artifact_pairing.ErrArtifactsMismatch) {
+		t.Fatalf("expected ErrArtifactsMismatch, got %v", err)
+	}
+	if len(stub.exported) != 0 {
+		t.Fatalf("expected no exports, got %v", stub.exported)
+	}
+}
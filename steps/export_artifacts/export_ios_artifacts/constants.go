@@ -1,11 +1,15 @@
 package export_ios_artifacts
 
 const (
-	IOSArtifactsPath             = "patrol/ios"
+	IOSArtifactsFolder           = "ios"
 	IOSAppUnderTestPathEnvKey    = "IOS_APP_UNDER_TEST"
 	IOSTestInstrumentationEnvKey = "IOS_TEST_INSTRUMENTATION_APP"
 	IOSRunnerFilePathEnvKey      = "IOS_RUNNER_FILE"
 	IOSBuildExportsZipPathEnvKey = "IOS_BUILD_EXPORTS"
+	IOSAppBundleIDEnvKey         = "IOS_APP_BUNDLE_ID"
+	IOSAppVersionEnvKey          = "IOS_APP_VERSION"
+	IOSAppBuildNumberEnvKey      = "IOS_APP_BUILD_NUMBER"
+	IOSTestRunnerBundleIDEnvKey  = "IOS_TEST_RUNNER_BUNDLE_ID"
 
 	IOSBuildProductsPath    = "build/ios_integ/Build/Products"
 	IOSReleaseBuildDirName  = "Release-iphoneos"
@@ -22,6 +22,10 @@ func TestIOSOutputKeysMatchStepYml(t *testing.T) {
 		IOSTestInstrumentationEnvKey,
 		IOSRunnerFilePathEnvKey,
 		IOSBuildExportsZipPathEnvKey,
+		IOSAppBundleIDEnvKey,
+		IOSAppVersionEnvKey,
+		IOSAppBuildNumberEnvKey,
+		IOSTestRunnerBundleIDEnvKey,
 	}
 
 	// THEN each key exists in step.yml outputs
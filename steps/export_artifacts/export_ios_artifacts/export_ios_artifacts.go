@@ -4,10 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	build_constants "patrol_install/steps/build/constants"
+	app_metadata "patrol_install/steps/export_artifacts/app_metadata"
+	artifact_manifest "patrol_install/steps/export_artifacts/artifact_manifest"
+	artifact_pairing "patrol_install/steps/export_artifacts/artifact_pairing"
 	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
 	print "patrol_install/utils/print"
 )
@@ -18,6 +23,10 @@ type zipFilesFunc func(zipPath string, inputPaths []string, executor export_arti
 
 var zipFiles zipFilesFunc = export_artifacts_utils.ZipFiles
 
+var readBundleInfo = app_metadata.ReadBundleInfo
+
+var readXCTestRunTargets = app_metadata.ReadXCTestRunTargets
+
 func setZipFiles(fn zipFilesFunc) {
 	if fn == nil {
 		zipFiles = export_artifacts_utils.ZipFiles
@@ -27,7 +36,8 @@ func setZipFiles(fn zipFilesFunc) {
 }
 
 // CopyIOSArtifacts exports iOS build artifacts into the artifacts folder and via envman.
-func CopyIOSArtifacts(artifactsPath string) error {
+// The copies are recorded in manifest unless it is nil.
+func CopyIOSArtifacts(artifactsPath string, manifest *artifact_manifest.Manifest) error {
 	platform := os.Getenv(build_constants.Platform)
 	if platform != build_constants.PlatformIOS && platform != build_constants.PlatformBoth {
 		print.Action("No iOS builds were selected to build")
@@ -35,7 +45,7 @@ func CopyIOSArtifacts(artifactsPath string) error {
 	}
 
 	buildType := os.Getenv(build_constants.BuildType)
-	buildDirName, err := resolveBuildDirName(buildType)
+	buildDirName, err := resolveBuildDirName(buildType, os.Getenv(build_constants.Flavor))
 	if err != nil {
 		return err
 	}
@@ -56,15 +66,39 @@ func CopyIOSArtifacts(artifactsPath string) error {
 	if err != nil {
 		return err
 	}
-	selectedXCTestRun := xctestrunFiles[0]
+	selectedXCTestRun, targets, readErr := selectXCTestRun(xctestrunFiles, buildDirName)
+
+	if err := export_artifacts_utils.RejectStaleArtifacts([]string{appUnderTest, testInstrumentation, selectedXCTestRun}); err != nil {
+		return err
+	}
+
+	appInfo, appErr := readInfo(appUnderTest)
+	runnerInfo, runnerErr := readInfo(testInstrumentation)
+	report := artifact_pairing.CheckIOS(artifact_pairing.IOSArtifacts{
+		BuildDirName:  buildDirName,
+		AppName:       IOSAppUnderTestName,
+		RunnerName:    IOSTestInstrumentation,
+		App:           appInfo,
+		Runner:        runnerInfo,
+		XCTestRunFile: selectedXCTestRun,
+		XCTestTargets: targets,
+		ReadErr:       errors.Join(readErr, appErr, runnerErr),
+	})
+	if err := report.Err(); err != nil {
+		print.Error(err.Error())
+		return err
+	}
 
 	if err := export_artifacts_utils.CreateFolder(artifactsPath); err != nil {
 		return err
 	}
 
-	artifactFiles := []string{appUnderTest, testInstrumentation, selectedXCTestRun}
-	artifactKeys := []string{IOSAppUnderTestPathEnvKey, IOSTestInstrumentationEnvKey, IOSRunnerFilePathEnvKey}
-	if err := export_artifacts_utils.CopyFilesToFolder(artifactFiles, artifactsPath, artifactKeys); err != nil {
+	artifacts := []export_artifacts_utils.Artifact{
+		iosArtifact(appUnderTest, IOSAppUnderTestPathEnvKey, export_artifacts_utils.RoleAppUnderTest),
+		iosArtifact(testInstrumentation, IOSTestInstrumentationEnvKey, export_artifacts_utils.RoleInstrumentation),
+		iosArtifact(selectedXCTestRun, IOSRunnerFilePathEnvKey, export_artifacts_utils.RoleXCTestRun),
+	}
+	if err := export_artifacts_utils.CopyArtifactsToFolder(artifacts, artifactsPath, manifest); err != nil {
 		return err
 	}
 
@@ -75,33 +109,98 @@ func CopyIOSArtifacts(artifactsPath string) error {
 		return err
 	}
 
-	if err := export_artifacts_utils.CopyFilesToFolder([]string{zipPath}, artifactsPath, []string{IOSBuildExportsZipPathEnvKey}); err != nil {
+	zipArtifact := iosArtifact(zipPath, IOSBuildExportsZipPathEnvKey, export_artifacts_utils.RoleBundle)
+	if err := export_artifacts_utils.CopyArtifactsToFolder([]export_artifacts_utils.Artifact{zipArtifact}, artifactsPath, manifest); err != nil {
 		return err
 	}
 
-	return nil
+	return exportIOSMetadata(appInfo, runnerInfo)
+}
+
+func iosArtifact(path, envKey, role string) export_artifacts_utils.Artifact {
+	return export_artifacts_utils.Artifact{Path: path, EnvKey: envKey, Platform: build_constants.PlatformIOS, Role: role}
+}
+
+// readInfo decodes the Info.plist of appPath.
+func readInfo(appPath string) (*app_metadata.BundleInfo, error) {
+	info, err := readBundleInfo(appPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read metadata from %s: %w", appPath, err)
+	}
+	return info, nil
 }
 
-func resolveBuildDirName(buildType string) (string, error) {
+// selectXCTestRun returns the first of files whose UI test targets run the app of buildDirName, with
+// those targets: the products folder keeps the xctestrun of every SDK built. When none does, the
+// first file is returned with its targets, or the error met reading it, for the pairing check to report.
+func selectXCTestRun(files []string, buildDirName string) (string, []app_metadata.XCTestRunTarget, error) {
+	var firstTargets []app_metadata.XCTestRunTarget
+	var firstErr error
+	for i, file := range files {
+		targets, err := readXCTestRunTargets(file)
+		if i == 0 {
+			firstTargets, firstErr = targets, err
+		}
+		if err != nil {
+			continue
+		}
+		for _, target := range targets {
+			if target.UITargetAppPath != "" && path.Base(path.Dir(target.UITargetAppPath)) == buildDirName {
+				return file, targets, nil
+			}
+		}
+	}
+	return files[0], firstTargets, firstErr
+}
+
+// exportIOSMetadata exports the identifiers and versions of the decoded bundles.
+func exportIOSMetadata(appInfo, runnerInfo *app_metadata.BundleInfo) error {
+	values := make([]string, 0, 4)
+	keys := make([]string, 0, 4)
+
+	if appInfo != nil {
+		values = append(values, appInfo.BundleIdentifier, appInfo.ShortVersion, appInfo.BundleVersion)
+		keys = append(keys, IOSAppBundleIDEnvKey, IOSAppVersionEnvKey, IOSAppBuildNumberEnvKey)
+	}
+	if runnerInfo != nil {
+		values = append(values, runnerInfo.BundleIdentifier)
+		keys = append(keys, IOSTestRunnerBundleIDEnvKey)
+	}
+
+	return export_artifacts_utils.ExportValues(values, keys)
+}
+
+func resolveBuildDirName(buildType, flavor string) (string, error) {
 	switch buildType {
 	case "release":
-		if _, err := os.Stat(filepath.Join(IOSBuildProductsPath, "Release-iphonesimulator")); err == nil {
+		if _, err := os.Stat(filepath.Join(IOSBuildProductsPath, flavoredDirName("Release-iphonesimulator", flavor))); err == nil {
 			return "", errInvalidBuildFlags
 		}
-		return IOSReleaseBuildDirName, nil
+		return flavoredDirName(IOSReleaseBuildDirName, flavor), nil
 	case "debug":
-		if _, err := os.Stat(filepath.Join(IOSBuildProductsPath, IOSDebugBuildDirName)); err != nil {
+		debugDirName := flavoredDirName(IOSDebugBuildDirName, flavor)
+		if _, err := os.Stat(filepath.Join(IOSBuildProductsPath, debugDirName)); err != nil {
 			if os.IsNotExist(err) {
 				return "", errInvalidBuildFlags
 			}
 			return "", err
 		}
-		return IOSDebugBuildDirName, nil
+		return debugDirName, nil
 	default:
 		return "", fmt.Errorf("unsupported build type: %s", buildType)
 	}
 }
 
+// flavoredDirName inserts flavor into a Products folder name: Xcode builds the Release-staging
+// configuration of a flavored app into Release-staging-iphoneos.
+func flavoredDirName(dirName, flavor string) string {
+	if flavor == "" {
+		return dirName
+	}
+	configuration, sdk, _ := strings.Cut(dirName, "-")
+	return configuration + "-" + flavor + "-" + sdk
+}
+
 func findRequiredApp(buildDir, appName string) (string, error) {
 	appPath := filepath.Join(buildDir, appName)
 	info, err := os.Stat(appPath)
@@ -126,3 +225,27 @@ func findXCTestRunFiles(buildProductsPath string) ([]string, error) {
 	sort.Strings(matches)
 	return matches, nil
 }
+
+// MetadataEnvKeys lists the outputs read from the Info.plist of the exported bundles.
+var MetadataEnvKeys = []string{IOSAppBundleIDEnvKey, IOSAppVersionEnvKey, IOSAppBuildNumberEnvKey, IOSTestRunnerBundleIDEnvKey}
+
+// PlanIOSArtifacts returns the bundles a build of buildType and flavor is expected to produce, without
+// looking at the disk. The xctestrun is named by its glob pattern since its name depends on the SDK.
+func PlanIOSArtifacts(buildType, flavor string) ([]export_artifacts_utils.Artifact, error) {
+	var buildDirName string
+	switch buildType {
+	case "release":
+		buildDirName = IOSReleaseBuildDirName
+	case "debug":
+		buildDirName = IOSDebugBuildDirName
+	default:
+		return nil, fmt.Errorf("unsupported build type: %s", buildType)
+	}
+	buildDir := filepath.Join(IOSBuildProductsPath, flavoredDirName(buildDirName, flavor))
+	return []export_artifacts_utils.Artifact{
+		iosArtifact(filepath.Join(buildDir, IOSAppUnderTestName), IOSAppUnderTestPathEnvKey, export_artifacts_utils.RoleAppUnderTest),
+		iosArtifact(filepath.Join(buildDir, IOSTestInstrumentation), IOSTestInstrumentationEnvKey, export_artifacts_utils.RoleInstrumentation),
+		iosArtifact(filepath.Join(IOSBuildProductsPath, IOSXCTestRunGlobPattern), IOSRunnerFilePathEnvKey, export_artifacts_utils.RoleXCTestRun),
+		iosArtifact(filepath.Join(IOSBuildProductsPath, IOSExportsZipName), IOSBuildExportsZipPathEnvKey, export_artifacts_utils.RoleBundle),
+	}, nil
+}
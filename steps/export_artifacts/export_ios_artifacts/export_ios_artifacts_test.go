@@ -5,9 +5,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"howett.net/plist"
 
 	build_constants "patrol_install/steps/build/constants"
+	build_record "patrol_install/steps/build/models/build_record"
+	artifact_pairing "patrol_install/steps/export_artifacts/artifact_pairing"
 	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
 )
 
@@ -98,15 +104,13 @@ func createAppBundle(t *testing.T, buildDir, appName string) string {
 	if err := os.WriteFile(filepath.Join(appDir, "dummy.txt"), []byte("data"), 0644); err != nil {
 		t.Fatalf("write dummy file: %v", err)
 	}
+	writeInfoPlist(t, appDir, map[string]string{"CFBundleIdentifier": "com.example." + strings.TrimSuffix(appName, ".app")})
 	return appDir
 }
 
-func createXCTestRun(t *testing.T, buildProductsPath, name string) string {
-	path := filepath.Join(buildProductsPath, name)
-	if err := os.WriteFile(path, []byte("run"), 0644); err != nil {
-		t.Fatalf("write xctestrun: %v", err)
-	}
-	return path
+// createXCTestRun writes an xctestrun running the bundles of buildDirName.
+func createXCTestRun(t *testing.T, buildProductsPath, name, buildDirName string) string {
+	return writeXCTestRunPlist(t, buildProductsPath, name, buildDirName)
 }
 
 func assertExportedPath(t *testing.T, exported map[string]string, key, expectedPath string) {
@@ -129,7 +133,7 @@ func TestCopyIOSArtifacts_ReleaseSuccess(t *testing.T) {
 	buildProductsPath, buildDir := createBuildProducts(t, workDir, IOSReleaseBuildDirName)
 	createAppBundle(t, buildDir, IOSAppUnderTestName)
 	createAppBundle(t, buildDir, IOSTestInstrumentation)
-	xctestrun := createXCTestRun(t, buildProductsPath, "Runner_1.xctestrun")
+	xctestrun := createXCTestRun(t, buildProductsPath, "Runner_1.xctestrun", IOSReleaseBuildDirName)
 	artifactsPath := t.TempDir()
 	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
 	t.Setenv(build_constants.BuildType, "release")
@@ -137,7 +141,7 @@ func TestCopyIOSArtifacts_ReleaseSuccess(t *testing.T) {
 	zipStub := setupZipRunnerStub(t, nil)
 
 	// WHEN exporting iOS artifacts
-	err := CopyIOSArtifacts(artifactsPath)
+	err := CopyIOSArtifacts(artifactsPath, nil)
 
 	// THEN artifacts and zip are copied and exported
 	if err != nil {
@@ -178,7 +182,7 @@ func TestCopyIOSArtifacts_DebugSimulatorSuccess(t *testing.T) {
 	buildProductsPath, buildDir := createBuildProducts(t, workDir, IOSDebugBuildDirName)
 	createAppBundle(t, buildDir, IOSAppUnderTestName)
 	createAppBundle(t, buildDir, IOSTestInstrumentation)
-	createXCTestRun(t, buildProductsPath, "Runner_2.xctestrun")
+	createXCTestRun(t, buildProductsPath, "Runner_2.xctestrun", IOSDebugBuildDirName)
 	artifactsPath := t.TempDir()
 	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
 	t.Setenv(build_constants.BuildType, "debug")
@@ -186,7 +190,7 @@ func TestCopyIOSArtifacts_DebugSimulatorSuccess(t *testing.T) {
 	zipStub := setupZipRunnerStub(t, nil)
 
 	// WHEN exporting iOS artifacts
-	err := CopyIOSArtifacts(artifactsPath)
+	err := CopyIOSArtifacts(artifactsPath, nil)
 
 	// THEN artifacts and zip are copied and exported
 	if err != nil {
@@ -203,12 +207,36 @@ func TestCopyIOSArtifacts_DebugSimulatorSuccess(t *testing.T) {
 	assertExportedPath(t, envStub.exported, IOSBuildExportsZipPathEnvKey, expectedExportZipPath)
 }
 
+func TestCopyIOSArtifacts_FlavoredDebugBuild(t *testing.T) {
+	// GIVEN a debug simulator build of the staging flavor
+	workDir := setupWorkingDir(t)
+	buildProductsPath, buildDir := createBuildProducts(t, workDir, "Debug-staging-iphonesimulator")
+	createAppBundle(t, buildDir, IOSAppUnderTestName)
+	createAppBundle(t, buildDir, IOSTestInstrumentation)
+	createXCTestRun(t, buildProductsPath, "Runner_2.xctestrun", "Debug-staging-iphonesimulator")
+	artifactsPath := t.TempDir()
+	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
+	t.Setenv(build_constants.BuildType, "debug")
+	t.Setenv(build_constants.Flavor, "staging")
+	envStub := setupEnvExporterStub(t)
+	setupZipRunnerStub(t, nil)
+
+	// WHEN exporting iOS artifacts
+	err := CopyIOSArtifacts(artifactsPath, nil)
+
+	// THEN the bundles are taken from the flavored Products folder
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	assertExportedPath(t, envStub.exported, IOSAppUnderTestPathEnvKey, filepath.Join(artifactsPath, IOSAppUnderTestName))
+}
+
 func TestCopyIOSArtifacts_MissingArtifacts(t *testing.T) {
 	// GIVEN a build directory missing the RunnerUITests app
 	workDir := setupWorkingDir(t)
 	buildProductsPath, buildDir := createBuildProducts(t, workDir, IOSReleaseBuildDirName)
 	createAppBundle(t, buildDir, IOSAppUnderTestName)
-	createXCTestRun(t, buildProductsPath, "Runner_1.xctestrun")
+	createXCTestRun(t, buildProductsPath, "Runner_1.xctestrun", IOSReleaseBuildDirName)
 	artifactsPath := t.TempDir()
 	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
 	t.Setenv(build_constants.BuildType, "release")
@@ -216,7 +244,7 @@ func TestCopyIOSArtifacts_MissingArtifacts(t *testing.T) {
 	setupZipRunnerStub(t, nil)
 
 	// WHEN exporting iOS artifacts
-	err := CopyIOSArtifacts(artifactsPath)
+	err := CopyIOSArtifacts(artifactsPath, nil)
 
 	// THEN it fails and does not export paths
 	if err == nil {
@@ -240,7 +268,7 @@ func TestCopyIOSArtifacts_MissingXCTestRun(t *testing.T) {
 	setupZipRunnerStub(t, nil)
 
 	// WHEN exporting iOS artifacts
-	err := CopyIOSArtifacts(artifactsPath)
+	err := CopyIOSArtifacts(artifactsPath, nil)
 
 	// THEN it fails and does not export paths
 	if err == nil {
@@ -266,7 +294,7 @@ func TestCopyIOSArtifacts_DebugWithoutSimulator(t *testing.T) {
 	setupZipRunnerStub(t, nil)
 
 	// WHEN exporting iOS artifacts
-	err := CopyIOSArtifacts(artifactsPath)
+	err := CopyIOSArtifacts(artifactsPath, nil)
 
 	// THEN it fails with invalid combo
 	if err == nil || !errors.Is(err, errInvalidBuildFlags) {
@@ -289,7 +317,7 @@ func TestCopyIOSArtifacts_ReleaseWithSimulator(t *testing.T) {
 	setupZipRunnerStub(t, nil)
 
 	// WHEN exporting iOS artifacts
-	err := CopyIOSArtifacts(artifactsPath)
+	err := CopyIOSArtifacts(artifactsPath, nil)
 
 	// THEN it fails with invalid combo
 	if err == nil || !errors.Is(err, errInvalidBuildFlags) {
@@ -303,7 +331,7 @@ func TestCopyIOSArtifacts_ZipFailure(t *testing.T) {
 	buildProductsPath, buildDir := createBuildProducts(t, workDir, IOSReleaseBuildDirName)
 	createAppBundle(t, buildDir, IOSAppUnderTestName)
 	createAppBundle(t, buildDir, IOSTestInstrumentation)
-	createXCTestRun(t, buildProductsPath, "Runner_1.xctestrun")
+	createXCTestRun(t, buildProductsPath, "Runner_1.xctestrun", IOSReleaseBuildDirName)
 	artifactsPath := t.TempDir()
 	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
 	t.Setenv(build_constants.BuildType, "release")
@@ -311,7 +339,7 @@ func TestCopyIOSArtifacts_ZipFailure(t *testing.T) {
 	setupZipRunnerStub(t, fmt.Errorf("zip failed"))
 
 	// WHEN exporting iOS artifacts
-	err := CopyIOSArtifacts(artifactsPath)
+	err := CopyIOSArtifacts(artifactsPath, nil)
 
 	// THEN it fails and does not export the zip path
 	if err == nil {
@@ -322,14 +350,14 @@ func TestCopyIOSArtifacts_ZipFailure(t *testing.T) {
 	}
 }
 
-func TestCopyIOSArtifacts_SelectsFirstXCTestRun(t *testing.T) {
-	// GIVEN multiple xctestrun files
+func TestCopyIOSArtifacts_SelectsMatchingXCTestRun(t *testing.T) {
+	// GIVEN the xctestrun of a simulator build sorted before the one of the exported build
 	workDir := setupWorkingDir(t)
 	buildProductsPath, buildDir := createBuildProducts(t, workDir, IOSReleaseBuildDirName)
 	createAppBundle(t, buildDir, IOSAppUnderTestName)
 	createAppBundle(t, buildDir, IOSTestInstrumentation)
-	createXCTestRun(t, buildProductsPath, "b.xctestrun")
-	first := createXCTestRun(t, buildProductsPath, "a.xctestrun")
+	createXCTestRun(t, buildProductsPath, "a.xctestrun", IOSDebugBuildDirName)
+	matching := createXCTestRun(t, buildProductsPath, "b.xctestrun", IOSReleaseBuildDirName)
 	artifactsPath := t.TempDir()
 	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
 	t.Setenv(build_constants.BuildType, "release")
@@ -337,12 +365,186 @@ func TestCopyIOSArtifacts_SelectsFirstXCTestRun(t *testing.T) {
 	setupZipRunnerStub(t, nil)
 
 	// WHEN exporting iOS artifacts
-	err := CopyIOSArtifacts(artifactsPath)
+	err := CopyIOSArtifacts(artifactsPath, nil)
 
-	// THEN the first sorted xctestrun is exported
+	// THEN the xctestrun running the exported build is exported
 	if err != nil {
 		t.Fatalf("expected success, got %v", err)
 	}
-	expectedRunnerPath := filepath.Join(artifactsPath, filepath.Base(first))
+	expectedRunnerPath := filepath.Join(artifactsPath, filepath.Base(matching))
 	assertExportedPath(t, envStub.exported, IOSRunnerFilePathEnvKey, expectedRunnerPath)
 }
+
+func TestCopyIOSArtifacts_UnreadableInfoPlistFails(t *testing.T) {
+	// GIVEN a test runner bundle whose Info.plist cannot be decoded
+	workDir := setupWorkingDir(t)
+	buildProductsPath, buildDir := createBuildProducts(t, workDir, IOSReleaseBuildDirName)
+	createAppBundle(t, buildDir, IOSAppUnderTestName)
+	runnerDir := createAppBundle(t, buildDir, IOSTestInstrumentation)
+	if err := os.WriteFile(filepath.Join(runnerDir, "Info.plist"), []byte("not a plist"), 0644); err != nil {
+		t.Fatalf("write plist: %v", err)
+	}
+	createXCTestRun(t, buildProductsPath, "Runner_1.xctestrun", IOSReleaseBuildDirName)
+	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
+	t.Setenv(build_constants.BuildType, "release")
+	envStub := setupEnvExporterStub(t)
+	zipStub := setupZipRunnerStub(t, nil)
+
+	// WHEN exporting iOS artifacts
+	err := CopyIOSArtifacts(t.TempDir(), nil)
+
+	// THEN the export fails before anything is published
+	if !errors.Is(err, artifact_pairing.ErrPairingUnverified) {
+		t.Fatalf("expected ErrPairingUnverified, got %v", err)
+	}
+	if len(envStub.exported) != 0 || zipStub.called {
+		t.Fatalf("expected no exports and no zip, got %v", envStub.exported)
+	}
+}
+
+func writeInfoPlist(t *testing.T, appDir string, values map[string]string) {
+	data, err := plist.Marshal(values, plist.BinaryFormat)
+	if err != nil {
+		t.Fatalf("marshal plist: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(appDir, "Info.plist"), data, 0644); err != nil {
+		t.Fatalf("write plist: %v", err)
+	}
+}
+
+func TestCopyIOSArtifacts_ExportsBundleMetadata(t *testing.T) {
+	// GIVEN bundles with Info.plist files
+	workDir := setupWorkingDir(t)
+	buildProductsPath, buildDir := createBuildProducts(t, workDir, IOSReleaseBuildDirName)
+	appDir := createAppBundle(t, buildDir, IOSAppUnderTestName)
+	testAppDir := createAppBundle(t, buildDir, IOSTestInstrumentation)
+	writeInfoPlist(t, appDir, map[string]string{
+		"CFBundleIdentifier":         "com.example.app",
+		"CFBundleShortVersionString": "1.4.0",
+		"CFBundleVersion":            "42",
+	})
+	writeInfoPlist(t, testAppDir, map[string]string{
+		"CFBundleIdentifier": "com.example.app.RunnerUITests.xctrunner",
+	})
+	createXCTestRun(t, buildProductsPath, "Runner_1.xctestrun", IOSReleaseBuildDirName)
+	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
+	t.Setenv(build_constants.BuildType, "release")
+	envStub := setupEnvExporterStub(t)
+	setupZipRunnerStub(t, nil)
+
+	// WHEN exporting iOS artifacts
+	err := CopyIOSArtifacts(t.TempDir(), nil)
+
+	// THEN bundle identifiers and versions are exported
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	expected := map[string]string{
+		IOSAppBundleIDEnvKey:        "com.example.app",
+		IOSAppVersionEnvKey:         "1.4.0",
+		IOSAppBuildNumberEnvKey:     "42",
+		IOSTestRunnerBundleIDEnvKey: "com.example.app.RunnerUITests.xctrunner",
+	}
+	for key, value := range expected {
+		if envStub.exported[key] != value {
+			t.Errorf("expected %s=%s, got %q", key, value, envStub.exported[key])
+		}
+	}
+}
+
+func writeXCTestRunPlist(t *testing.T, buildProductsPath, name, buildDirName string) string {
+	data, err := plist.Marshal(map[string]any{
+		"TestConfigurations": []any{
+			map[string]any{
+				"TestTargets": []any{
+					map[string]any{
+						"BlueprintName":   "RunnerUITests",
+						"TestHostPath":    "__TESTROOT__/" + buildDirName + "/" + IOSTestInstrumentation,
+						"UITargetAppPath": "__TESTROOT__/" + buildDirName + "/" + IOSAppUnderTestName,
+					},
+				},
+			},
+		},
+	}, plist.XMLFormat)
+	if err != nil {
+		t.Fatalf("marshal xctestrun: %v", err)
+	}
+	path := filepath.Join(buildProductsPath, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("write xctestrun: %v", err)
+	}
+	return path
+}
+
+func TestCopyIOSArtifacts_PairedXCTestRun(t *testing.T) {
+	// GIVEN an xctestrun driving the exported build directory
+	workDir := setupWorkingDir(t)
+	buildProductsPath, buildDir := createBuildProducts(t, workDir, IOSReleaseBuildDirName)
+	createAppBundle(t, buildDir, IOSAppUnderTestName)
+	createAppBundle(t, buildDir, IOSTestInstrumentation)
+	writeXCTestRunPlist(t, buildProductsPath, "Runner_1.xctestrun", IOSReleaseBuildDirName)
+	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
+	t.Setenv(build_constants.BuildType, "release")
+	setupEnvExporterStub(t)
+	setupZipRunnerStub(t, nil)
+
+	// WHEN exporting iOS artifacts
+	err := CopyIOSArtifacts(t.TempDir(), nil)
+
+	// THEN the pairing check passes
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+}
+
+func TestCopyIOSArtifacts_StaleXCTestRunFails(t *testing.T) {
+	// GIVEN an xctestrun left over from a simulator build
+	workDir := setupWorkingDir(t)
+	buildProductsPath, buildDir := createBuildProducts(t, workDir, IOSReleaseBuildDirName)
+	createAppBundle(t, buildDir, IOSAppUnderTestName)
+	createAppBundle(t, buildDir, IOSTestInstrumentation)
+	writeXCTestRunPlist(t, buildProductsPath, "Runner_1.xctestrun", IOSDebugBuildDirName)
+	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
+	t.Setenv(build_constants.BuildType, "release")
+	envStub := setupEnvExporterStub(t)
+	zipStub := setupZipRunnerStub(t, nil)
+
+	// WHEN exporting iOS artifacts
+	err := CopyIOSArtifacts(t.TempDir(), nil)
+
+	// THEN the export fails before anything is published
+	if !errors.Is(err, artifact_pairing.ErrArtifactsMismatch) {
+		t.Fatalf("expected ErrArtifactsMismatch, got %v", err)
+	}
+	if len(envStub.exported) != 0 || zipStub.called {
+		t.Fatalf("expected no exports and no zip, got %v", envStub.exported)
+	}
+}
+
+func TestCopyIOSArtifacts_StaleBuildFails(t *testing.T) {
+	// GIVEN bundles the recorded build did not leave behind
+	workDir := setupWorkingDir(t)
+	buildProductsPath, buildDir := createBuildProducts(t, workDir, IOSReleaseBuildDirName)
+	createAppBundle(t, buildDir, IOSAppUnderTestName)
+	createAppBundle(t, buildDir, IOSTestInstrumentation)
+	createXCTestRun(t, buildProductsPath, "Runner_1.xctestrun", IOSReleaseBuildDirName)
+	record := &build_record.Record{StartedAt: time.Now(), FinishedAt: time.Now()}
+	if err := record.Save(filepath.Join(workDir, build_constants.BuildRecordPath)); err != nil {
+		t.Fatalf("save record: %v", err)
+	}
+	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
+	t.Setenv(build_constants.BuildType, "release")
+	envStub := setupEnvExporterStub(t)
+	setupZipRunnerStub(t, nil)
+
+	// WHEN exporting iOS artifacts
+	err := CopyIOSArtifacts(t.TempDir(), nil)
+
+	// THEN the stale artifacts are rejected before anything is published
+	if !errors.Is(err, build_record.ErrStaleArtifact) {
+		t.Fatalf("expected ErrStaleArtifact, got %v", err)
+	}
+	if len(envStub.exported) != 0 {
+		t.Fatalf("expected no exports, got %v", envStub.exported)
+	}
+}
@@ -0,0 +1,104 @@
+package export_artifacts
+
+import (
+	"os"
+	"path/filepath"
+
+	build_constants "patrol_install/steps/build/constants"
+	artifact_manifest "patrol_install/steps/export_artifacts/artifact_manifest"
+	export_android_artifacts "patrol_install/steps/export_artifacts/export_android_artifacts"
+	export_ios_artifacts "patrol_install/steps/export_artifacts/export_ios_artifacts"
+	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
+	"patrol_install/steps/test_discovery"
+	"patrol_install/steps/test_sharding"
+)
+
+// PlannedArtifact is an artifact the export is expected to copy.
+type PlannedArtifact struct {
+	export_artifacts_utils.Artifact
+	Destination string
+}
+
+// PlannedOutput is an env output the export is expected to publish, under the key including the
+// output suffix of the current build matrix configuration. Value is empty when it is only known
+// once the artifacts exist.
+type PlannedOutput struct {
+	Key   string
+	Value string
+}
+
+// ExportPlan describes what FindAndExport would copy and publish.
+type ExportPlan struct {
+	Exporter  string
+	Artifacts []PlannedArtifact
+	Outputs   []PlannedOutput
+
+	naming export_artifacts_utils.Naming
+}
+
+// Plan validates the export inputs and returns the expected artifacts and outputs without applying
+// the inputs or touching the build outputs or the artifacts folder.
+func (p *ExporterRunner) Plan() (*ExportPlan, error) {
+	settings, err := settingsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	plan := &ExportPlan{Exporter: export_artifacts_utils.ExporterNameFromEnv(), naming: settings.naming}
+	buildType := os.Getenv(build_constants.BuildType)
+	flavor := os.Getenv(build_constants.Flavor)
+
+	platform := os.Getenv(build_constants.Platform)
+	if platform == build_constants.PlatformAndroid || platform == build_constants.PlatformBoth {
+		artifacts := export_android_artifacts.PlanAndroidArtifacts(buildType, flavor)
+		folder := export_artifacts_utils.ArtifactsFolderFromEnv(export_android_artifacts.AndroidArtifactsFolder)
+		if err := plan.add(artifacts, folder, export_android_artifacts.MetadataEnvKeys); err != nil {
+			return nil, err
+		}
+	}
+	if platform == build_constants.PlatformIOS || platform == build_constants.PlatformBoth {
+		artifacts, err := export_ios_artifacts.PlanIOSArtifacts(buildType, flavor)
+		if err != nil {
+			return nil, err
+		}
+		folder := export_artifacts_utils.ArtifactsFolderFromEnv(export_ios_artifacts.IOSArtifactsFolder)
+		if err := plan.add(artifacts, folder, export_ios_artifacts.MetadataEnvKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(plan.Artifacts) > 0 {
+		manifestPath := filepath.Join(export_artifacts_utils.ArtifactsRootFromEnv(), artifact_manifest.FileName)
+		plan.Outputs = append(plan.Outputs, PlannedOutput{Key: export_artifacts_utils.OutputKey(ManifestPathEnvKey), Value: manifestPath})
+	}
+	if inventory, err := discoverInventory(); err == nil {
+		root := export_artifacts_utils.ArtifactsRootFromEnv()
+		plan.Outputs = append(plan.Outputs, PlannedOutput{Key: export_artifacts_utils.OutputKey(TestInventoryEnvKey), Value: filepath.Join(root, test_discovery.InventoryFileName)})
+		shards, err := planShards(inventory)
+		if err != nil {
+			return nil, err
+		}
+		if shards != nil {
+			values, keys := shardOutputs(shards, filepath.Join(root, test_sharding.PlanFileName))
+			for i, key := range keys {
+				plan.Outputs = append(plan.Outputs, PlannedOutput{Key: export_artifacts_utils.OutputKey(key), Value: values[i]})
+			}
+		}
+	}
+	plan.Outputs = append(plan.Outputs, PlannedOutput{Key: export_artifacts_utils.OutputKey(ExportStatusEnvKey), Value: ExportStatusComplete})
+	return plan, nil
+}
+
+func (e *ExportPlan) add(artifacts []export_artifacts_utils.Artifact, folder string, metadataKeys []string) error {
+	destinations, err := e.naming.Destinations(artifacts, folder)
+	if err != nil {
+		return err
+	}
+	for i, artifact := range artifacts {
+		e.Artifacts = append(e.Artifacts, PlannedArtifact{Artifact: artifact, Destination: destinations[i]})
+		e.Outputs = append(e.Outputs, PlannedOutput{Key: export_artifacts_utils.OutputKey(artifact.EnvKey), Value: destinations[i]})
+	}
+	for _, key := range metadataKeys {
+		e.Outputs = append(e.Outputs, PlannedOutput{Key: export_artifacts_utils.OutputKey(key)})
+	}
+	return nil
+}
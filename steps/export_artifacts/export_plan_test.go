@@ -0,0 +1,128 @@
+package export_artifacts
+
+import (
+	"path/filepath"
+	"testing"
+
+	build_constants "patrol_install/steps/build/constants"
+	export_android_artifacts "patrol_install/steps/export_artifacts/export_android_artifacts"
+	export_ios_artifacts "patrol_install/steps/export_artifacts/export_ios_artifacts"
+	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
+	"patrol_install/steps/test_discovery"
+)
+
+func TestPlan_BothPlatforms(t *testing.T) {
+	// GIVEN a debug build of both platforms and a naming template
+	useJSONExporter(t)
+	root := t.TempDir()
+	t.Setenv(build_constants.Platform, build_constants.PlatformBoth)
+	t.Setenv(build_constants.BuildType, "debug")
+	t.Setenv(build_constants.ArtifactsDir, root)
+	t.Setenv(build_constants.ArtifactNameTemplate, "{platform}-{buildType}")
+	runner := &ExporterRunner{}
+
+	// WHEN planning the export
+	plan, err := runner.Plan()
+
+	// THEN every artifact gets its rendered destination and an output
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if plan.Exporter != "json" || len(plan.Artifacts) != 6 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	outputs := map[string]string{}
+	for _, output := range plan.Outputs {
+		outputs[output.Key] = output.Value
+	}
+	wantApk := filepath.Join(root, "android", "android-debug.apk")
+	if outputs[export_android_artifacts.ApkPathEnvKey] != wantApk {
+		t.Fatalf("expected %s, got %v", wantApk, outputs)
+	}
+	wantRunner := filepath.Join(root, "ios", "ios-debug-test.app")
+	if outputs[export_ios_artifacts.IOSTestInstrumentationEnvKey] != wantRunner {
+		t.Fatalf("expected %s, got %v", wantRunner, outputs)
+	}
+	if value, ok := outputs[export_ios_artifacts.IOSAppBundleIDEnvKey]; !ok || value != "" {
+		t.Fatalf("expected the bundle id to be planned without a value, got %v", outputs)
+	}
+	if outputs[ExportStatusEnvKey] != ExportStatusComplete || outputs[ManifestPathEnvKey] == "" {
+		t.Fatalf("expected status and manifest outputs, got %v", outputs)
+	}
+}
+
+func TestPlan_InvalidExportMode(t *testing.T) {
+	// GIVEN an unknown export mode
+	useJSONExporter(t)
+	t.Setenv(build_constants.Platform, build_constants.PlatformAndroid)
+	t.Setenv(build_constants.ExportMode, "lenient")
+	runner := &ExporterRunner{}
+
+	// WHEN planning the export
+	_, err := runner.Plan()
+
+	// THEN the input is rejected as a real run would
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestPlan_LeavesSettingsUntouched(t *testing.T) {
+	// GIVEN a naming template and the original names in use
+	useJSONExporter(t)
+	t.Setenv(build_constants.Platform, build_constants.PlatformAndroid)
+	t.Setenv(build_constants.ArtifactsDir, t.TempDir())
+	t.Setenv(build_constants.ArtifactNameTemplate, "{platform}-{buildType}")
+	export_artifacts_utils.SetNaming(export_artifacts_utils.Naming{})
+	runner := &ExporterRunner{}
+
+	// WHEN planning the export
+	if _, err := runner.Plan(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// THEN the copies still use the original names
+	destinations, err := export_artifacts_utils.Destinations([]export_artifacts_utils.Artifact{{Path: "build/app.apk"}}, "out")
+	if err != nil || destinations[0] != filepath.Join("out", "app.apk") {
+		t.Fatalf("expected the naming to be left untouched, got %v (%v)", destinations, err)
+	}
+}
+
+func TestPlan_ShardsLikeTheExport(t *testing.T) {
+	// GIVEN three tests in two files and more shards requested than files
+	useJSONExporter(t)
+	t.Setenv(build_constants.Platform, build_constants.PlatformAndroid)
+	t.Setenv(build_constants.ArtifactsDir, t.TempDir())
+	t.Setenv(build_constants.ShardCount, "3")
+	t.Setenv(build_constants.ShardTimingsFile, "")
+	original := discoverInventory
+	discoverInventory = func() (*test_discovery.Inventory, error) {
+		return test_discovery.NewInventory([]test_discovery.Test{
+			{Name: "logs in", File: "patrol_test/login_test.dart"},
+			{Name: "pays", File: "patrol_test/checkout_test.dart"},
+			{Name: "refunds", File: "patrol_test/checkout_test.dart"},
+		}, nil, nil), nil
+	}
+	t.Cleanup(func() { discoverInventory = original })
+
+	// WHEN planning the export
+	plan, err := (&ExporterRunner{}).Plan()
+
+	// THEN one shard per test file is planned, with the filter and targets of each
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	outputs := map[string]string{}
+	for _, output := range plan.Outputs {
+		outputs[output.Key] = output.Value
+	}
+	if outputs[ShardCountEnvKey] != "2" {
+		t.Fatalf("expected 2 shards, got %v", outputs)
+	}
+	if outputs[ShardFilterEnvKey(1)] != "^(?:pays|refunds)$" || outputs[ShardTargetsEnvKey(2)] != "patrol_test/login_test.dart" {
+		t.Fatalf("unexpected shard outputs %v", outputs)
+	}
+	if _, ok := outputs[ShardFilterEnvKey(3)]; ok {
+		t.Fatalf("expected no third shard, got %v", outputs)
+	}
+}
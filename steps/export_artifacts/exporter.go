@@ -1,12 +1,16 @@
 package export_artifacts
 
-import "patrol_install/utils/print"
+import (
+	"context"
+
+	"patrol_install/utils/print"
+)
 
 type Exporter interface {
-	FindAndExport() error
+	FindAndExport(ctx context.Context) error
 }
 
-func Run(exporter Exporter) error {
+func Run(ctx context.Context, exporter Exporter) error {
 	print.StepInitiated("--- Getting Patrol builds ---")
-	return exporter.FindAndExport()
+	return exporter.FindAndExport(ctx)
 }
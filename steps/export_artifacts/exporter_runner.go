@@ -1,46 +1,173 @@
 package export_artifacts
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	build_constants "patrol_install/steps/build/constants"
+	artifact_manifest "patrol_install/steps/export_artifacts/artifact_manifest"
 	export_android_artifacts "patrol_install/steps/export_artifacts/export_android_artifacts"
 	export_ios_artifacts "patrol_install/steps/export_artifacts/export_ios_artifacts"
+	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
+	"patrol_install/steps/test_sharding"
 	print "patrol_install/utils/print"
 )
 
-var exportAndroid = func() error {
-	return export_android_artifacts.CopyAndroidArtifactsFromEnv()
+var exportAndroid = func(manifest *artifact_manifest.Manifest) error {
+	return export_android_artifacts.CopyAndroidArtifactsFromEnv(manifest)
 }
 
-var exportIOS = func() error {
-	return export_ios_artifacts.CopyIOSArtifacts(export_ios_artifacts.IOSArtifactsPath)
+var exportIOS = func(manifest *artifact_manifest.Manifest) error {
+	return export_ios_artifacts.CopyIOSArtifacts(export_artifacts_utils.ArtifactsFolderFromEnv(export_ios_artifacts.IOSArtifactsFolder), manifest)
 }
 
 type ExporterRunner struct{}
 
-func (p *ExporterRunner) FindAndExportAndroid() error {
-	return exportAndroid()
+func (p *ExporterRunner) FindAndExportAndroid(manifest *artifact_manifest.Manifest) error {
+	return exportAndroid(manifest)
 }
 
-func (p *ExporterRunner) FindAndExportIOS() error {
-	return exportIOS()
+func (p *ExporterRunner) FindAndExportIOS(manifest *artifact_manifest.Manifest) error {
+	return exportIOS(manifest)
 }
 
 // FindAndExport runs platform-specific exports based on PLATFORM env.
-func (p *ExporterRunner) FindAndExport() error {
+// Outputs are staged while copying and only published once every export succeeded. In best-effort
+// mode a failed export does not stop the others and whatever succeeded is published as partial.
+// A cancelled run never publishes: the staged outputs are rolled back whatever the mode. When
+// publishing fails after some outputs were published, the status is published as partial.
+func (p *ExporterRunner) FindAndExport(ctx context.Context) error {
+	settings, err := settingsFromEnv()
+	if err != nil {
+		return err
+	}
+	settings.apply()
+	bestEffort := settings.bestEffort
+
+	manifest := &artifact_manifest.Manifest{}
+	export_artifacts_utils.BeginExport()
+
+	exportErr := p.exportPlatforms(ctx, bestEffort, manifest)
+	if ctx.Err() != nil {
+		dropped := export_artifacts_utils.RollbackExports()
+		print.Warning(fmt.Sprintf("Export cancelled, %d staged outputs were not published", dropped))
+		return fmt.Errorf("export cancelled: %w (%v)", ctx.Err(), context.Cause(ctx))
+	}
+	if exportErr == nil || bestEffort {
+		exportErr = errors.Join(exportErr, writeManifest(manifest), writeInventory())
+	}
+
+	status := ExportStatusComplete
+	if exportErr != nil {
+		if !bestEffort {
+			dropped := export_artifacts_utils.RollbackExports()
+			print.Error(fmt.Sprintf("Export failed, %d staged outputs were not published", dropped))
+			return exportErr
+		}
+		status = ExportStatusPartial
+		print.Warning(fmt.Sprintf("Export finished partially, publishing the outputs that succeeded:\n%v", exportErr))
+	}
+	if err := export_artifacts_utils.ExportValues([]string{status}, []string{ExportStatusEnvKey}); err != nil {
+		return err
+	}
+	if err := export_artifacts_utils.CommitExports(); err != nil {
+		if errors.Is(err, export_artifacts_utils.ErrPartiallyPublished) {
+			print.Warning("Some outputs were published before the failure, reporting the export as partial")
+			err = errors.Join(err, export_artifacts_utils.ExportValues([]string{ExportStatusPartial}, []string{ExportStatusEnvKey}))
+		}
+		return err
+	}
+	return nil
+}
+
+// exportSettings are the export inputs, validated but not yet in use.
+type exportSettings struct {
+	bestEffort bool
+	policy     export_artifacts_utils.SymlinkPolicy
+	hardlinks  bool
+	naming     export_artifacts_utils.Naming
+	exporter   export_artifacts_utils.EnvExporter
+}
+
+// settingsFromEnv reads and validates the export inputs without changing what the copies and exports use.
+func settingsFromEnv() (exportSettings, error) {
+	bestEffort, err := parseExportMode(os.Getenv(build_constants.ExportMode))
+	if err != nil {
+		return exportSettings{}, err
+	}
+	policy, err := export_artifacts_utils.ParseSymlinkPolicy(os.Getenv(build_constants.SymlinkPolicy))
+	if err != nil {
+		return exportSettings{}, err
+	}
+	hardlinks, err := export_artifacts_utils.HardlinksFromEnv()
+	if err != nil {
+		return exportSettings{}, err
+	}
+	naming, err := export_artifacts_utils.NamingFromEnv()
+	if err != nil {
+		return exportSettings{}, err
+	}
+	exporter, err := export_artifacts_utils.EnvExporterFromEnv()
+	if err != nil {
+		return exportSettings{}, err
+	}
+	if _, err := test_sharding.SettingsFromEnv(); err != nil {
+		return exportSettings{}, err
+	}
+	return exportSettings{bestEffort: bestEffort, policy: policy, hardlinks: hardlinks, naming: naming, exporter: exporter}, nil
+}
+
+// apply makes the copies and exports of this run use the settings.
+func (s exportSettings) apply() {
+	export_artifacts_utils.SetSymlinkPolicy(s.policy)
+	export_artifacts_utils.SetHardlinks(s.hardlinks)
+	export_artifacts_utils.SetNaming(s.naming)
+	export_artifacts_utils.SetEnvExporter(s.exporter)
+}
+
+func (p *ExporterRunner) exportPlatforms(ctx context.Context, bestEffort bool, manifest *artifact_manifest.Manifest) error {
 	switch os.Getenv(build_constants.Platform) {
 	case build_constants.PlatformAndroid:
-		return p.FindAndExportAndroid()
+		return p.FindAndExportAndroid(manifest)
 	case build_constants.PlatformIOS:
-		return p.FindAndExportIOS()
+		return p.FindAndExportIOS(manifest)
 	case build_constants.PlatformBoth:
-		if err := p.FindAndExportAndroid(); err != nil {
-			return err
+		androidErr := p.FindAndExportAndroid(manifest)
+		if (androidErr != nil && !bestEffort) || ctx.Err() != nil {
+			return androidErr
 		}
-		return p.FindAndExportIOS()
+		return errors.Join(androidErr, p.FindAndExportIOS(manifest))
 	default:
 		print.Action("No valid platform selected for export")
 		return nil
 	}
 }
+
+func parseExportMode(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", ExportModeStrict:
+		return false, nil
+	case ExportModeBestEffort:
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid export mode %q: expected '%s' or '%s'", value, ExportModeStrict, ExportModeBestEffort)
+	}
+}
+
+// writeManifest saves the manifest of every exported artifact in the artifacts root and exports its path.
+func writeManifest(manifest *artifact_manifest.Manifest) error {
+	if len(manifest.Artifacts) == 0 {
+		return nil
+	}
+	path := filepath.Join(export_artifacts_utils.ArtifactsRootFromEnv(), artifact_manifest.FileName)
+	if err := manifest.Save(path); err != nil {
+		print.Error(fmt.Sprintf("Error writing artifact manifest %s: %v", path, err))
+		return err
+	}
+	print.Success(fmt.Sprintf("Artifact manifest with %d entries written to %s", len(manifest.Artifacts), path))
+	return export_artifacts_utils.ExportValues([]string{path}, []string{ManifestPathEnvKey})
+}
@@ -1,10 +1,16 @@
 package export_artifacts
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	build_constants "patrol_install/steps/build/constants"
+	artifact_manifest "patrol_install/steps/export_artifacts/artifact_manifest"
+	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
 )
 
 type exportCallState struct {
@@ -12,16 +18,42 @@ type exportCallState struct {
 	iosCalled     bool
 }
 
+// useJSONExporter routes outputs to a JSON file so runs do not depend on the CI the tests run on.
+func useJSONExporter(t *testing.T) string {
+	outputFile := filepath.Join(t.TempDir(), "outputs.json")
+	t.Setenv(build_constants.OutputExporter, export_artifacts_utils.ExporterJSON)
+	t.Setenv(build_constants.OutputFile, outputFile)
+	t.Cleanup(func() {
+		export_artifacts_utils.SetEnvExporter(nil)
+	})
+	return outputFile
+}
+
+func readOutputs(t *testing.T, path string) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read outputs: %v", err)
+	}
+	outputs := map[string]string{}
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		t.Fatalf("decode outputs: %v", err)
+	}
+	return outputs
+}
+
 func stubExports(t *testing.T, androidErr, iosErr error) *exportCallState {
 	state := &exportCallState{}
+	useJSONExporter(t)
 	originalAndroid := exportAndroid
 	originalIOS := exportIOS
+	t.Setenv(build_constants.TestTargetDirectory, filepath.Join(t.TempDir(), "missing"))
 
-	exportAndroid = func() error {
+	exportAndroid = func(manifest *artifact_manifest.Manifest) error {
 		state.androidCalled = true
 		return androidErr
 	}
-	exportIOS = func() error {
+	exportIOS = func(manifest *artifact_manifest.Manifest) error {
 		state.iosCalled = true
 		return iosErr
 	}
@@ -40,7 +72,7 @@ func TestFindAndExport_AndroidOnly(t *testing.T) {
 	runner := &ExporterRunner{}
 
 	// WHEN running exports
-	err := runner.FindAndExport()
+	err := runner.FindAndExport(context.Background())
 
 	// THEN only Android export runs
 	if err != nil {
@@ -58,7 +90,7 @@ func TestFindAndExport_IOSOnly(t *testing.T) {
 	runner := &ExporterRunner{}
 
 	// WHEN running exports
-	err := runner.FindAndExport()
+	err := runner.FindAndExport(context.Background())
 
 	// THEN only iOS export runs
 	if err != nil {
@@ -76,7 +108,7 @@ func TestFindAndExport_BothPlatforms(t *testing.T) {
 	runner := &ExporterRunner{}
 
 	// WHEN running exports
-	err := runner.FindAndExport()
+	err := runner.FindAndExport(context.Background())
 
 	// THEN both exports run
 	if err != nil {
@@ -94,7 +126,7 @@ func TestFindAndExport_AndroidError(t *testing.T) {
 	runner := &ExporterRunner{}
 
 	// WHEN running exports
-	err := runner.FindAndExport()
+	err := runner.FindAndExport(context.Background())
 
 	// THEN error is returned and iOS is not called
 	if err == nil {
@@ -112,7 +144,7 @@ func TestFindAndExport_IOSError(t *testing.T) {
 	runner := &ExporterRunner{}
 
 	// WHEN running exports
-	err := runner.FindAndExport()
+	err := runner.FindAndExport(context.Background())
 
 	// THEN error is returned
 	if err == nil {
@@ -122,3 +154,260 @@ func TestFindAndExport_IOSError(t *testing.T) {
 		t.Fatalf("expected ios export to run")
 	}
 }
+
+func TestFindAndExport_InvalidSymlinkPolicy(t *testing.T) {
+	// GIVEN an unknown symlink policy
+	t.Setenv(build_constants.Platform, build_constants.PlatformBoth)
+	t.Setenv(build_constants.SymlinkPolicy, "follow")
+	state := stubExports(t, nil, nil)
+	runner := &ExporterRunner{}
+
+	// WHEN running exports
+	err := runner.FindAndExport(context.Background())
+
+	// THEN it fails before exporting anything
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if state.androidCalled || state.iosCalled {
+		t.Fatalf("expected no exports, got android=%v ios=%v", state.androidCalled, state.iosCalled)
+	}
+}
+
+func TestFindAndExport_InvalidNameTemplate(t *testing.T) {
+	// GIVEN a template with an unknown placeholder
+	t.Setenv(build_constants.Platform, build_constants.PlatformBoth)
+	t.Setenv(build_constants.ArtifactNameTemplate, "{app}-{version}")
+	state := stubExports(t, nil, nil)
+	runner := &ExporterRunner{}
+
+	// WHEN running exports
+	err := runner.FindAndExport(context.Background())
+
+	// THEN it fails before exporting anything
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if state.androidCalled || state.iosCalled {
+		t.Fatalf("expected no exports, got android=%v ios=%v", state.androidCalled, state.iosCalled)
+	}
+}
+
+func TestFindAndExport_WritesManifest(t *testing.T) {
+	// GIVEN an Android export copying one APK into the artifacts dir
+	artifactsDir := t.TempDir()
+	t.Setenv(build_constants.Platform, build_constants.PlatformAndroid)
+	t.Setenv(build_constants.ArtifactsDir, artifactsDir)
+	outputFile := useJSONExporter(t)
+	apk := filepath.Join(t.TempDir(), "app-release.apk")
+	if err := os.WriteFile(apk, []byte("apk"), 0644); err != nil {
+		t.Fatalf("write apk: %v", err)
+	}
+	originalAndroid := exportAndroid
+	exportAndroid = func(manifest *artifact_manifest.Manifest) error {
+		folder := export_artifacts_utils.ArtifactsFolderFromEnv("android")
+		if err := export_artifacts_utils.CreateFolder(folder); err != nil {
+			return err
+		}
+		return export_artifacts_utils.CopyArtifactsToFolder([]export_artifacts_utils.Artifact{
+			{Path: apk, EnvKey: "ANDROID_APK_PATH", Platform: "android", Role: export_artifacts_utils.RoleAppUnderTest},
+		}, folder, manifest)
+	}
+	t.Cleanup(func() {
+		exportAndroid = originalAndroid
+	})
+	runner := &ExporterRunner{}
+
+	// WHEN running exports
+	err := runner.FindAndExport(context.Background())
+
+	// THEN the manifest lists the APK and its path is exported
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	manifestPath := filepath.Join(artifactsDir, artifact_manifest.FileName)
+	exported := readOutputs(t, outputFile)
+	if exported[ManifestPathEnvKey] != manifestPath {
+		t.Fatalf("expected %s=%s, got %q", ManifestPathEnvKey, manifestPath, exported[ManifestPathEnvKey])
+	}
+	manifest, err := artifact_manifest.Load(manifestPath)
+	if err != nil {
+		t.Fatalf("load manifest: %v", err)
+	}
+	if len(manifest.Artifacts) != 1 || manifest.Artifacts[0].Path != "android/app-release.apk" || manifest.Artifacts[0].Size != 3 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+}
+
+func TestFindAndExport_InvalidOutputExporter(t *testing.T) {
+	// GIVEN an unknown output exporter
+	state := stubExports(t, nil, nil)
+	t.Setenv(build_constants.Platform, build_constants.PlatformBoth)
+	t.Setenv(build_constants.OutputExporter, "jenkins")
+	runner := &ExporterRunner{}
+
+	// WHEN running exports
+	err := runner.FindAndExport(context.Background())
+
+	// THEN it fails before exporting anything
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if state.androidCalled || state.iosCalled {
+		t.Fatalf("expected no exports, got android=%v ios=%v", state.androidCalled, state.iosCalled)
+	}
+}
+
+func TestFindAndExport_StrictFailurePublishesNothing(t *testing.T) {
+	// GIVEN an Android export staging its output before iOS fails
+	t.Setenv(build_constants.Platform, build_constants.PlatformBoth)
+	state := stubExports(t, nil, errors.New("ios failed"))
+	outputFile := os.Getenv(build_constants.OutputFile)
+	stagedAndroid := exportAndroid
+	exportAndroid = func(manifest *artifact_manifest.Manifest) error {
+		if err := export_artifacts_utils.ExportValues([]string{"patrol/android/app.apk"}, []string{"ANDROID_APK_PATH"}); err != nil {
+			return err
+		}
+		return stagedAndroid(manifest)
+	}
+	runner := &ExporterRunner{}
+
+	// WHEN running exports
+	err := runner.FindAndExport(context.Background())
+
+	// THEN the run fails and the Android output is not published
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if !state.androidCalled || !state.iosCalled {
+		t.Fatalf("expected both exports, got android=%v ios=%v", state.androidCalled, state.iosCalled)
+	}
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Fatalf("expected no outputs to be written, got %v", err)
+	}
+}
+
+func TestFindAndExport_BestEffortPublishesPartial(t *testing.T) {
+	// GIVEN best-effort mode where Android fails and iOS stages its output
+	t.Setenv(build_constants.Platform, build_constants.PlatformBoth)
+	t.Setenv(build_constants.ExportMode, ExportModeBestEffort)
+	state := stubExports(t, errors.New("android failed"), nil)
+	outputFile := os.Getenv(build_constants.OutputFile)
+	stagedIOS := exportIOS
+	exportIOS = func(manifest *artifact_manifest.Manifest) error {
+		if err := export_artifacts_utils.ExportValues([]string{"patrol/ios/Runner.app"}, []string{"IOS_APP_UNDER_TEST"}); err != nil {
+			return err
+		}
+		return stagedIOS(manifest)
+	}
+	runner := &ExporterRunner{}
+
+	// WHEN running exports
+	err := runner.FindAndExport(context.Background())
+
+	// THEN iOS still runs and its output is published with a partial status
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !state.androidCalled || !state.iosCalled {
+		t.Fatalf("expected both exports, got android=%v ios=%v", state.androidCalled, state.iosCalled)
+	}
+	outputs := readOutputs(t, outputFile)
+	if outputs[ExportStatusEnvKey] != ExportStatusPartial || outputs["IOS_APP_UNDER_TEST"] != "patrol/ios/Runner.app" {
+		t.Fatalf("unexpected outputs %v", outputs)
+	}
+}
+
+func TestFindAndExport_InvalidExportMode(t *testing.T) {
+	// GIVEN an unknown export mode
+	state := stubExports(t, nil, nil)
+	t.Setenv(build_constants.Platform, build_constants.PlatformBoth)
+	t.Setenv(build_constants.ExportMode, "lenient")
+	runner := &ExporterRunner{}
+
+	// WHEN running exports
+	err := runner.FindAndExport(context.Background())
+
+	// THEN it fails before exporting anything
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if state.androidCalled || state.iosCalled {
+		t.Fatalf("expected no exports, got android=%v ios=%v", state.androidCalled, state.iosCalled)
+	}
+}
+
+func TestFindAndExport_CancelledPublishesNothing(t *testing.T) {
+	// GIVEN best-effort mode where the run is interrupted while Android exports
+	t.Setenv(build_constants.Platform, build_constants.PlatformBoth)
+	t.Setenv(build_constants.ExportMode, ExportModeBestEffort)
+	state := stubExports(t, nil, nil)
+	outputFile := os.Getenv(build_constants.OutputFile)
+	ctx, cancel := context.WithCancel(context.Background())
+	stagedAndroid := exportAndroid
+	exportAndroid = func(manifest *artifact_manifest.Manifest) error {
+		if err := export_artifacts_utils.ExportValues([]string{"patrol/android/app.apk"}, []string{"ANDROID_APK_PATH"}); err != nil {
+			return err
+		}
+		cancel()
+		return stagedAndroid(manifest)
+	}
+	runner := &ExporterRunner{}
+
+	// WHEN running exports
+	err := runner.FindAndExport(ctx)
+
+	// THEN iOS is skipped, the cancellation is reported and nothing is published
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation error, got %v", err)
+	}
+	if !state.androidCalled || state.iosCalled {
+		t.Fatalf("expected only android export, got android=%v ios=%v", state.androidCalled, state.iosCalled)
+	}
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Fatalf("expected no outputs to be written, got %v", err)
+	}
+}
+
+// flakyExporter publishes every value except the failAt-th one, counting from 1.
+type flakyExporter struct {
+	failAt    int
+	calls     int
+	published map[string]string
+}
+
+func (e *flakyExporter) Export(key, value string) error {
+	e.calls++
+	if e.calls == e.failAt {
+		return errors.New("envman failed")
+	}
+	e.published[key] = value
+	return nil
+}
+
+func TestFindAndExport_FailedPublishReportsPartial(t *testing.T) {
+	// GIVEN an export staging its output and an exporter failing on the second publish
+	t.Setenv(build_constants.Platform, build_constants.PlatformIOS)
+	stubExports(t, nil, nil)
+	exporter := &flakyExporter{failAt: 2, published: map[string]string{}}
+	stagedIOS := exportIOS
+	exportIOS = func(manifest *artifact_manifest.Manifest) error {
+		export_artifacts_utils.SetEnvExporter(exporter)
+		if err := export_artifacts_utils.ExportValues([]string{"patrol/ios/Runner.app"}, []string{"IOS_APP_UNDER_TEST"}); err != nil {
+			return err
+		}
+		return stagedIOS(manifest)
+	}
+	runner := &ExporterRunner{}
+
+	// WHEN running exports
+	err := runner.FindAndExport(context.Background())
+
+	// THEN the run fails and the outputs published before the failure come with a partial status
+	if !errors.Is(err, export_artifacts_utils.ErrPartiallyPublished) {
+		t.Fatalf("expected ErrPartiallyPublished, got %v", err)
+	}
+	if exporter.published["IOS_APP_UNDER_TEST"] != "patrol/ios/Runner.app" || exporter.published[ExportStatusEnvKey] != ExportStatusPartial {
+		t.Fatalf("unexpected outputs %v", exporter.published)
+	}
+}
@@ -1,6 +1,7 @@
 package export_artifacts
 
 import (
+	"context"
 	"errors"
 	"testing"
 )
@@ -10,7 +11,7 @@ type exporterStub struct {
 	called bool
 }
 
-func (e *exporterStub) FindAndExport() error {
+func (e *exporterStub) FindAndExport(_ context.Context) error {
 	e.called = true
 	return e.err
 }
@@ -20,7 +21,7 @@ func TestRun_DelegatesToExporter(t *testing.T) {
 	stub := &exporterStub{}
 
 	// WHEN running export
-	err := Run(stub)
+	err := Run(context.Background(), stub)
 
 	// THEN it delegates to the exporter
 	if err != nil {
@@ -36,7 +37,7 @@ func TestRun_ReturnsExporterError(t *testing.T) {
 	stub := &exporterStub{err: errors.New("export failed")}
 
 	// WHEN running export
-	err := Run(stub)
+	err := Run(context.Background(), stub)
 
 	// THEN it returns the error
 	if err == nil {
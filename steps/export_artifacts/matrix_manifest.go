@@ -0,0 +1,51 @@
+package export_artifacts
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	artifact_manifest "patrol_install/steps/export_artifacts/artifact_manifest"
+	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
+	print "patrol_install/utils/print"
+)
+
+// ExportMatrix combines the manifests each build matrix configuration wrote into its subfolder of
+// root into one manifest in root, each entry naming its configuration, and exports its path
+// together with the list of configurations.
+func ExportMatrix(root string, configurations []string) error {
+	combined := &artifact_manifest.Manifest{}
+	for _, configuration := range configurations {
+		folder := filepath.Join(root, configuration)
+		manifest, err := artifact_manifest.Load(filepath.Join(folder, artifact_manifest.FileName))
+		if errors.Is(err, fs.ErrNotExist) {
+			print.Warning(fmt.Sprintf("Configuration %s exported no artifacts", configuration))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range manifest.Artifacts {
+			entry.Configuration = configuration
+			entry.Path = filepath.Join(folder, filepath.FromSlash(entry.Path))
+			combined.Add(entry)
+		}
+	}
+
+	values := []string{strings.Join(configurations, ",")}
+	keys := []string{BuildConfigurationsEnvKey}
+	if len(combined.Artifacts) > 0 {
+		path := filepath.Join(root, artifact_manifest.FileName)
+		if err := combined.Save(path); err != nil {
+			print.Error(fmt.Sprintf("Error writing combined artifact manifest %s: %v", path, err))
+			return err
+		}
+		print.Success(fmt.Sprintf("Combined artifact manifest with %d entries from %d configurations written to %s",
+			len(combined.Artifacts), len(configurations), path))
+		values = append(values, path)
+		keys = append(keys, ManifestPathEnvKey)
+	}
+	return export_artifacts_utils.ExportValues(values, keys)
+}
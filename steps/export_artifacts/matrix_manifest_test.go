@@ -0,0 +1,50 @@
+package export_artifacts
+
+import (
+	"path/filepath"
+	"testing"
+
+	artifact_manifest "patrol_install/steps/export_artifacts/artifact_manifest"
+	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
+)
+
+func TestExportMatrix_CombinesManifests(t *testing.T) {
+	// GIVEN two configurations that exported artifacts and one that exported none
+	root := t.TempDir()
+	for _, configuration := range []string{"android-debug-dev", "ios-release"} {
+		folder := filepath.Join(root, configuration)
+		manifest := &artifact_manifest.Manifest{}
+		manifest.Add(artifact_manifest.Entry{Platform: "android", Role: "app", Path: filepath.Join(folder, "android", "app.apk"), Size: 1})
+		if err := manifest.Save(filepath.Join(folder, artifact_manifest.FileName)); err != nil {
+			t.Fatalf("save manifest: %v", err)
+		}
+	}
+	outputFile := useJSONExporter(t)
+	exporter, err := export_artifacts_utils.EnvExporterFromEnv()
+	if err != nil {
+		t.Fatalf("exporter: %v", err)
+	}
+	export_artifacts_utils.SetEnvExporter(exporter)
+
+	// WHEN combining them
+	err = ExportMatrix(root, []string{"android-debug-dev", "ios-release", "android-release-prod"})
+
+	// THEN the root manifest lists every artifact with its configuration and path from the root
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	combined, err := artifact_manifest.Load(filepath.Join(root, artifact_manifest.FileName))
+	if err != nil {
+		t.Fatalf("load combined manifest: %v", err)
+	}
+	if len(combined.Artifacts) != 2 ||
+		combined.Artifacts[0].Configuration != "android-debug-dev" || combined.Artifacts[0].Path != "android-debug-dev/android/app.apk" ||
+		combined.Artifacts[1].Configuration != "ios-release" || combined.Artifacts[1].Path != "ios-release/android/app.apk" {
+		t.Fatalf("unexpected combined manifest %+v", combined.Artifacts)
+	}
+	outputs := readOutputs(t, outputFile)
+	if outputs[BuildConfigurationsEnvKey] != "android-debug-dev,ios-release,android-release-prod" ||
+		outputs[ManifestPathEnvKey] != filepath.Join(root, artifact_manifest.FileName) {
+		t.Fatalf("unexpected outputs %v", outputs)
+	}
+}
@@ -0,0 +1,95 @@
+package export_artifacts
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
+	"patrol_install/steps/test_discovery"
+	"patrol_install/steps/test_sharding"
+	print "patrol_install/utils/print"
+)
+
+var discoverInventory = test_discovery.InventoryFromEnv
+
+// writeInventory saves the tests the build bundles in the artifacts root and exports its path,
+// then plans the shards when SHARD_COUNT is set. Tests that cannot be scanned only skip the
+// inventory and the shard plan, the built apps are still exported.
+func writeInventory() error {
+	inventory, err := discoverInventory()
+	if err != nil {
+		print.Warning(fmt.Sprintf("Skipping the test inventory: %v", err))
+		return nil
+	}
+	path := filepath.Join(export_artifacts_utils.ArtifactsRootFromEnv(), test_discovery.InventoryFileName)
+	if err := inventory.Save(path); err != nil {
+		print.Error(fmt.Sprintf("Error writing test inventory %s: %v", path, err))
+		return err
+	}
+	print.Success(fmt.Sprintf("Test inventory with %d of %d tests written to %s", len(inventory.Tests), inventory.Discovered, path))
+	if err := export_artifacts_utils.ExportValues([]string{path}, []string{TestInventoryEnvKey}); err != nil {
+		return err
+	}
+	return writeShardPlan(inventory)
+}
+
+// writeShardPlan saves the shard plan of the inventory in the artifacts root and exports its outputs,
+// see shardOutputs.
+func writeShardPlan(inventory *test_discovery.Inventory) error {
+	plan, err := planShards(inventory)
+	if err != nil || plan == nil {
+		return err
+	}
+
+	path := filepath.Join(export_artifacts_utils.ArtifactsRootFromEnv(), test_sharding.PlanFileName)
+	if err := plan.Save(path); err != nil {
+		print.Error(fmt.Sprintf("Error writing shard plan %s: %v", path, err))
+		return err
+	}
+	print.Success(fmt.Sprintf("Shard plan with %d shards by %s written to %s", len(plan.Shards), plan.Strategy, path))
+
+	values, keys := shardOutputs(plan, path)
+	return export_artifacts_utils.ExportValues(values, keys)
+}
+
+// planShards plans the shards of the inventory, or returns nil when SHARD_COUNT is not set or the
+// build has no test.
+func planShards(inventory *test_discovery.Inventory) (*test_sharding.Plan, error) {
+	settings, err := test_sharding.SettingsFromEnv()
+	if err != nil || settings.Count == 0 {
+		return nil, err
+	}
+	if len(inventory.Tests) == 0 {
+		print.Warning("Skipping the shard plan: the build has no test")
+		return nil, nil
+	}
+	tests := make([]test_discovery.Test, len(inventory.Tests))
+	for i, test := range inventory.Tests {
+		tests[i] = test.Test
+	}
+	return test_sharding.NewFromSettings(tests, settings)
+}
+
+// shardOutputs returns the values and keys of the outputs describing plan saved at path: its path,
+// the number of shards and, for each shard n, PATROL_SHARD_<n>_FILTER and PATROL_SHARD_<n>_TARGETS.
+func shardOutputs(plan *test_sharding.Plan, path string) (values, keys []string) {
+	values = []string{path, strconv.Itoa(len(plan.Shards))}
+	keys = []string{ShardPlanEnvKey, ShardCountEnvKey}
+	for _, shard := range plan.Shards {
+		values = append(values, shard.Filter, strings.Join(shard.Files, ","))
+		keys = append(keys, ShardFilterEnvKey(shard.Index), ShardTargetsEnvKey(shard.Index))
+	}
+	return values, keys
+}
+
+// ShardFilterEnvKey is the output holding the test name filter of shard index.
+func ShardFilterEnvKey(index int) string {
+	return fmt.Sprintf("PATROL_SHARD_%d_FILTER", index)
+}
+
+// ShardTargetsEnvKey is the output holding the comma separated test files of shard index.
+func ShardTargetsEnvKey(index int) string {
+	return fmt.Sprintf("PATROL_SHARD_%d_TARGETS", index)
+}
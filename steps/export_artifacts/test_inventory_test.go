@@ -0,0 +1,94 @@
+package export_artifacts
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	build_constants "patrol_install/steps/build/constants"
+	export_artifacts_utils "patrol_install/steps/export_artifacts/utils"
+	"patrol_install/steps/test_discovery"
+	"patrol_install/steps/test_sharding"
+)
+
+func TestFindAndExport_WritesTestInventory(t *testing.T) {
+	// GIVEN a test directory with a smoke and a flaky test, and builds filtered on smoke
+	testDir := t.TempDir()
+	source := `void main() {
+  group('checkout', () {
+    patrolTest('pays by card', tags: ['smoke'], ($) async {});
+    patrolTest('pays by invoice', tags: ['flaky'], ($) async {});
+  });
+}`
+	if err := os.WriteFile(filepath.Join(testDir, "checkout_test.dart"), []byte(source), 0644); err != nil {
+		t.Fatalf("write test: %v", err)
+	}
+	artifactsDir := t.TempDir()
+	stubExports(t, nil, nil)
+	outputFile := useJSONExporter(t)
+	t.Setenv(build_constants.Platform, build_constants.PlatformAndroid)
+	t.Setenv(build_constants.ArtifactsDir, artifactsDir)
+	t.Setenv(build_constants.TestTargetDirectory, testDir)
+	t.Setenv(build_constants.Tags, "smoke")
+	t.Setenv(build_constants.ExcludedTags, "")
+
+	// WHEN running exports
+	err := (&ExporterRunner{}).FindAndExport(context.Background())
+
+	// THEN the inventory lists the selected test and its path is exported
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	path := filepath.Join(artifactsDir, test_discovery.InventoryFileName)
+	if exported := readOutputs(t, outputFile); exported[TestInventoryEnvKey] != path {
+		t.Fatalf("expected %s=%s, got %v", TestInventoryEnvKey, path, exported)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read inventory: %v", err)
+	}
+	var inventory test_discovery.Inventory
+	if err := json.Unmarshal(data, &inventory); err != nil {
+		t.Fatalf("decode inventory: %v", err)
+	}
+	if inventory.Tags != "smoke" || inventory.Discovered != 2 || len(inventory.Tests) != 1 ||
+		inventory.Tests[0].FullName != "checkout pays by card" || inventory.Tests[0].Line != 3 {
+		t.Fatalf("unexpected inventory %s", data)
+	}
+}
+
+func TestWriteShardPlan_ExportsEveryShard(t *testing.T) {
+	// GIVEN an inventory of three tests in two files and two shards requested
+	artifactsDir := t.TempDir()
+	outputFile := useJSONExporter(t)
+	exporter, err := export_artifacts_utils.EnvExporterFromEnv()
+	if err != nil {
+		t.Fatalf("exporter: %v", err)
+	}
+	export_artifacts_utils.SetEnvExporter(exporter)
+	t.Setenv(build_constants.ArtifactsDir, artifactsDir)
+	t.Setenv(build_constants.ShardCount, "2")
+	t.Setenv(build_constants.ShardTimingsFile, "")
+	inventory := test_discovery.NewInventory([]test_discovery.Test{
+		{Name: "logs in", File: "patrol_test/login_test.dart"},
+		{Name: "pays", File: "patrol_test/checkout_test.dart"},
+		{Name: "refunds", File: "patrol_test/checkout_test.dart"},
+	}, nil, nil)
+
+	// WHEN writing the shard plan
+	err = writeShardPlan(inventory)
+
+	// THEN the plan and the filter and targets of each shard are exported
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	exported := readOutputs(t, outputFile)
+	if exported[ShardPlanEnvKey] != filepath.Join(artifactsDir, test_sharding.PlanFileName) || exported[ShardCountEnvKey] != "2" {
+		t.Fatalf("unexpected outputs %v", exported)
+	}
+	if exported[ShardFilterEnvKey(1)] != "^(?:pays|refunds)$" || exported[ShardTargetsEnvKey(2)] != "patrol_test/login_test.dart" {
+		t.Fatalf("unexpected shard outputs %v", exported)
+	}
+}
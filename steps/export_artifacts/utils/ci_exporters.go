@@ -0,0 +1,306 @@
+package export_artifacts_utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	build_constants "patrol_install/steps/build/constants"
+	print "patrol_install/utils/print"
+)
+
+// Exporter names accepted by OUTPUT_EXPORTER.
+const (
+	ExporterAuto    = "auto"
+	ExporterBitrise = "bitrise"
+	ExporterGitHub  = "github"
+	ExporterGitLab  = "gitlab"
+	ExporterDotenv  = "dotenv"
+	ExporterJSON    = "json"
+)
+
+const (
+	DefaultDotenvOutputFile = "patrol_outputs.env"
+	DefaultJSONOutputFile   = "patrol_outputs.json"
+
+	bitriseEnvKey       = "BITRISE_IO"
+	githubActionsEnvKey = "GITHUB_ACTIONS"
+	githubOutputEnvKey  = "GITHUB_OUTPUT"
+	githubEnvEnvKey     = "GITHUB_ENV"
+	gitlabCIEnvKey      = "GITLAB_CI"
+)
+
+var safeDotenvValue = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+
+// dotenvEscaper escapes what dotenv parsers interpret inside double quotes; other characters,
+// non-ASCII ones included, are written as is.
+var dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`)
+
+// DetectExporter returns the exporter matching the CI the step runs on, or dotenv when none is recognised.
+func DetectExporter() string {
+	switch {
+	case os.Getenv(bitriseEnvKey) == "true":
+		return ExporterBitrise
+	case os.Getenv(githubActionsEnvKey) == "true":
+		return ExporterGitHub
+	case os.Getenv(gitlabCIEnvKey) == "true":
+		return ExporterGitLab
+	default:
+		return ExporterDotenv
+	}
+}
+
+// ExporterNameFromEnv returns the exporter named by OUTPUT_EXPORTER, detecting the CI when it is empty or auto.
+func ExporterNameFromEnv() string {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv(build_constants.OutputExporter)))
+	if name == "" || name == ExporterAuto {
+		return DetectExporter()
+	}
+	return name
+}
+
+// EnvExporterFromEnv selects the exporter named by OUTPUT_EXPORTER, detecting the CI when it is empty or auto.
+// File based exporters write to OUTPUT_FILE, or to a default file in the working directory.
+func EnvExporterFromEnv() (EnvExporter, error) {
+	name := ExporterNameFromEnv()
+	outputFile := strings.TrimSpace(os.Getenv(build_constants.OutputFile))
+
+	var exporter EnvExporter
+	switch name {
+	case ExporterBitrise:
+		exporter = envmanExporter{}
+	case ExporterGitHub:
+		outputPath, envPath := os.Getenv(githubOutputEnvKey), os.Getenv(githubEnvEnvKey)
+		if outputPath == "" && envPath == "" {
+			return nil, fmt.Errorf("github exporter selected but neither %s nor %s is set", githubOutputEnvKey, githubEnvEnvKey)
+		}
+		exporter = &githubExporter{outputPath: outputPath, envPath: envPath}
+	case ExporterGitLab:
+		exporter = newFileExporter(orDefault(outputFile, DefaultDotenvOutputFile), formatGitLabDotenv)
+	case ExporterDotenv:
+		exporter = newFileExporter(orDefault(outputFile, DefaultDotenvOutputFile), formatDotenv)
+	case ExporterJSON:
+		exporter = newFileExporter(orDefault(outputFile, DefaultJSONOutputFile), formatJSON)
+	default:
+		return nil, fmt.Errorf("invalid output exporter %q: expected 'auto', 'bitrise', 'github', 'gitlab', 'dotenv' or 'json'", name)
+	}
+	print.Action(fmt.Sprintf("Exporting outputs with the %s exporter", name))
+	return exporter, nil
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// githubExporter appends each value as a step output to $GITHUB_OUTPUT and as an environment
+// variable for later steps to $GITHUB_ENV, using the delimiter syntax so multiline values survive.
+type githubExporter struct {
+	outputPath string
+	envPath    string
+}
+
+func (g *githubExporter) Export(key, value string) error {
+	entry, err := githubEntry(key, value)
+	if err != nil {
+		return err
+	}
+	for _, path := range []string{g.outputPath, g.envPath} {
+		if path == "" {
+			continue
+		}
+		if err := appendToFile(path, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func githubEntry(key, value string) (string, error) {
+	if !strings.Contains(value, "\n") {
+		return fmt.Sprintf("%s=%s\n", key, value), nil
+	}
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	delimiter := "ghadelimiter_" + hex.EncodeToString(random)
+	return fmt.Sprintf("%s<<%s\n%s\n%s\n", key, delimiter, value, delimiter), nil
+}
+
+func appendToFile(path, contents string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(contents); err != nil {
+		closeWithLog(file, path)
+		return err
+	}
+	return file.Close()
+}
+
+// fileFormat writes the values of an output file sorted by keys, and reads them back.
+type fileFormat struct {
+	encode func(values map[string]string, keys []string) ([]byte, error)
+	decode func(data []byte) (map[string]string, error)
+}
+
+var (
+	formatDotenv       = fileFormat{encode: encodeDotenv, decode: decodeDotenv}
+	formatGitLabDotenv = fileFormat{encode: encodeGitLabDotenv, decode: decodeDotenv}
+	formatJSON         = fileFormat{encode: encodeJSON, decode: decodeJSON}
+)
+
+// fileExporter merges each exported value into the values already in its file, so the stages of a
+// run, whether in one process or several, and the configurations of a build matrix add to the same
+// file instead of replacing each other's outputs.
+type fileExporter struct {
+	path   string
+	format fileFormat
+}
+
+func newFileExporter(path string, format fileFormat) *fileExporter {
+	return &fileExporter{path: path, format: format}
+}
+
+func (f *fileExporter) Export(key, value string) error {
+	return f.ExportAll([]string{key}, []string{value})
+}
+
+// ExportAll merges every value into the file in one write.
+func (f *fileExporter) ExportAll(newKeys, newValues []string) error {
+	values, err := f.read()
+	if err != nil {
+		return err
+	}
+	for i, key := range newKeys {
+		values[key] = newValues[i]
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	data, err := f.format.encode(values, keys)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.path, data, 0644)
+}
+
+// read returns the values already in the file, or none when it does not exist yet.
+func (f *fileExporter) read() (map[string]string, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	values, err := f.format.decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot merge outputs into %s: %w", f.path, err)
+	}
+	return values, nil
+}
+
+func encodeDotenv(values map[string]string, keys []string) ([]byte, error) {
+	var b strings.Builder
+	for _, key := range keys {
+		value := values[key]
+		if !safeDotenvValue.MatchString(value) {
+			value = `"` + dotenvEscaper.Replace(value) + `"`
+		}
+		fmt.Fprintf(&b, "%s=%s\n", key, value)
+	}
+	return []byte(b.String()), nil
+}
+
+// encodeGitLabDotenv writes a dotenv report; GitLab rejects values spanning several lines.
+func encodeGitLabDotenv(values map[string]string, keys []string) ([]byte, error) {
+	for _, key := range keys {
+		if strings.ContainsAny(values[key], "\r\n") {
+			return nil, fmt.Errorf("gitlab dotenv reports do not support multiline values (%s)", key)
+		}
+	}
+	return encodeDotenv(values, keys)
+}
+
+// decodeDotenv reads the KEY=value lines written by encodeDotenv.
+func decodeDotenv(data []byte) (map[string]string, error) {
+	values := map[string]string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d is not KEY=value", i+1)
+		}
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := unquoteDotenv(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid quoted value: %w", i+1, err)
+			}
+			value = unquoted
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// unquoteDotenv reverses the escaping of dotenvEscaper. Other backslashes are kept.
+func unquoteDotenv(quoted string) (string, error) {
+	if len(quoted) < 2 || !strings.HasSuffix(quoted, `"`) {
+		return "", errors.New("missing closing quote")
+	}
+	inner := quoted[1 : len(quoted)-1]
+	var b strings.Builder
+	for i := 0; i < len(inner); i++ {
+		switch c := inner[i]; {
+		case c == '"':
+			return "", errors.New("unescaped quote")
+		case c != '\\' || i+1 == len(inner):
+			b.WriteByte(c)
+		default:
+			i++
+			switch inner[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case '\\', '"', '$':
+				b.WriteByte(inner[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(inner[i])
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+func encodeJSON(values map[string]string, _ []string) ([]byte, error) {
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func decodeJSON(data []byte) (map[string]string, error) {
+	values := map[string]string{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
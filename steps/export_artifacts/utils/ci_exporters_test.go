@@ -0,0 +1,222 @@
+package export_artifacts_utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	build_constants "patrol_install/steps/build/constants"
+)
+
+func clearCIEnv(t *testing.T) {
+	for _, key := range []string{bitriseEnvKey, githubActionsEnvKey, gitlabCIEnvKey, githubOutputEnvKey, githubEnvEnvKey,
+		build_constants.OutputExporter, build_constants.OutputFile} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestDetectExporter(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{bitriseEnvKey, ExporterBitrise},
+		{githubActionsEnvKey, ExporterGitHub},
+		{gitlabCIEnvKey, ExporterGitLab},
+		{"", ExporterDotenv},
+	}
+	for _, tt := range tests {
+		clearCIEnv(t)
+		if tt.env != "" {
+			t.Setenv(tt.env, "true")
+		}
+		if got := DetectExporter(); got != tt.want {
+			t.Errorf("DetectExporter() with %s = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestEnvExporterFromEnv_OverridesDetection(t *testing.T) {
+	// GIVEN GitHub Actions with the json exporter selected
+	clearCIEnv(t)
+	t.Setenv(githubActionsEnvKey, "true")
+	t.Setenv(build_constants.OutputExporter, "JSON")
+	outputFile := filepath.Join(t.TempDir(), "outputs.json")
+	t.Setenv(build_constants.OutputFile, outputFile)
+
+	// WHEN selecting the exporter
+	exporter, err := EnvExporterFromEnv()
+
+	// THEN the json exporter writes to the configured file
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := exporter.Export("ANDROID_APK_PATH", "patrol/android/app.apk"); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	data, err := os.ReadFile(outputFile)
+	if err != nil || !strings.Contains(string(data), `"ANDROID_APK_PATH": "patrol/android/app.apk"`) {
+		t.Fatalf("unexpected json outputs %q (%v)", data, err)
+	}
+}
+
+func TestEnvExporterFromEnv_GitHubWithoutFiles(t *testing.T) {
+	// GIVEN the github exporter outside of GitHub Actions
+	clearCIEnv(t)
+	t.Setenv(build_constants.OutputExporter, ExporterGitHub)
+
+	// WHEN selecting the exporter
+	_, err := EnvExporterFromEnv()
+
+	// THEN it is rejected
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestGitHubExporter_WritesOutputAndEnv(t *testing.T) {
+	// GIVEN GitHub output and env files
+	dir := t.TempDir()
+	exporter := &githubExporter{outputPath: filepath.Join(dir, "output"), envPath: filepath.Join(dir, "env")}
+
+	// WHEN exporting a single line and a multiline value
+	if err := exporter.Export("IOS_RUNNER_FILE", "patrol/ios/Runner.xctestrun"); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if err := exporter.Export("NOTES", "first\nsecond"); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// THEN both files hold both values, the multiline one with a delimiter
+	for _, path := range []string{exporter.outputPath, exporter.envPath} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 5 || lines[0] != "IOS_RUNNER_FILE=patrol/ios/Runner.xctestrun" ||
+			!strings.HasPrefix(lines[1], "NOTES<<ghadelimiter_") || lines[2] != "first" || lines[3] != "second" ||
+			lines[4] != strings.TrimPrefix(lines[1], "NOTES<<") {
+			t.Fatalf("unexpected contents of %s:\n%s", path, data)
+		}
+	}
+}
+
+func TestFileExporter_Dotenv(t *testing.T) {
+	// GIVEN a dotenv file holding the outputs of an earlier stage
+	path := filepath.Join(t.TempDir(), "outputs.env")
+	if err := os.WriteFile(path, []byte("C_NOTES=\"first\\nsecond\"\nSTAGE=build\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	exporter := newFileExporter(path, formatDotenv)
+
+	// WHEN exporting values
+	for key, value := range map[string]string{"B_PATH": "patrol/ios/Runner.app", "A_NAME": "My App"} {
+		if err := exporter.Export(key, value); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+	}
+
+	// THEN the new values are merged into the earlier ones, quoted where needed
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(data) != "A_NAME=\"My App\"\nB_PATH=patrol/ios/Runner.app\nC_NOTES=\"first\\nsecond\"\nSTAGE=build\n" {
+		t.Fatalf("unexpected dotenv contents %q", data)
+	}
+}
+
+func TestFileExporter_DotenvQuoting(t *testing.T) {
+	// GIVEN values with non-ASCII characters, a dollar sign, quotes, a backslash and a newline
+	path := filepath.Join(t.TempDir(), "outputs.env")
+	exporter := newFileExporter(path, formatDotenv)
+	values := map[string]string{"A_NAME": "Café Été", "B_PRICE": "$HOME costs \"5\" \\o/", "C_NOTES": "first\nsecond"}
+
+	// WHEN exporting them
+	for key, value := range values {
+		if err := exporter.Export(key, value); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+	}
+
+	// THEN only backslashes, quotes, dollar signs and newlines are escaped, and the values read back
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	want := "A_NAME=\"Café Été\"\nB_PRICE=\"\\$HOME costs \\\"5\\\" \\\\o/\"\nC_NOTES=\"first\\nsecond\"\n"
+	if string(data) != want {
+		t.Fatalf("unexpected dotenv contents %q, want %q", data, want)
+	}
+	decoded, err := decodeDotenv(data)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for key, value := range values {
+		if decoded[key] != value {
+			t.Fatalf("expected %s=%q, got %q", key, value, decoded[key])
+		}
+	}
+}
+
+func TestFileExporter_GitLabRejectsMultiline(t *testing.T) {
+	// GIVEN a GitLab dotenv exporter
+	path := filepath.Join(t.TempDir(), "report.env")
+	exporter := newFileExporter(path, formatGitLabDotenv)
+
+	// WHEN exporting a multiline value
+	err := exporter.Export("NOTES", "first\nsecond")
+
+	// THEN it is rejected and not written
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no report to be written, got %v", err)
+	}
+}
+
+func TestFileExporter_SharedAcrossExports(t *testing.T) {
+	// GIVEN two exports of one run selecting the same file, as a build matrix does
+	path := filepath.Join(t.TempDir(), "outputs.json")
+	first := newFileExporter(path, formatJSON)
+	if err := first.Export("ANDROID_APK_PATH_ANDROID_DEBUG", "a.apk"); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// WHEN the second export writes its own output
+	if err := newFileExporter(path, formatJSON).Export("ANDROID_APK_PATH_ANDROID_RELEASE", "b.apk"); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// THEN the file keeps the outputs of both
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !strings.Contains(string(data), "a.apk") || !strings.Contains(string(data), "b.apk") {
+		t.Fatalf("expected both outputs in %s", data)
+	}
+}
+
+func TestFileExporter_RejectsUnreadableFile(t *testing.T) {
+	// GIVEN an output file that is not valid JSON
+	path := filepath.Join(t.TempDir(), "outputs.json")
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// WHEN exporting a value into it
+	err := newFileExporter(path, formatJSON).Export("ANDROID_APK_PATH", "a.apk")
+
+	// THEN the export fails instead of dropping what the file holds
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "not json" {
+		t.Fatalf("expected the file to be left untouched, got %q", data)
+	}
+}
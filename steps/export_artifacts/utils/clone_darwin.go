@@ -0,0 +1,19 @@
+package export_artifacts_utils
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile creates dstPath as an APFS copy-on-write clone of srcPath using clonefile(2).
+// It fails when the volume does not support clones or the paths are on different volumes.
+func cloneFile(srcPath, dstPath string, mode os.FileMode) error {
+	if err := removeExisting(dstPath); err != nil {
+		return err
+	}
+	if err := unix.Clonefile(srcPath, dstPath, unix.CLONE_NOFOLLOW); err != nil {
+		return err
+	}
+	return os.Chmod(dstPath, mode.Perm())
+}
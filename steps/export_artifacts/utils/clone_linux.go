@@ -0,0 +1,33 @@
+package export_artifacts_utils
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile creates dstPath as a copy-on-write clone of srcPath using the FICLONE ioctl.
+// It fails when the filesystem does not support reflinks or the paths are on different filesystems.
+// An existing destination is removed first, so a file or symlink left there is never written through.
+func cloneFile(srcPath, dstPath string, mode os.FileMode) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer closeWithLog(src, srcPath)
+
+	if err := removeExisting(dstPath); err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlFileClone(int(dst.Fd()), int(src.Fd())); err != nil {
+		closeWithLog(dst, dstPath)
+		_ = os.Remove(dstPath)
+		return err
+	}
+	closeWithLog(dst, dstPath)
+	return os.Chmod(dstPath, mode.Perm())
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package export_artifacts_utils
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile is not available on this platform; callers fall back to copies, or hardlinks when enabled.
+func cloneFile(srcPath, dstPath string, mode os.FileMode) error {
+	return errors.ErrUnsupported
+}
@@ -1,13 +1,83 @@
 package export_artifacts_utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	build_constants "patrol_install/steps/build/constants"
+	artifact_manifest "patrol_install/steps/export_artifacts/artifact_manifest"
 	print "patrol_install/utils/print"
+	step_inputs "patrol_install/utils/step_inputs"
+)
+
+// copyMethod identifies how a single file reached its destination.
+type copyMethod int
+
+const (
+	methodReflink copyMethod = iota
+	methodHardlink
+	methodCopy
 )
 
+var (
+	cloneFileFunc = cloneFile
+	linkFile      = os.Link
+	copyFileFunc  = copyFile
+	verifyCopy    = artifact_manifest.Verify
+	// hardlinks allows falling back to hardlinks when cloning fails. Off unless HARDLINK_ARTIFACTS is set.
+	hardlinks = false
+	// copyWorkers bounds how many files of a directory are transferred concurrently.
+	copyWorkers = min(runtime.NumCPU(), 8)
+)
+
+// copyStats counts transferred files and bytes per method. It is safe for concurrent use.
+type copyStats struct {
+	files [3]atomic.Int64
+	bytes atomic.Int64
+	// linkChanges lists symlinks that were not recreated verbatim, or that escape their bundle.
+	linkChanges []string
+
+	mu sync.Mutex
+	// expected holds what each transferred file must match, keyed by its destination path.
+	expected map[string]artifact_manifest.Expected
+}
+
+// record counts a file transferred to dstPath. digest is the digest of the bytes written by a copy,
+// and empty for clones and links.
+func (s *copyStats) record(method copyMethod, dstPath string, size int64, digest string) {
+	s.files[method].Add(1)
+	s.bytes.Add(size)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expected == nil {
+		s.expected = map[string]artifact_manifest.Expected{}
+	}
+	s.expected[dstPath] = artifact_manifest.Expected{Size: size, SHA256: digest}
+}
+
+func (s *copyStats) summary(elapsed time.Duration) string {
+	megabytes := float64(s.bytes.Load()) / (1024 * 1024)
+	throughput := megabytes
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		throughput = megabytes / seconds
+	}
+	total := s.files[methodReflink].Load() + s.files[methodHardlink].Load() + s.files[methodCopy].Load()
+	return fmt.Sprintf("%d files, %.1f MB in %s (%.1f MB/s); reflink %d, hardlink %d, copy %d",
+		total, megabytes, elapsed.Round(time.Millisecond), throughput,
+		s.files[methodReflink].Load(), s.files[methodHardlink].Load(), s.files[methodCopy].Load())
+}
+
 // closeWithLog closes a file and logs an error if closing fails.
 func closeWithLog(f io.Closer, name string) {
 	if err := f.Close(); err != nil {
@@ -21,71 +91,224 @@ func CopyFilesToFolder(srcFiles []string, destFolder string, envKeys []string) e
 	if len(srcFiles) != len(envKeys) {
 		return fmt.Errorf("number of files (%d) does not match number of env keys (%d)", len(srcFiles), len(envKeys))
 	}
+	artifacts := make([]Artifact, len(srcFiles))
 	for i, srcFile := range srcFiles {
-		dst := filepath.Join(destFolder, filepath.Base(srcFile))
+		artifacts[i] = Artifact{Path: srcFile, EnvKey: envKeys[i]}
+	}
+	return CopyArtifactsToFolder(artifacts, destFolder, nil)
+}
+
+// CopyArtifactsToFolder copies each artifact to destFolder under the name given by the active naming,
+// verifies the copy, adds it to manifest unless manifest is nil and exports the copied path into
+// the artifact's env key.
+// Returns an error if any copy fails or if two artifacts would get the same name.
+func CopyArtifactsToFolder(artifacts []Artifact, destFolder string, manifest *artifact_manifest.Manifest) error {
+	destinations, err := Destinations(artifacts, destFolder)
+	if err != nil {
+		return err
+	}
+
+	for i, artifact := range artifacts {
+		srcFile, dst := artifact.Path, destinations[i]
 		info, err := os.Lstat(srcFile)
 		if err != nil {
 			print.Error(fmt.Sprintf("Error opening %s: %v", srcFile, err))
 			return err
 		}
 
+		stats := &copyStats{}
+		started := time.Now()
 		if info.IsDir() {
-			if err := copyDir(srcFile, dst); err != nil {
+			if err := copyTree(srcFile, dst, stats); err != nil {
 				print.Error(fmt.Sprintf("Error copying directory %s to %s: %v", srcFile, dst, err))
 				return err
 			}
 		} else {
-			if err := copyFile(srcFile, dst, info.Mode()); err != nil {
+			if err := transferFile(srcFile, dst, info, stats); err != nil {
 				print.Error(fmt.Sprintf("Error copying %s to %s: %v", srcFile, dst, err))
 				return err
 			}
 		}
 
-		print.Success(fmt.Sprintf("Copied to %s", dst))
+		size, digest, err := verifyCopy(dst, stats.expected)
+		if err != nil {
+			print.Error(fmt.Sprintf("Error verifying %s: %v", dst, err))
+			return err
+		}
+		if manifest != nil {
+			manifest.Add(artifact_manifest.Entry{Platform: artifact.Platform, Role: artifact.Role, Path: dst, Size: size, SHA256: digest})
+		}
+
+		print.Success(fmt.Sprintf("Copied to %s (%s)", dst, stats.summary(time.Since(started))))
+		if len(stats.linkChanges) > 0 {
+			print.Warning(fmt.Sprintf("Symlinks changed or flagged in %s (policy: %s):\n  - %s",
+				dst, symlinkPolicy, strings.Join(stats.linkChanges, "\n  - ")))
+		}
 
-		if err := exportEnv(envKeys[i], dst); err != nil {
-			print.Error(fmt.Sprintf("Error exporting env by Envman %s: %v", envKeys[i], err))
+		if err := exportEnv(artifact.EnvKey, dst); err != nil {
+			print.Error(fmt.Sprintf("Error exporting env by Envman %s: %v", artifact.EnvKey, err))
 			return err
 		}
-		print.Success(fmt.Sprintf("Artifact: %s exported into: %s \n", dst, envKeys[i]))
+		print.Success(fmt.Sprintf("Artifact: %s exported into: %s \n", dst, artifact.EnvKey))
 
 	}
 	return nil
 }
 
-func copyFile(srcPath, dstPath string, mode os.FileMode) error {
+// copyFile copies srcPath to dstPath and returns the sha256 digest of the bytes written.
+func copyFile(srcPath, dstPath string, mode os.FileMode) (string, error) {
 	src, err := os.Open(srcPath)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	dstFile, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
 	if err != nil {
 		closeWithLog(src, srcPath)
-		return err
+		return "", err
 	}
 
-	if _, err := io.Copy(dstFile, src); err != nil {
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(dstFile, hash), src); err != nil {
 		closeWithLog(src, srcPath)
 		closeWithLog(dstFile, dstPath)
-		return err
+		return "", err
 	}
 
 	closeWithLog(src, srcPath)
 	closeWithLog(dstFile, dstPath)
 
 	if err := os.Chmod(dstPath, mode.Perm()); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// SetHardlinks enables or disables hardlinking artifacts when cloning them fails.
+func SetHardlinks(enabled bool) {
+	hardlinks = enabled
+}
+
+// HardlinksFromEnv reads the hardlink_artifacts input, which is off when empty.
+func HardlinksFromEnv() (bool, error) {
+	return step_inputs.ParseBool(build_constants.HardlinkArtifacts, os.Getenv(build_constants.HardlinkArtifacts))
+}
+
+// transferFile places srcPath at dstPath using the cheapest available method:
+// a copy-on-write clone, then a hardlink when enabled and both paths share a filesystem, then a regular copy.
+// Hardlinked artifacts share their data with the build output, so they must be treated as read-only.
+// An existing destination is removed first so a symlink left there is never written through.
+func transferFile(srcPath, dstPath string, info fs.FileInfo, stats *copyStats) error {
+	if err := removeExisting(dstPath); err != nil {
+		return err
+	}
+	if err := cloneFileFunc(srcPath, dstPath, info.Mode()); err == nil {
+		stats.record(methodReflink, dstPath, info.Size(), "")
+		return nil
+	}
+
+	if err := removeExisting(dstPath); err != nil {
 		return err
 	}
+	if hardlinks {
+		if err := linkFile(srcPath, dstPath); err == nil {
+			stats.record(methodHardlink, dstPath, info.Size(), "")
+			return nil
+		}
+	}
 
+	digest, err := copyFileFunc(srcPath, dstPath, info.Mode())
+	if err != nil {
+		return err
+	}
+	stats.record(methodCopy, dstPath, info.Size(), digest)
 	return nil
 }
 
+// removeExisting deletes path if it exists, with everything below it when it is a folder, so it can
+// be recreated as a clone, link or file. A symlink is removed, never followed.
+func removeExisting(path string) error {
+	return os.RemoveAll(path)
+}
+
 func copyDir(srcDir, dstDir string) error {
+	return copyTree(srcDir, dstDir, &copyStats{})
+}
+
+type copyJob struct {
+	src  string
+	dst  string
+	info fs.FileInfo
+}
+
+// treeCopier walks a bundle, recreating folders and symlinks itself and handing regular files
+// to a bounded pool of workers. Only the walking goroutine touches root, policy, linkParents and
+// stats.linkChanges.
+type treeCopier struct {
+	root   string
+	policy SymlinkPolicy
+	stats  *copyStats
+	jobs   chan copyJob
+	// linkParents holds the folders of the folder links being dereferenced, outermost first.
+	// A link to one of them or their parents would be copied again and again.
+	linkParents []string
+
+	failOnce sync.Once
+	failed   atomic.Bool
+	firstErr error
+}
+
+func (c *treeCopier) fail(err error) {
+	c.failOnce.Do(func() {
+		c.firstErr = err
+		c.failed.Store(true)
+	})
+}
+
+// copyTree copies srcDir into dstDir following the active symlink policy.
+// An existing destination is cleared first, so entries of an earlier export that srcDir no longer
+// holds do not end up in the copy. The first failure stops further work.
+func copyTree(srcDir, dstDir string, stats *copyStats) error {
+	if err := removeExisting(dstDir); err != nil {
+		return fmt.Errorf("failed to clear %s: %w", dstDir, err)
+	}
+	c := &treeCopier{root: srcDir, policy: symlinkPolicy, stats: stats, jobs: make(chan copyJob)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(copyWorkers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range c.jobs {
+				if c.failed.Load() {
+					continue
+				}
+				if err := transferFile(job.src, job.dst, job.info, stats); err != nil {
+					c.fail(fmt.Errorf("copy %s: %w", job.src, err))
+				}
+			}
+		}()
+	}
+
+	walkErr := c.walk(srcDir, dstDir)
+	close(c.jobs)
+	wg.Wait()
+
+	if walkErr != nil {
+		return walkErr
+	}
+	return c.firstErr
+}
+
+func (c *treeCopier) walk(srcDir, dstDir string) error {
 	return filepath.WalkDir(srcDir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if c.failed.Load() {
+			return filepath.SkipAll
+		}
 		rel, err := filepath.Rel(srcDir, path)
 		if err != nil {
 			return err
@@ -97,17 +320,88 @@ func copyDir(srcDir, dstDir string) error {
 		}
 
 		if d.IsDir() {
-			return os.MkdirAll(dstPath, info.Mode().Perm())
+			return makeDir(dstPath, info.Mode())
 		}
 
 		if d.Type()&os.ModeSymlink != 0 {
-			target, err := os.Readlink(path)
+			return c.copySymlink(path, dstPath)
+		}
+
+		c.jobs <- copyJob{src: path, dst: dstPath, info: info}
+		return nil
+	})
+}
+
+// makeDir creates dstPath, replacing a symlink left at that location by an earlier copy
+// so that files are never written through it to somewhere outside the destination.
+func makeDir(dstPath string, mode os.FileMode) error {
+	if info, err := os.Lstat(dstPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(dstPath); err != nil {
+			return err
+		}
+	}
+	return os.MkdirAll(dstPath, mode.Perm())
+}
+
+func (c *treeCopier) copySymlink(path, dstPath string) error {
+	rel, _ := filepath.Rel(c.root, path)
+	if c.policy == SymlinkReject {
+		return fmt.Errorf("%w: %s (symlinks are rejected)", ErrUnsafeSymlink, rel)
+	}
+
+	target, err := inspectSymlink(c.root, path)
+	if err != nil {
+		return err
+	}
+	if target.escapes && c.policy != SymlinkPreserve {
+		return fmt.Errorf("%w: %s -> %s points outside the bundle", ErrUnsafeSymlink, rel, target.raw)
+	}
+
+	switch c.policy {
+	case SymlinkDereference:
+		if target.isDir {
+			parent := filepath.Dir(path)
+			if isWithin(target.resolved, parent) {
+				return fmt.Errorf("%w: %s -> %s links to its own parent", ErrUnsafeSymlink, rel, target.raw)
+			}
+			for _, linkParent := range c.linkParents {
+				if isWithin(target.resolved, linkParent) {
+					return fmt.Errorf("%w: %s -> %s forms a cycle with the links dereferenced before", ErrUnsafeSymlink, rel, target.raw)
+				}
+			}
+			c.stats.linkChanges = append(c.stats.linkChanges, fmt.Sprintf("%s -> %s: replaced by a copy of the folder", rel, target.raw))
+			c.linkParents = append(c.linkParents, parent)
+			err := c.walk(target.resolved, dstPath)
+			c.linkParents = c.linkParents[:len(c.linkParents)-1]
+			return err
+		}
+		info, err := os.Stat(target.resolved)
+		if err != nil {
+			return fmt.Errorf("%w: %s -> %s cannot be dereferenced: %v", ErrUnsafeSymlink, rel, target.raw, err)
+		}
+		c.stats.linkChanges = append(c.stats.linkChanges, fmt.Sprintf("%s -> %s: replaced by a copy of the file", rel, target.raw))
+		c.jobs <- copyJob{src: target.resolved, dst: dstPath, info: info}
+		return nil
+	case SymlinkRewrite:
+		if filepath.IsAbs(target.raw) {
+			relTarget, err := filepath.Rel(filepath.Dir(path), target.resolved)
 			if err != nil {
 				return err
 			}
-			return os.Symlink(target, dstPath)
+			c.stats.linkChanges = append(c.stats.linkChanges, fmt.Sprintf("%s -> %s: rewritten to %s", rel, target.raw, relTarget))
+			return replaceWithSymlink(relTarget, dstPath)
 		}
+	case SymlinkPreserve:
+		if target.escapes {
+			c.stats.linkChanges = append(c.stats.linkChanges, fmt.Sprintf("%s -> %s: kept, but points outside the bundle", rel, target.raw))
+		}
+	}
+	return replaceWithSymlink(target.raw, dstPath)
+}
 
-		return copyFile(path, dstPath, info.Mode())
-	})
+func replaceWithSymlink(target, dstPath string) error {
+	if err := removeExisting(dstPath); err != nil {
+		return err
+	}
+	return os.Symlink(target, dstPath)
 }
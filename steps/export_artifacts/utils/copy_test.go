@@ -1,9 +1,16 @@
 package export_artifacts_utils
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
+
+	build_constants "patrol_install/steps/build/constants"
+	artifact_manifest "patrol_install/steps/export_artifacts/artifact_manifest"
 )
 
 type stubEnvExporter struct {
@@ -127,11 +134,15 @@ func TestCopyFile(t *testing.T) {
 	dstPath := filepath.Join(dstDir, "source.txt")
 
 	// WHEN copying the file
-	if err := copyFile(srcPath, dstPath, 0644); err != nil {
+	digest, err := copyFile(srcPath, dstPath, 0644)
+	if err != nil {
 		t.Fatalf("copyFile failed: %v", err)
 	}
 
-	// THEN contents are preserved
+	// THEN contents are preserved and the digest of the bytes written is returned
+	if digest != "239f59ed55e737c77147cf55ad0c1b030b6d7ee748a7426952f9b852d5a935e5" {
+		t.Fatalf("unexpected digest %q", digest)
+	}
 	data, err := os.ReadFile(dstPath)
 	if err != nil {
 		t.Fatalf("failed to read dest file: %v", err)
@@ -165,3 +176,350 @@ func TestCopyDir(t *testing.T) {
 		t.Fatalf("expected copied file, got error: %v", err)
 	}
 }
+
+func stubCopyMethods(t *testing.T, clone func(string, string, os.FileMode) error, link func(string, string) error) {
+	originalClone := cloneFileFunc
+	originalLink := linkFile
+	if clone != nil {
+		cloneFileFunc = clone
+	}
+	if link != nil {
+		linkFile = link
+	}
+	t.Cleanup(func() {
+		cloneFileFunc = originalClone
+		linkFile = originalLink
+	})
+}
+
+func unsupportedClone(string, string, os.FileMode) error { return errors.ErrUnsupported }
+
+func unsupportedLink(string, string) error { return errors.ErrUnsupported }
+
+func writeSourceFile(t *testing.T, content string) (string, os.FileInfo) {
+	t.Helper()
+	srcPath := filepath.Join(t.TempDir(), "app.apk")
+	if err := os.WriteFile(srcPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		t.Fatalf("stat source: %v", err)
+	}
+	return srcPath, info
+}
+
+func TestTransferFile_Reflink(t *testing.T) {
+	// GIVEN a filesystem where cloning succeeds
+	var cloned bool
+	stubCopyMethods(t, func(src, dst string, mode os.FileMode) error {
+		cloned = true
+		_, err := copyFile(src, dst, mode)
+		return err
+	}, nil)
+	srcPath, info := writeSourceFile(t, "payload")
+	stats := &copyStats{}
+
+	// WHEN transferring the file
+	err := transferFile(srcPath, filepath.Join(t.TempDir(), "app.apk"), info, stats)
+
+	// THEN the clone is used
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !cloned || stats.files[methodReflink].Load() != 1 {
+		t.Fatalf("expected reflink to be recorded, got %s", stats.summary(time.Second))
+	}
+}
+
+func enableHardlinks(t *testing.T) {
+	SetHardlinks(true)
+	t.Cleanup(func() { SetHardlinks(false) })
+}
+
+func TestTransferFile_HardlinkFallback(t *testing.T) {
+	// GIVEN cloning is unsupported, hardlinks are enabled and both paths share a filesystem
+	stubCopyMethods(t, unsupportedClone, nil)
+	enableHardlinks(t)
+	srcPath, info := writeSourceFile(t, "payload")
+	dstPath := filepath.Join(filepath.Dir(srcPath), "linked.apk")
+	if err := os.WriteFile(dstPath, []byte("stale"), 0644); err != nil {
+		t.Fatalf("failed to write existing destination: %v", err)
+	}
+	stats := &copyStats{}
+
+	// WHEN transferring the file over an existing destination
+	err := transferFile(srcPath, dstPath, info, stats)
+
+	// THEN the destination is a hardlink to the source
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	dstInfo, err := os.Stat(dstPath)
+	if err != nil {
+		t.Fatalf("stat destination: %v", err)
+	}
+	if !os.SameFile(info, dstInfo) {
+		t.Fatal("expected destination to be hardlinked to source")
+	}
+	if stats.files[methodHardlink].Load() != 1 {
+		t.Fatalf("expected hardlink to be recorded, got %s", stats.summary(time.Second))
+	}
+}
+
+func TestTransferFile_NoHardlinkByDefault(t *testing.T) {
+	// GIVEN cloning is unsupported and hardlinks are not enabled
+	stubCopyMethods(t, unsupportedClone, nil)
+	srcPath, info := writeSourceFile(t, "payload")
+	dstPath := filepath.Join(filepath.Dir(srcPath), "copied.apk")
+	stats := &copyStats{}
+
+	// WHEN transferring the file within the same filesystem
+	err := transferFile(srcPath, dstPath, info, stats)
+
+	// THEN the file is copied instead of hardlinked
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	dstInfo, err := os.Stat(dstPath)
+	if err != nil {
+		t.Fatalf("stat destination: %v", err)
+	}
+	if os.SameFile(info, dstInfo) {
+		t.Fatal("expected destination not to be hardlinked to source")
+	}
+	if stats.files[methodCopy].Load() != 1 || stats.files[methodHardlink].Load() != 0 {
+		t.Fatalf("expected a copy to be recorded, got %s", stats.summary(time.Second))
+	}
+}
+
+func TestHardlinksFromEnv(t *testing.T) {
+	// GIVEN the hardlink input set to valid and invalid values
+	cases := map[string]struct {
+		want    bool
+		wantErr bool
+	}{"": {}, "false": {}, "true": {want: true}, "TRUE": {want: true}, "yes": {wantErr: true}}
+
+	for value, tc := range cases {
+		t.Setenv(build_constants.HardlinkArtifacts, value)
+
+		// WHEN reading the input
+		got, err := HardlinksFromEnv()
+
+		// THEN only 'true', in any case, enables hardlinks and unknown values are rejected
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Fatalf("value %q: expected %v (error %v), got %v, %v", value, tc.want, tc.wantErr, got, err)
+		}
+	}
+}
+
+func TestTransferFile_CopyFallback(t *testing.T) {
+	// GIVEN neither cloning nor hardlinking is possible
+	stubCopyMethods(t, unsupportedClone, unsupportedLink)
+	srcPath, info := writeSourceFile(t, "payload")
+	dstPath := filepath.Join(t.TempDir(), "app.apk")
+	stats := &copyStats{}
+
+	// WHEN transferring the file
+	err := transferFile(srcPath, dstPath, info, stats)
+
+	// THEN the bytes are copied into an independent file
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	dstInfo, err := os.Stat(dstPath)
+	if err != nil {
+		t.Fatalf("stat destination: %v", err)
+	}
+	if os.SameFile(info, dstInfo) {
+		t.Fatal("expected an independent copy")
+	}
+	if stats.files[methodCopy].Load() != 1 || stats.bytes.Load() != int64(len("payload")) {
+		t.Fatalf("expected copy to be recorded, got %s", stats.summary(time.Second))
+	}
+}
+
+func TestCloneFile_Linux(t *testing.T) {
+	// GIVEN a source file on the temp filesystem
+	if runtime.GOOS != "linux" {
+		t.Skip("FICLONE is Linux only")
+	}
+	srcPath, info := writeSourceFile(t, "payload")
+	dstPath := filepath.Join(filepath.Dir(srcPath), "clone.apk")
+
+	// WHEN cloning it
+	err := cloneFile(srcPath, dstPath, info.Mode())
+
+	// THEN the clone has the same contents, or the filesystem reports reflinks as unsupported
+	if err != nil {
+		if _, statErr := os.Stat(dstPath); !os.IsNotExist(statErr) {
+			t.Fatalf("expected no partial clone after failure, got %v", statErr)
+		}
+		t.Skipf("reflinks not supported on this filesystem: %v", err)
+	}
+	data, err := os.ReadFile(dstPath)
+	if err != nil || string(data) != "payload" {
+		t.Fatalf("expected cloned payload, got %q (%v)", data, err)
+	}
+}
+
+func TestCopyDir_WorkerPool(t *testing.T) {
+	// GIVEN a bundle with many files and a small worker pool
+	stubCopyMethods(t, unsupportedClone, unsupportedLink)
+	original := copyWorkers
+	copyWorkers = 3
+	t.Cleanup(func() { copyWorkers = original })
+	srcDir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		dir := filepath.Join(srcDir, fmt.Sprintf("dir%d", i%4))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d", i)), []byte("content"), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	dstDir := filepath.Join(t.TempDir(), "copied")
+	stats := &copyStats{}
+
+	// WHEN copying the tree
+	err := copyTree(srcDir, dstDir, stats)
+
+	// THEN every file is copied once
+	if err != nil {
+		t.Fatalf("copyTree failed: %v", err)
+	}
+	if stats.files[methodCopy].Load() != 20 {
+		t.Fatalf("expected 20 copied files, got %s", stats.summary(time.Second))
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "dir3", "file19")); err != nil {
+		t.Fatalf("expected nested file copied: %v", err)
+	}
+}
+
+func TestCopyDir_WorkerError(t *testing.T) {
+	// GIVEN a file that cannot be copied
+	stubCopyMethods(t, unsupportedClone, unsupportedLink)
+	original := copyFileFunc
+	copyFileFunc = func(string, string, os.FileMode) (string, error) { return "", errors.New("disk full") }
+	t.Cleanup(func() { copyFileFunc = original })
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "file"), []byte("content"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	dstDir := filepath.Join(t.TempDir(), "copied")
+
+	// WHEN copying the tree
+	err := copyTree(srcDir, dstDir, &copyStats{})
+
+	// THEN the worker error is returned
+	if err == nil {
+		t.Fatal("expected copy error, got nil")
+	}
+}
+
+func TestCopyArtifactsToFolder_VerificationFailure(t *testing.T) {
+	// GIVEN a copy that does not match its source
+	stub := setupEnvExporterStub(t)
+	original := verifyCopy
+	verifyCopy = func(dst string, expected map[string]artifact_manifest.Expected) (int64, string, error) {
+		return 0, "", artifact_manifest.ErrChecksumMismatch
+	}
+	t.Cleanup(func() { verifyCopy = original })
+	src := filepath.Join(t.TempDir(), "app.apk")
+	if err := os.WriteFile(src, []byte("apk"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// WHEN copying it
+	manifest := &artifact_manifest.Manifest{}
+	err := CopyArtifactsToFolder([]Artifact{{Path: src, EnvKey: "ANDROID_APK_PATH"}}, t.TempDir(), manifest)
+
+	// THEN the path is neither exported nor recorded
+	if !errors.Is(err, artifact_manifest.ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if len(stub.exported) != 0 || len(manifest.Artifacts) != 0 {
+		t.Fatalf("expected nothing exported or recorded, got %v and %v", stub.exported, manifest.Artifacts)
+	}
+}
+
+func TestCopyArtifactsToFolder_RecordsManifestEntry(t *testing.T) {
+	// GIVEN an artifact to copy
+	setupEnvExporterStub(t)
+	src := filepath.Join(t.TempDir(), "app.apk")
+	if err := os.WriteFile(src, []byte("apk"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	destDir := t.TempDir()
+
+	// WHEN copying it
+	manifest := &artifact_manifest.Manifest{}
+	err := CopyArtifactsToFolder([]Artifact{{Path: src, EnvKey: "ANDROID_APK_PATH", Platform: "android", Role: RoleAppUnderTest}}, destDir, manifest)
+
+	// THEN the copy is recorded with its size and digest
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	entries := manifest.Artifacts
+	if len(entries) != 1 || entries[0].Path != filepath.Join(destDir, "app.apk") || entries[0].Size != 3 || len(entries[0].SHA256) != 64 {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+}
+
+func TestCloneFile_NeverWritesThroughExistingDestination(t *testing.T) {
+	// GIVEN a destination that is a symlink to a file outside the artifacts folder
+	srcPath, info := writeSourceFile(t, "payload")
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	if err := os.WriteFile(outside, []byte("untouched"), 0644); err != nil {
+		t.Fatalf("failed to write outside file: %v", err)
+	}
+	dstPath := filepath.Join(t.TempDir(), "app.apk")
+	if err := os.Symlink(outside, dstPath); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	// WHEN cloning over it, whether or not the filesystem supports clones
+	_ = cloneFile(srcPath, dstPath, info.Mode())
+
+	// THEN the symlink target is left untouched
+	content, err := os.ReadFile(outside)
+	if err != nil {
+		t.Fatalf("read outside file: %v", err)
+	}
+	if string(content) != "untouched" {
+		t.Fatalf("expected the symlink target to be untouched, got %q", content)
+	}
+}
+
+func TestTransferFile_RecordsWhatToVerify(t *testing.T) {
+	// GIVEN one file that is cloned and one that is copied
+	srcPath, info := writeSourceFile(t, "payload")
+	dstDir := t.TempDir()
+	clonedPath := filepath.Join(dstDir, "cloned.apk")
+	copiedPath := filepath.Join(dstDir, "copied.apk")
+	stubCopyMethods(t, func(src, dst string, mode os.FileMode) error {
+		if dst != clonedPath {
+			return errors.ErrUnsupported
+		}
+		_, err := copyFile(src, dst, mode)
+		return err
+	}, unsupportedLink)
+	stats := &copyStats{}
+
+	// WHEN transferring both
+	for _, dstPath := range []string{clonedPath, copiedPath} {
+		if err := transferFile(srcPath, dstPath, info, stats); err != nil {
+			t.Fatalf("transfer %s: %v", dstPath, err)
+		}
+	}
+
+	// THEN both are verified by size and only the copy by the digest of the bytes written
+	cloned, copied := stats.expected[clonedPath], stats.expected[copiedPath]
+	if cloned.Size != 7 || cloned.SHA256 != "" {
+		t.Fatalf("expected the clone to be verified by size only, got %+v", cloned)
+	}
+	if copied.Size != 7 || copied.SHA256 != "239f59ed55e737c77147cf55ad0c1b030b6d7ee748a7426952f9b852d5a935e5" {
+		t.Fatalf("expected the copy to be verified by digest, got %+v", copied)
+	}
+}
@@ -1,12 +1,29 @@
 package export_artifacts_utils
 
-import "github.com/bitrise-io/go-steputils/tools"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bitrise-io/go-steputils/tools"
+
+	print "patrol_install/utils/print"
+)
 
 // EnvExporter exports key/value pairs into the environment store.
 type EnvExporter interface {
 	Export(key, value string) error
 }
 
+// BatchExporter is an EnvExporter writing several values at once, so either all of them are
+// published or none is.
+type BatchExporter interface {
+	EnvExporter
+	ExportAll(keys, values []string) error
+}
+
+// ErrPartiallyPublished is returned when an output could not be published after others were.
+var ErrPartiallyPublished = errors.New("outputs partially published")
+
 type envmanExporter struct{}
 
 func (envmanExporter) Export(key, value string) error {
@@ -24,6 +41,98 @@ func SetEnvExporter(exporter EnvExporter) {
 	envExporter = exporter
 }
 
+var outputSuffix string
+
+// SetOutputSuffix appends suffix to every key exported from now on, so each configuration of a
+// build matrix publishes its own outputs. Pass an empty suffix to export the plain keys.
+func SetOutputSuffix(suffix string) {
+	outputSuffix = suffix
+}
+
+// OutputKey returns the key a value exported under key is published as.
+func OutputKey(key string) string {
+	return key + outputSuffix
+}
+
+// envTransaction holds the values exported while a transaction is open, in export order.
+type envTransaction struct {
+	keys   []string
+	values []string
+}
+
+var transaction *envTransaction
+
+// BeginExport opens a transaction: values exported from now on are staged in memory
+// and only published by CommitExports.
+func BeginExport() {
+	transaction = &envTransaction{}
+}
+
+// CommitExports publishes every staged value through the active exporter and closes the transaction.
+// A BatchExporter publishes them in one write. Other exporters publish them one at a time, and a
+// failure after the first one returns ErrPartiallyPublished.
+func CommitExports() error {
+	staged := transaction
+	transaction = nil
+	if staged == nil {
+		return nil
+	}
+	if batch, ok := envExporter.(BatchExporter); ok {
+		if err := batch.ExportAll(staged.keys, staged.values); err != nil {
+			print.Error(fmt.Sprintf("Error exporting %d envs: %v", len(staged.keys), err))
+			return err
+		}
+	} else {
+		for i, key := range staged.keys {
+			if err := envExporter.Export(key, staged.values[i]); err != nil {
+				print.Error(fmt.Sprintf("Error exporting env %s: %v", key, err))
+				if i > 0 {
+					return fmt.Errorf("%w: %d of %d published before %s failed: %w", ErrPartiallyPublished, i, len(staged.keys), key, err)
+				}
+				return err
+			}
+		}
+	}
+	print.Success(fmt.Sprintf("Published %d outputs", len(staged.keys)))
+	return nil
+}
+
+// RollbackExports discards every staged value, closes the transaction and returns how many were dropped.
+func RollbackExports() int {
+	staged := transaction
+	transaction = nil
+	if staged == nil {
+		return 0
+	}
+	return len(staged.keys)
+}
+
+// exportEnv stages the value when a transaction is open, otherwise exports it right away.
 func exportEnv(key, value string) error {
+	key = OutputKey(key)
+	if transaction != nil {
+		transaction.keys = append(transaction.keys, key)
+		transaction.values = append(transaction.values, value)
+		return nil
+	}
 	return envExporter.Export(key, value)
 }
+
+// ExportValues exports each value under the env key at the same index.
+// Empty values are skipped so optional metadata does not publish blank outputs.
+func ExportValues(values []string, envKeys []string) error {
+	if len(values) != len(envKeys) {
+		return fmt.Errorf("number of values (%d) does not match number of env keys (%d)", len(values), len(envKeys))
+	}
+	for i, value := range values {
+		if value == "" {
+			continue
+		}
+		if err := exportEnv(envKeys[i], value); err != nil {
+			print.Error(fmt.Sprintf("Error exporting env by Envman %s: %v", OutputKey(envKeys[i]), err))
+			return err
+		}
+		print.Success(fmt.Sprintf("Value: %s exported into: %s", value, OutputKey(envKeys[i])))
+	}
+	return nil
+}
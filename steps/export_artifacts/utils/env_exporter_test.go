@@ -1,6 +1,10 @@
 package export_artifacts_utils
 
-import "testing"
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
 
 type envExporterSpy struct {
 	called bool
@@ -45,3 +49,152 @@ func TestSetEnvExporter_ResetToDefault(t *testing.T) {
 		t.Fatalf("expected default envman exporter after reset, got %T", envExporter)
 	}
 }
+
+func TestExportValues_SkipsEmptyValues(t *testing.T) {
+	// GIVEN values where one is empty
+	stub := setupEnvExporterStub(t)
+
+	// WHEN exporting them
+	err := ExportValues([]string{"com.example.app", ""}, []string{"TEST_PACKAGE", "TEST_VERSION"})
+
+	// THEN only the non-empty value is exported
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stub.exported["TEST_PACKAGE"] != "com.example.app" {
+		t.Fatalf("expected TEST_PACKAGE exported, got %v", stub.exported)
+	}
+	if _, ok := stub.exported["TEST_VERSION"]; ok {
+		t.Fatalf("expected TEST_VERSION to be skipped, got %v", stub.exported)
+	}
+}
+
+func TestExportValues_LengthMismatch(t *testing.T) {
+	// GIVEN mismatched values and keys
+	setupEnvExporterStub(t)
+
+	// WHEN exporting them
+	err := ExportValues([]string{"a", "b"}, []string{"ONLY_ONE"})
+
+	// THEN an error is returned
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestExportTransaction_CommitPublishesInOrder(t *testing.T) {
+	// GIVEN an open transaction
+	stub := setupEnvExporterStub(t)
+	BeginExport()
+	t.Cleanup(func() { RollbackExports() })
+
+	// WHEN values are exported
+	if err := ExportValues([]string{"a", "b"}, []string{"FIRST", "SECOND"}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// THEN nothing is published until the commit
+	if len(stub.exported) != 0 {
+		t.Fatalf("expected staged values only, got %v", stub.exported)
+	}
+	if err := CommitExports(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if stub.exported["FIRST"] != "a" || stub.exported["SECOND"] != "b" {
+		t.Fatalf("expected committed values, got %v", stub.exported)
+	}
+}
+
+// flakyExporter publishes every value except the failAt-th one, counting from 1.
+type flakyExporter struct {
+	failAt    int
+	calls     int
+	published map[string]string
+}
+
+func (e *flakyExporter) Export(key, value string) error {
+	e.calls++
+	if e.calls == e.failAt {
+		return errors.New("envman failed")
+	}
+	e.published[key] = value
+	return nil
+}
+
+func TestExportTransaction_CommitReportsPartialPublish(t *testing.T) {
+	// GIVEN staged values and an exporter failing on the second one
+	exporter := &flakyExporter{failAt: 2, published: map[string]string{}}
+	SetEnvExporter(exporter)
+	t.Cleanup(func() { SetEnvExporter(nil) })
+	BeginExport()
+	if err := ExportValues([]string{"a", "b", "c"}, []string{"FIRST", "SECOND", "THIRD"}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// WHEN committing
+	err := CommitExports()
+
+	// THEN the commit stops and reports that the first value was published
+	if !errors.Is(err, ErrPartiallyPublished) {
+		t.Fatalf("expected ErrPartiallyPublished, got %v", err)
+	}
+	if len(exporter.published) != 1 || exporter.published["FIRST"] != "a" {
+		t.Fatalf("expected only the first value published, got %v", exporter.published)
+	}
+}
+
+func TestExportTransaction_CommitWritesFileOnce(t *testing.T) {
+	// GIVEN staged values and a file exporter that cannot write
+	SetEnvExporter(newFileExporter(filepath.Join(t.TempDir(), "missing", "outputs.json"), formatJSON))
+	t.Cleanup(func() { SetEnvExporter(nil) })
+	BeginExport()
+	if err := ExportValues([]string{"a", "b"}, []string{"FIRST", "SECOND"}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// WHEN committing
+	err := CommitExports()
+
+	// THEN the single write fails and nothing is reported as published
+	if err == nil || errors.Is(err, ErrPartiallyPublished) {
+		t.Fatalf("expected a plain write error, got %v", err)
+	}
+}
+
+func TestExportTransaction_RollbackDiscards(t *testing.T) {
+	// GIVEN staged values
+	stub := setupEnvExporterStub(t)
+	BeginExport()
+	if err := exportEnv("KEY", "value"); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// WHEN rolling back
+	dropped := RollbackExports()
+
+	// THEN the values are dropped and later exports are immediate again
+	if dropped != 1 || len(stub.exported) != 0 {
+		t.Fatalf("expected 1 dropped value and none published, got %d and %v", dropped, stub.exported)
+	}
+	if err := exportEnv("KEY", "value"); err != nil || stub.exported["KEY"] != "value" {
+		t.Fatalf("expected immediate export after rollback, got %v (%v)", stub.exported, err)
+	}
+}
+
+func TestExportValues_AppendsOutputSuffix(t *testing.T) {
+	// GIVEN an output suffix for one configuration of a build matrix
+	stub := setupEnvExporterStub(t)
+	SetOutputSuffix("_ANDROID_DEBUG")
+	t.Cleanup(func() { SetOutputSuffix("") })
+
+	// WHEN exporting a value
+	err := ExportValues([]string{"app.apk"}, []string{"ANDROID_APK_PATH"})
+
+	// THEN it is published under the suffixed key only
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stub.exported["ANDROID_APK_PATH_ANDROID_DEBUG"] != "app.apk" || len(stub.exported) != 1 {
+		t.Fatalf("unexpected exports %v", stub.exported)
+	}
+}
@@ -0,0 +1,55 @@
+package export_artifacts_utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	build_constants "patrol_install/steps/build/constants"
+	build_record "patrol_install/steps/build/models/build_record"
+	print "patrol_install/utils/print"
+)
+
+var buildRecordPath = build_constants.BuildRecordPath
+
+// RejectStaleArtifacts fails when any artifact differs from the outputs recorded by the build stage.
+// When the build stage ran in this process, its record is required. A standalone export can only
+// check against the record of an earlier run, or exports unchecked without one, and says so loudly.
+func RejectStaleArtifacts(artifacts []string) error {
+	var startedAt time.Time
+	if value := os.Getenv(build_record.StartedEnvKey); value != "" {
+		var err error
+		if startedAt, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", build_record.StartedEnvKey, err)
+		}
+	}
+
+	record, err := build_record.Load(buildRecordPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !startedAt.IsZero():
+		err = fmt.Errorf("%w: the build started at %s left no record in %s", build_record.ErrStaleArtifact, startedAt.Format(time.RFC3339), buildRecordPath)
+		print.Error(err.Error())
+		return err
+	case errors.Is(err, fs.ErrNotExist):
+		print.Warning(fmt.Sprintf("⚠️ No build record in %s: the artifacts are exported WITHOUT checking that a build produced them. Run the build stage first.", buildRecordPath))
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if startedAt.IsZero() {
+		print.Warning(fmt.Sprintf("⚠️ No build ran in this process: checking the artifacts against the record of the build finished at %s by an earlier run.", record.FinishedAt.Format(time.RFC3339)))
+	} else if !record.StartedAt.Equal(startedAt) {
+		err := fmt.Errorf("%w: %s was written by the build started at %s, not by the build of this run started at %s",
+			build_record.ErrStaleArtifact, buildRecordPath, record.StartedAt.Format(time.RFC3339), startedAt.Format(time.RFC3339))
+		print.Error(err.Error())
+		return err
+	}
+	if err := record.CheckFresh(artifacts); err != nil {
+		print.Error(fmt.Sprintf("%v\nEnable clean_build_outputs to remove leftovers before building.", err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package export_artifacts_utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	build_record "patrol_install/steps/build/models/build_record"
+)
+
+func setBuildRecordPath(t *testing.T, path string) {
+	original := buildRecordPath
+	buildRecordPath = path
+	t.Cleanup(func() {
+		buildRecordPath = original
+	})
+}
+
+// setBuildStarted sets the start of the build run by this process, empty when none ran.
+func setBuildStarted(t *testing.T, startedAt time.Time) {
+	value := ""
+	if !startedAt.IsZero() {
+		value = startedAt.Format(time.RFC3339Nano)
+	}
+	t.Setenv(build_record.StartedEnvKey, value)
+}
+
+func TestRejectStaleArtifacts_NoRecord(t *testing.T) {
+	// GIVEN no build record and no build run by this process
+	setBuildRecordPath(t, filepath.Join(t.TempDir(), "missing.json"))
+	setBuildStarted(t, time.Time{})
+
+	// WHEN checking artifacts
+	err := RejectStaleArtifacts([]string{"/nonexistent/app.apk"})
+
+	// THEN the artifacts are exported unchecked
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// AND the record is required once the build ran in this process
+	setBuildStarted(t, time.Now())
+	if err := RejectStaleArtifacts([]string{"/nonexistent/app.apk"}); !errors.Is(err, build_record.ErrStaleArtifact) {
+		t.Fatalf("expected ErrStaleArtifact, got %v", err)
+	}
+}
+
+func TestRejectStaleArtifacts_Stale(t *testing.T) {
+	// GIVEN an artifact the recorded build did not leave behind
+	dir := t.TempDir()
+	artifact := filepath.Join(dir, "app-release.apk")
+	if err := os.WriteFile(artifact, []byte("apk"), 0644); err != nil {
+		t.Fatalf("write artifact: %v", err)
+	}
+	recordPath := filepath.Join(dir, "record.json")
+	startedAt := time.Now().Round(0)
+	record := &build_record.Record{StartedAt: startedAt, FinishedAt: startedAt}
+	if err := record.Save(recordPath); err != nil {
+		t.Fatalf("save record: %v", err)
+	}
+	setBuildRecordPath(t, recordPath)
+	setBuildStarted(t, startedAt)
+
+	// WHEN checking artifacts
+	err := RejectStaleArtifacts([]string{artifact})
+
+	// THEN the artifact is rejected
+	if !errors.Is(err, build_record.ErrStaleArtifact) {
+		t.Fatalf("expected ErrStaleArtifact, got %v", err)
+	}
+}
+
+func TestRejectStaleArtifacts_RecordOfEarlierRun(t *testing.T) {
+	// GIVEN a build record of an earlier run covering the artifact
+	dir := t.TempDir()
+	artifact := filepath.Join(dir, "app-release.apk")
+	if err := os.WriteFile(artifact, []byte("apk"), 0644); err != nil {
+		t.Fatalf("write artifact: %v", err)
+	}
+	earlier := time.Now().Add(-time.Hour).Round(0)
+	record, err := build_record.New(earlier, earlier, []string{dir})
+	if err != nil {
+		t.Fatalf("new record: %v", err)
+	}
+	recordPath := filepath.Join(t.TempDir(), "record.json")
+	if err := record.Save(recordPath); err != nil {
+		t.Fatalf("save record: %v", err)
+	}
+	setBuildRecordPath(t, recordPath)
+
+	// WHEN checking artifacts after a build of this process
+	setBuildStarted(t, time.Now())
+	err = RejectStaleArtifacts([]string{artifact})
+
+	// THEN the record is rejected as older than the build
+	if !errors.Is(err, build_record.ErrStaleArtifact) {
+		t.Fatalf("expected ErrStaleArtifact, got %v", err)
+	}
+
+	// AND a standalone export checks against it
+	setBuildStarted(t, time.Time{})
+	if err := RejectStaleArtifacts([]string{artifact}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestRejectStaleArtifacts_LeftoverInOutputRoot(t *testing.T) {
+	// GIVEN an APK from yesterday in the output root, recorded by the build of this run
+	root := filepath.Join(t.TempDir(), "outputs")
+	artifact := filepath.Join(root, "apk", "app-release.apk")
+	if err := os.MkdirAll(filepath.Dir(artifact), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(artifact, []byte("apk"), 0644); err != nil {
+		t.Fatalf("write artifact: %v", err)
+	}
+	old := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(artifact, old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	startedAt := time.Now().Add(-time.Minute).Round(0)
+	record, err := build_record.New(startedAt, time.Now().Round(0), []string{root})
+	if err != nil {
+		t.Fatalf("new record: %v", err)
+	}
+	recordPath := filepath.Join(t.TempDir(), "record.json")
+	if err := record.Save(recordPath); err != nil {
+		t.Fatalf("save record: %v", err)
+	}
+	setBuildRecordPath(t, recordPath)
+	setBuildStarted(t, startedAt)
+
+	// WHEN checking artifacts
+	err = RejectStaleArtifacts([]string{artifact})
+
+	// THEN the leftover is rejected as stale
+	if !errors.Is(err, build_record.ErrStaleArtifact) {
+		t.Fatalf("expected ErrStaleArtifact, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package export_artifacts_utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	build_constants "patrol_install/steps/build/constants"
+)
+
+// Roles identify what an exported artifact is used for.
+const (
+	RoleAppUnderTest    = "app"
+	RoleInstrumentation = "test"
+	RoleXCTestRun       = "xctestrun"
+	RoleBundle          = "bundle"
+)
+
+// DefaultArtifactsFolder is the folder artifacts are exported into when no deploy dir is available.
+const DefaultArtifactsFolder = "patrol"
+
+const (
+	pubspecPath     = "pubspec.yaml"
+	defaultAppName  = "app"
+	shortCommitSize = 7
+)
+
+// Artifact is a build output to copy together with the env key its exported path is published under.
+type Artifact struct {
+	Path     string
+	EnvKey   string
+	Platform string
+	Role     string
+}
+
+// Naming renders destination file names for exported artifacts.
+//
+// Template placeholders are {app}, {platform}, {buildType}, {flavor}, {commit}, {role} and {name},
+// the original file name without its extension. Placeholders without a value are dropped together
+// with their separator. A literal extension at the end of the template is replaced by the
+// extension of each artifact, so `{app}-{platform}.apk` also names Runner.app and the xctestrun.
+// When the template uses neither {role} nor {name}, every artifact but the app under test gets
+// its role appended so one template covers a whole export. An empty template keeps the original names.
+type Naming struct {
+	Template  string
+	App       string
+	BuildType string
+	// Flavor is the product flavor being built, empty for unflavored builds.
+	Flavor string
+	Commit string
+}
+
+var (
+	placeholderRegex   = regexp.MustCompile(`\{(\w*)\}`)
+	unsafeNameRegex    = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	repeatedSeparators = regexp.MustCompile(`([-_.])[-_.]+`)
+	pubspecNameRegex   = regexp.MustCompile(`^name:\s*['"]?([^'"\s#]+)`)
+
+	artifactExtensions = map[string]bool{".apk": true, ".app": true, ".xctestrun": true, ".zip": true}
+	knownPlaceholders  = map[string]bool{
+		"app": true, "platform": true, "buildType": true, "flavor": true, "commit": true, "role": true, "name": true,
+	}
+)
+
+var naming Naming
+
+// SetNaming swaps the naming used by CopyFilesToFolder. Pass a zero Naming to keep original names.
+func SetNaming(n Naming) {
+	naming = n
+}
+
+// ValidateNameTemplate rejects unknown placeholders and templates that would leave the artifacts folder.
+func ValidateNameTemplate(template string) error {
+	if strings.ContainsAny(template, `/\`) {
+		return fmt.Errorf("invalid artifact name template %q: path separators are not allowed", template)
+	}
+	for _, match := range placeholderRegex.FindAllStringSubmatch(template, -1) {
+		if !knownPlaceholders[match[1]] {
+			return fmt.Errorf("invalid artifact name template %q: unknown placeholder {%s}", template, match[1])
+		}
+	}
+	return nil
+}
+
+// NamingFromEnv builds the naming for the current run from ARTIFACT_NAME_TEMPLATE, the build type,
+// the flavor, the pubspec name and the commit Bitrise checked out.
+func NamingFromEnv() (Naming, error) {
+	template := strings.TrimSpace(os.Getenv(build_constants.ArtifactNameTemplate))
+	if err := ValidateNameTemplate(template); err != nil {
+		return Naming{}, err
+	}
+	commit := os.Getenv(build_constants.BitriseGitCommit)
+	if commit == "" {
+		commit = os.Getenv(build_constants.GitCloneCommitHash)
+	}
+	if len(commit) > shortCommitSize {
+		commit = commit[:shortCommitSize]
+	}
+	return Naming{
+		Template:  template,
+		App:       readPubspecName(pubspecPath),
+		BuildType: os.Getenv(build_constants.BuildType),
+		Flavor:    os.Getenv(build_constants.Flavor),
+		Commit:    commit,
+	}, nil
+}
+
+// ArtifactsRootFromEnv returns the folder artifacts are exported into: ARTIFACTS_DIR, else
+// $BITRISE_DEPLOY_DIR/patrol, else patrol under the working directory.
+func ArtifactsRootFromEnv() string {
+	if root := strings.TrimSpace(os.Getenv(build_constants.ArtifactsDir)); root != "" {
+		return root
+	}
+	if deployDir := os.Getenv(build_constants.BitriseDeployDir); deployDir != "" {
+		return filepath.Join(deployDir, DefaultArtifactsFolder)
+	}
+	return DefaultArtifactsFolder
+}
+
+// ArtifactsFolderFromEnv returns the subfolder of ArtifactsRootFromEnv a platform exports into.
+func ArtifactsFolderFromEnv(platform string) string {
+	return filepath.Join(ArtifactsRootFromEnv(), platform)
+}
+
+// DestinationName returns the file name artifact gets in the artifacts folder.
+func (n Naming) DestinationName(artifact Artifact) string {
+	base := filepath.Base(artifact.Path)
+	if n.Template == "" {
+		return base
+	}
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+
+	template := n.Template
+	if templateExt := filepath.Ext(template); artifactExtensions[templateExt] {
+		template = strings.TrimSuffix(template, templateExt)
+	}
+	if !strings.Contains(template, "{role}") && !strings.Contains(template, "{name}") && artifact.Role != RoleAppUnderTest {
+		template += "-{role}"
+	}
+
+	values := map[string]string{
+		"app":       n.App,
+		"platform":  artifact.Platform,
+		"buildType": n.BuildType,
+		"flavor":    n.Flavor,
+		"commit":    n.Commit,
+		"role":      artifact.Role,
+		"name":      stem,
+	}
+	rendered := placeholderRegex.ReplaceAllStringFunc(template, func(placeholder string) string {
+		return unsafeNameRegex.ReplaceAllString(values[strings.Trim(placeholder, "{}")], "_")
+	})
+	rendered = strings.Trim(repeatedSeparators.ReplaceAllString(rendered, "$1"), "-_.")
+	if rendered == "" {
+		rendered = stem
+	}
+	return rendered + ext
+}
+
+// Destinations returns where each artifact is copied to in destFolder, using the current naming.
+// It fails when two artifacts would get the same name.
+func Destinations(artifacts []Artifact, destFolder string) ([]string, error) {
+	return naming.Destinations(artifacts, destFolder)
+}
+
+// Destinations returns where each artifact is copied to in destFolder under this naming.
+// It fails when two artifacts would get the same name.
+func (n Naming) Destinations(artifacts []Artifact, destFolder string) ([]string, error) {
+	destinations := make([]string, len(artifacts))
+	sources := make(map[string]string, len(artifacts))
+	for i, artifact := range artifacts {
+		name := n.DestinationName(artifact)
+		if previous, ok := sources[name]; ok {
+			return nil, fmt.Errorf("artifact name template %q gives %s and %s the same name %s: add {role} or {name}",
+				n.Template, previous, artifact.Path, name)
+		}
+		sources[name] = artifact.Path
+		destinations[i] = filepath.Join(destFolder, name)
+	}
+	return destinations, nil
+}
+
+// readPubspecName returns the package name declared in the pubspec, or a generic name when it cannot be read.
+func readPubspecName(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return defaultAppName
+	}
+	defer closeWithLog(file, path)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if match := pubspecNameRegex.FindStringSubmatch(scanner.Text()); match != nil {
+			return match[1]
+		}
+	}
+	return defaultAppName
+}
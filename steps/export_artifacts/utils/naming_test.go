@@ -0,0 +1,120 @@
+package export_artifacts_utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	build_constants "patrol_install/steps/build/constants"
+)
+
+func useNaming(t *testing.T, n Naming) {
+	SetNaming(n)
+	t.Cleanup(func() {
+		SetNaming(Naming{})
+	})
+}
+
+func TestDestinationName(t *testing.T) {
+	naming := Naming{Template: "{app}-{platform}-{buildType}-{flavor}-{commit}.apk", App: "my_app", BuildType: "release", Commit: "abc1234"}
+	tests := []struct {
+		naming   Naming
+		artifact Artifact
+		want     string
+	}{
+		{Naming{}, Artifact{Path: "build/app-release.apk", Role: RoleAppUnderTest}, "app-release.apk"},
+		{naming, Artifact{Path: "build/app-release.apk", Platform: "android", Role: RoleAppUnderTest}, "my_app-android-release-abc1234.apk"},
+		{naming, Artifact{Path: "build/app-release-androidTest.apk", Platform: "android", Role: RoleInstrumentation}, "my_app-android-release-abc1234-test.apk"},
+		{naming, Artifact{Path: "Products/Runner.app", Platform: "ios", Role: RoleAppUnderTest}, "my_app-ios-release-abc1234.app"},
+		{naming, Artifact{Path: "Products/Runner_iphoneos.xctestrun", Platform: "ios", Role: RoleXCTestRun}, "my_app-ios-release-abc1234-xctestrun.xctestrun"},
+		{Naming{Template: "{name}-{flavor}-v1.2", Flavor: "dev prod"}, Artifact{Path: "ios_tests.zip"}, "ios_tests-dev_prod-v1.2.zip"},
+		{Naming{Template: "{flavor}"}, Artifact{Path: "app.apk", Role: RoleAppUnderTest}, "app.apk"},
+	}
+	for _, tt := range tests {
+		if got := tt.naming.DestinationName(tt.artifact); got != tt.want {
+			t.Errorf("DestinationName(%q, %s) = %q, want %q", tt.naming.Template, tt.artifact.Path, got, tt.want)
+		}
+	}
+}
+
+func TestValidateNameTemplate(t *testing.T) {
+	for template, wantErr := range map[string]bool{
+		"":                            false,
+		"{app}-{platform}-{role}.apk": false,
+		"{app}-{version}":             true,
+		"../{app}":                    true,
+	} {
+		if err := ValidateNameTemplate(template); (err != nil) != wantErr {
+			t.Errorf("ValidateNameTemplate(%q) error = %v, want error %v", template, err, wantErr)
+		}
+	}
+}
+
+func TestNamingFromEnv(t *testing.T) {
+	// GIVEN a project pubspec and Bitrise commit env
+	workDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "pubspec.yaml"), []byte("# app\nname: shop_app\nversion: 1.0.0\n"), 0644); err != nil {
+		t.Fatalf("write pubspec: %v", err)
+	}
+	t.Chdir(workDir)
+	t.Setenv(build_constants.ArtifactNameTemplate, "{app}-{commit}")
+	t.Setenv(build_constants.BuildType, "debug")
+	t.Setenv(build_constants.BitriseGitCommit, "0123456789abcdef")
+
+	// WHEN reading the naming
+	naming, err := NamingFromEnv()
+
+	// THEN the values are resolved
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := Naming{Template: "{app}-{commit}", App: "shop_app", BuildType: "debug", Commit: "0123456"}
+	if naming != want {
+		t.Fatalf("expected %+v, got %+v", want, naming)
+	}
+}
+
+func TestArtifactsFolderFromEnv(t *testing.T) {
+	t.Setenv(build_constants.ArtifactsDir, "")
+	t.Setenv(build_constants.BitriseDeployDir, "")
+	if got := ArtifactsFolderFromEnv("ios"); got != filepath.Join("patrol", "ios") {
+		t.Errorf("expected patrol/ios without deploy dir, got %q", got)
+	}
+
+	t.Setenv(build_constants.BitriseDeployDir, "/deploy")
+	if got := ArtifactsFolderFromEnv("ios"); got != filepath.Join("/deploy", "patrol", "ios") {
+		t.Errorf("expected deploy dir to be used, got %q", got)
+	}
+
+	t.Setenv(build_constants.ArtifactsDir, "/custom")
+	if got := ArtifactsFolderFromEnv("android"); got != filepath.Join("/custom", "android") {
+		t.Errorf("expected ARTIFACTS_DIR to win, got %q", got)
+	}
+}
+
+func TestCopyArtifactsToFolder_DuplicateNames(t *testing.T) {
+	// GIVEN a template that gives two artifacts of the same role one name
+	stub := setupEnvExporterStub(t)
+	useNaming(t, Naming{Template: "{app}", App: "my_app"})
+	srcDir := t.TempDir()
+	var artifacts []Artifact
+	for _, name := range []string{"a.apk", "b.apk"} {
+		path := filepath.Join(srcDir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		artifacts = append(artifacts, Artifact{Path: path, EnvKey: strings.ToUpper(name), Role: RoleAppUnderTest})
+	}
+
+	// WHEN copying them
+	err := CopyArtifactsToFolder(artifacts, t.TempDir(), nil)
+
+	// THEN nothing is copied or exported
+	if err == nil || !strings.Contains(err.Error(), "same name") {
+		t.Fatalf("expected duplicate name error, got %v", err)
+	}
+	if len(stub.exported) != 0 {
+		t.Fatalf("expected no exports, got %v", stub.exported)
+	}
+}
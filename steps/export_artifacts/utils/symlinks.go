@@ -0,0 +1,100 @@
+package export_artifacts_utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy decides how symlinks found inside a copied bundle are recreated.
+type SymlinkPolicy string
+
+const (
+	// SymlinkPreserve recreates every link verbatim and only reports links escaping the bundle.
+	SymlinkPreserve SymlinkPolicy = "preserve"
+	// SymlinkRewrite turns absolute links into relative ones and rejects links escaping the bundle.
+	SymlinkRewrite SymlinkPolicy = "rewrite"
+	// SymlinkDereference copies the link target instead of the link and rejects links escaping the bundle.
+	SymlinkDereference SymlinkPolicy = "dereference"
+	// SymlinkReject fails on any symlink.
+	SymlinkReject SymlinkPolicy = "reject"
+
+	DefaultSymlinkPolicy = SymlinkRewrite
+)
+
+// ErrUnsafeSymlink is returned when a symlink is not allowed by the active policy.
+var ErrUnsafeSymlink = errors.New("unsafe symlink")
+
+var symlinkPolicy = DefaultSymlinkPolicy
+
+// ParseSymlinkPolicy validates a policy name. An empty value selects DefaultSymlinkPolicy.
+func ParseSymlinkPolicy(value string) (SymlinkPolicy, error) {
+	switch policy := SymlinkPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return DefaultSymlinkPolicy, nil
+	case SymlinkPreserve, SymlinkRewrite, SymlinkDereference, SymlinkReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid symlink policy %q: expected 'preserve', 'rewrite', 'dereference' or 'reject'", value)
+	}
+}
+
+// SetSymlinkPolicy swaps the policy used by CopyFilesToFolder. Pass an empty policy to reset to the default.
+func SetSymlinkPolicy(policy SymlinkPolicy) {
+	if policy == "" {
+		policy = DefaultSymlinkPolicy
+	}
+	symlinkPolicy = policy
+}
+
+// symlinkTarget describes where a link inside a bundle points.
+type symlinkTarget struct {
+	raw      string
+	resolved string
+	escapes  bool
+	isDir    bool
+}
+
+// inspectSymlink resolves the link at path and reports whether it leaves root.
+// Existing targets are resolved through every intermediate link; dangling ones lexically.
+func inspectSymlink(root, path string) (symlinkTarget, error) {
+	raw, err := os.Readlink(path)
+	if err != nil {
+		return symlinkTarget{}, err
+	}
+	target := symlinkTarget{raw: raw}
+
+	lexical := raw
+	if !filepath.IsAbs(lexical) {
+		lexical = filepath.Join(filepath.Dir(path), raw)
+	}
+	target.resolved = filepath.Clean(lexical)
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return symlinkTarget{}, err
+	}
+	if realTarget, err := filepath.EvalSymlinks(path); err == nil {
+		target.escapes = !isWithin(realRoot, realTarget)
+		if info, err := os.Stat(realTarget); err == nil {
+			target.isDir = info.IsDir()
+		}
+		if !target.escapes {
+			rel, _ := filepath.Rel(realRoot, realTarget)
+			target.resolved = filepath.Join(root, rel)
+		}
+	} else {
+		target.escapes = !isWithin(root, target.resolved) && !isWithin(realRoot, target.resolved)
+	}
+	return target, nil
+}
+
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,297 @@
+package export_artifacts_utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func useSymlinkPolicy(t *testing.T, policy SymlinkPolicy) {
+	SetSymlinkPolicy(policy)
+	t.Cleanup(func() {
+		SetSymlinkPolicy("")
+	})
+}
+
+// createBundle creates Runner.app with Frameworks/App, an absolute link to it and a relative link.
+func createBundle(t *testing.T) string {
+	t.Helper()
+	bundle := filepath.Join(t.TempDir(), "Runner.app")
+	frameworks := filepath.Join(bundle, "Frameworks")
+	if err := os.MkdirAll(frameworks, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(frameworks, "App"), []byte("binary"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(frameworks, "App"), filepath.Join(bundle, "absolute")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := os.Symlink("Frameworks", filepath.Join(bundle, "relative")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	return bundle
+}
+
+func addEscapingLink(t *testing.T, bundle string) {
+	t.Helper()
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(bundle, "escape")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+}
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    SymlinkPolicy
+		wantErr bool
+	}{
+		{"", DefaultSymlinkPolicy, false},
+		{"Preserve", SymlinkPreserve, false},
+		{"dereference", SymlinkDereference, false},
+		{"follow", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSymlinkPolicy(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSymlinkPolicy(%q) = %q, %v; want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCopyTree_RewriteMakesAbsoluteLinksRelative(t *testing.T) {
+	// GIVEN a bundle with an absolute link inside the bundle
+	useSymlinkPolicy(t, SymlinkRewrite)
+	bundle := createBundle(t)
+	dst := filepath.Join(t.TempDir(), "Runner.app")
+	stats := &copyStats{}
+
+	// WHEN copying it
+	err := copyTree(bundle, dst, stats)
+
+	// THEN the absolute link is rewritten relative to the copy and reported
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	target, err := os.Readlink(filepath.Join(dst, "absolute"))
+	if err != nil || target != filepath.Join("Frameworks", "App") {
+		t.Fatalf("expected relative target, got %q (%v)", target, err)
+	}
+	if target, _ := os.Readlink(filepath.Join(dst, "relative")); target != "Frameworks" {
+		t.Fatalf("expected relative link kept, got %q", target)
+	}
+	if len(stats.linkChanges) != 1 {
+		t.Fatalf("expected one reported change, got %v", stats.linkChanges)
+	}
+}
+
+func TestCopyTree_RewriteRejectsEscapingLinks(t *testing.T) {
+	// GIVEN a bundle with a link pointing outside of it
+	useSymlinkPolicy(t, SymlinkRewrite)
+	bundle := createBundle(t)
+	addEscapingLink(t, bundle)
+
+	// WHEN copying it
+	err := copyTree(bundle, filepath.Join(t.TempDir(), "Runner.app"), &copyStats{})
+
+	// THEN the copy fails
+	if !errors.Is(err, ErrUnsafeSymlink) {
+		t.Fatalf("expected ErrUnsafeSymlink, got %v", err)
+	}
+}
+
+func TestCopyTree_RejectsParentTraversal(t *testing.T) {
+	// GIVEN a relative link climbing out of the bundle
+	useSymlinkPolicy(t, SymlinkDereference)
+	bundle := createBundle(t)
+	if err := os.Symlink(filepath.Join("..", ".."), filepath.Join(bundle, "Frameworks", "up")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	// WHEN copying it
+	err := copyTree(bundle, filepath.Join(t.TempDir(), "Runner.app"), &copyStats{})
+
+	// THEN the copy fails
+	if !errors.Is(err, ErrUnsafeSymlink) {
+		t.Fatalf("expected ErrUnsafeSymlink, got %v", err)
+	}
+}
+
+func TestCopyTree_PreserveFlagsEscapingLinks(t *testing.T) {
+	// GIVEN a bundle with a link pointing outside of it
+	useSymlinkPolicy(t, SymlinkPreserve)
+	bundle := createBundle(t)
+	addEscapingLink(t, bundle)
+	dst := filepath.Join(t.TempDir(), "Runner.app")
+	stats := &copyStats{}
+
+	// WHEN copying it
+	err := copyTree(bundle, dst, stats)
+
+	// THEN links are kept verbatim and the escaping one is reported
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if target, _ := os.Readlink(filepath.Join(dst, "absolute")); target != filepath.Join(bundle, "Frameworks", "App") {
+		t.Fatalf("expected absolute link kept, got %q", target)
+	}
+	if len(stats.linkChanges) != 1 {
+		t.Fatalf("expected the escaping link to be reported, got %v", stats.linkChanges)
+	}
+}
+
+func TestCopyTree_DereferenceCopiesTargets(t *testing.T) {
+	// GIVEN a bundle with file and folder links
+	useSymlinkPolicy(t, SymlinkDereference)
+	bundle := createBundle(t)
+	dst := filepath.Join(t.TempDir(), "Runner.app")
+	stats := &copyStats{}
+
+	// WHEN copying it
+	err := copyTree(bundle, dst, stats)
+
+	// THEN the links are replaced by copies of their targets
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, name := range []string{"absolute", "relative"} {
+		info, err := os.Lstat(filepath.Join(dst, name))
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			t.Fatalf("expected %s to be a regular entry, got %v (%v)", name, info, err)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "relative", "App")); err != nil || string(data) != "binary" {
+		t.Fatalf("expected folder link contents copied, got %q (%v)", data, err)
+	}
+	if len(stats.linkChanges) != 2 {
+		t.Fatalf("expected two reported changes, got %v", stats.linkChanges)
+	}
+}
+
+func TestCopyTree_DereferenceRejectsLinkCycles(t *testing.T) {
+	// GIVEN two folders linking to each other
+	useSymlinkPolicy(t, SymlinkDereference)
+	bundle := filepath.Join(t.TempDir(), "Runner.app")
+	for _, link := range [][2]string{{"x", "ly"}, {"y", "lx"}} {
+		if err := os.MkdirAll(filepath.Join(bundle, link[0]), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	for _, link := range [][3]string{{"x", "ly", "y"}, {"y", "lx", "x"}} {
+		if err := os.Symlink(filepath.Join("..", link[2]), filepath.Join(bundle, link[0], link[1])); err != nil {
+			t.Fatalf("symlink: %v", err)
+		}
+	}
+
+	// WHEN copying it
+	err := copyTree(bundle, filepath.Join(t.TempDir(), "Runner.app"), &copyStats{})
+
+	// THEN the cycle is rejected instead of being copied endlessly
+	if !errors.Is(err, ErrUnsafeSymlink) || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected a symlink cycle error, got %v", err)
+	}
+}
+
+func TestCopyTree_RejectPolicy(t *testing.T) {
+	// GIVEN a bundle with symlinks
+	useSymlinkPolicy(t, SymlinkReject)
+	bundle := createBundle(t)
+
+	// WHEN copying it
+	err := copyTree(bundle, filepath.Join(t.TempDir(), "Runner.app"), &copyStats{})
+
+	// THEN the copy fails
+	if !errors.Is(err, ErrUnsafeSymlink) {
+		t.Fatalf("expected ErrUnsafeSymlink, got %v", err)
+	}
+}
+
+func TestCopyTree_RecopyIntoExistingDestination(t *testing.T) {
+	// GIVEN a destination from an earlier copy where a folder was swapped for an outside link
+	useSymlinkPolicy(t, SymlinkRewrite)
+	bundle := createBundle(t)
+	dst := filepath.Join(t.TempDir(), "Runner.app")
+	if err := copyTree(bundle, dst, &copyStats{}); err != nil {
+		t.Fatalf("first copy failed: %v", err)
+	}
+	outside := t.TempDir()
+	if err := os.RemoveAll(filepath.Join(dst, "Frameworks")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dst, "Frameworks")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	// WHEN copying again
+	err := copyTree(bundle, dst, &copyStats{})
+
+	// THEN the copy succeeds without writing through the link
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Fatalf("expected nothing written outside, got %v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "Frameworks", "App")); err != nil {
+		t.Fatalf("expected Frameworks to be recreated: %v", err)
+	}
+}
+
+func TestCopyTree_RecopyDropsEntriesMissingFromSource(t *testing.T) {
+	// GIVEN a destination from an earlier copy holding a file the bundle no longer has
+	useSymlinkPolicy(t, SymlinkRewrite)
+	bundle := createBundle(t)
+	dst := filepath.Join(t.TempDir(), "Runner.app")
+	if err := copyTree(bundle, dst, &copyStats{}); err != nil {
+		t.Fatalf("first copy failed: %v", err)
+	}
+	stale := filepath.Join(dst, "Frameworks", "Stale")
+	if err := os.WriteFile(stale, []byte("old"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// WHEN copying again
+	stats := &copyStats{}
+	err := copyTree(bundle, dst, stats)
+
+	// THEN the stale file is gone and only the bundle files are expected
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := os.Lstat(stale); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the stale file to be removed, got %v", err)
+	}
+	if _, ok := stats.expected[stale]; ok || len(stats.expected) != 1 {
+		t.Fatalf("unexpected files to verify %v", stats.expected)
+	}
+}
+
+func TestCopyTree_RecopyReplacesDereferencedFolderWithLink(t *testing.T) {
+	// GIVEN a destination from an earlier copy that dereferenced the folder links
+	bundle := createBundle(t)
+	dst := filepath.Join(t.TempDir(), "Runner.app")
+	useSymlinkPolicy(t, SymlinkDereference)
+	if err := copyTree(bundle, dst, &copyStats{}); err != nil {
+		t.Fatalf("first copy failed: %v", err)
+	}
+
+	for _, policy := range []SymlinkPolicy{SymlinkPreserve, SymlinkRewrite} {
+		// WHEN copying again with a policy keeping the links
+		useSymlinkPolicy(t, policy)
+		err := copyTree(bundle, dst, &copyStats{})
+
+		// THEN the copied folder is replaced by the link
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", policy, err)
+		}
+		if target, err := os.Readlink(filepath.Join(dst, "relative")); err != nil || target != "Frameworks" {
+			t.Fatalf("%s: expected the relative link, got %q (%v)", policy, target, err)
+		}
+	}
+}
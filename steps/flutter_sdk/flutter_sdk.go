@@ -0,0 +1,227 @@
+package flutter_sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"patrol_install/commands"
+)
+
+// Version managers pinning the Flutter SDK of a project.
+const (
+	ManagerFVM  = "FVM"
+	ManagerPuro = "Puro"
+)
+
+// FlutterCommandEnvKey tells the Patrol CLI which flutter command to run.
+const FlutterCommandEnvKey = "PATROL_FLUTTER_COMMAND"
+
+// Environment variables moving the SDK caches away from their default location.
+const (
+	fvmCachePathEnvKey = "FVM_CACHE_PATH"
+	fvmHomeEnvKey      = "FVM_HOME"
+	puroRootEnvKey     = "PURO_ROOT"
+)
+
+// SDK is the Flutter SDK used by the project.
+type SDK struct {
+	// Manager is ManagerFVM or ManagerPuro, empty when the flutter found on the PATH is used.
+	Manager string
+	// Version is the pinned FVM version or the Puro environment name.
+	Version string
+	// Config is the file pinning the SDK.
+	Config string
+	// Root is the folder of the pinned SDK.
+	Root string
+}
+
+// Pinned reports whether a version manager pins the SDK.
+func (s SDK) Pinned() bool {
+	return s.Manager != ""
+}
+
+// Flutter returns the flutter executable of the SDK.
+func (s SDK) Flutter() string {
+	if !s.Pinned() {
+		return "flutter"
+	}
+	return filepath.Join(s.Root, "bin", "flutter")
+}
+
+// Dart returns the dart executable of the SDK.
+func (s SDK) Dart() string {
+	if !s.Pinned() {
+		return "dart"
+	}
+	return filepath.Join(s.Root, "bin", "dart")
+}
+
+// Env returns the variables that make the commands of a shell use the SDK: PATROL_FLUTTER_COMMAND
+// for the Patrol CLI, and the SDK first on the PATH for the patrol executable pub installs, which
+// runs the first dart found there. Without a pinned SDK the environment is left as is.
+func (s SDK) Env() []string {
+	if !s.Pinned() {
+		return nil
+	}
+	return []string{
+		FlutterCommandEnvKey + "=" + s.Flutter(),
+		"PATH=" + filepath.Join(s.Root, "bin") + string(os.PathListSeparator) + os.Getenv("PATH"),
+	}
+}
+
+// Command returns cmd running the flutter or dart of the SDK when cmd runs one of them. With a pinned
+// SDK, patrol runs through the dart of the SDK, as the executable pub installs would use any dart.
+func (s SDK) Command(cmd commands.Command) commands.Command {
+	switch {
+	case cmd.Name == "flutter":
+		flutter := s.Flutter()
+		return cmd.CopyWith(&flutter, nil)
+	case cmd.Name == "dart":
+		dart := s.Dart()
+		return cmd.CopyWith(&dart, nil)
+	case cmd.Name == "patrol" && s.Pinned():
+		dart := s.Dart()
+		return cmd.CopyWith(&dart, append([]string{"pub", "global", "run", "patrol_cli"}, cmd.Args...))
+	default:
+		return cmd
+	}
+}
+
+func (s SDK) String() string {
+	if !s.Pinned() {
+		return "Flutter from the PATH"
+	}
+	return fmt.Sprintf("Flutter %s pinned by %s in %s (%s)", s.Version, s.Manager, s.Config, s.Root)
+}
+
+var (
+	workingDir = os.Getwd
+	homeDir    = os.UserHomeDir
+)
+
+// FromEnv detects the SDK pinned for the working directory, see Detect.
+func FromEnv() (SDK, error) {
+	dir, err := workingDir()
+	if err != nil {
+		return SDK{}, err
+	}
+	return Detect(dir)
+}
+
+// Detect looks for .fvmrc, .fvm/fvm_config.json or .puro.json in dir and its parents and resolves
+// the SDK the first one found pins. Without any, the flutter on the PATH is used. A pinned SDK that
+// is not installed is an error, since the global one could silently build with another version.
+func Detect(dir string) (SDK, error) {
+	for {
+		for _, detect := range []func(string) (SDK, bool, error){detectFVM, detectPuro} {
+			sdk, found, err := detect(dir)
+			if found || err != nil {
+				return sdk, err
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return SDK{}, nil
+		}
+		dir = parent
+	}
+}
+
+// detectFVM reads .fvmrc of FVM 3, or .fvm/fvm_config.json of FVM 2.
+func detectFVM(dir string) (SDK, bool, error) {
+	configs := []struct {
+		path string
+		key  string
+	}{
+		{filepath.Join(dir, ".fvmrc"), "flutter"},
+		{filepath.Join(dir, ".fvm", "fvm_config.json"), "flutterSdkVersion"},
+	}
+	for _, config := range configs {
+		version, found, err := readPin(config.path, config.key)
+		if err != nil {
+			return SDK{}, true, err
+		}
+		if !found {
+			continue
+		}
+		sdk := SDK{Manager: ManagerFVM, Version: version, Config: config.path}
+		candidates := []string{
+			filepath.Join(dir, ".fvm", "flutter_sdk"),
+			filepath.Join(dir, ".fvm", "versions", version),
+		}
+		if cache := fvmCache(); cache != "" {
+			candidates = append(candidates, filepath.Join(cache, version))
+		}
+		return resolve(sdk, candidates, "fvm install")
+	}
+	return SDK{}, false, nil
+}
+
+// detectPuro reads the environment of .puro.json.
+func detectPuro(dir string) (SDK, bool, error) {
+	path := filepath.Join(dir, ".puro.json")
+	env, found, err := readPin(path, "env")
+	if !found || err != nil {
+		return SDK{}, found, err
+	}
+	root := os.Getenv(puroRootEnvKey)
+	if root == "" {
+		home, err := homeDir()
+		if err != nil {
+			return SDK{}, true, fmt.Errorf("cannot locate the Puro environments: %w", err)
+		}
+		root = filepath.Join(home, ".puro")
+	}
+	sdk := SDK{Manager: ManagerPuro, Version: env, Config: path}
+	return resolve(sdk, []string{filepath.Join(root, "envs", env, "flutter")}, "puro create "+env)
+}
+
+// fvmCache returns the folder FVM installs versions into, empty when it cannot be told.
+func fvmCache() string {
+	if cache := os.Getenv(fvmCachePathEnvKey); cache != "" {
+		return cache
+	}
+	if home := os.Getenv(fvmHomeEnvKey); home != "" {
+		return filepath.Join(home, "versions")
+	}
+	if home, err := homeDir(); err == nil {
+		return filepath.Join(home, "fvm", "versions")
+	}
+	return ""
+}
+
+// readPin reads the string at key of the JSON file at path. found is false when the file does not exist.
+func readPin(path, key string) (string, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", true, err
+	}
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", true, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	value, _ := config[key].(string)
+	if value = strings.TrimSpace(value); value == "" {
+		return "", true, fmt.Errorf("invalid %s: %q is not set", path, key)
+	}
+	return value, true, nil
+}
+
+// resolve sets the root of sdk to the first candidate holding a flutter executable.
+func resolve(sdk SDK, candidates []string, install string) (SDK, bool, error) {
+	for _, root := range candidates {
+		if info, err := os.Stat(filepath.Join(root, "bin", "flutter")); err == nil && !info.IsDir() {
+			sdk.Root = root
+			return sdk, true, nil
+		}
+	}
+	return SDK{}, true, fmt.Errorf("Flutter %s pinned by %s in %s is not installed, run `%s` first (looked in %s)",
+		sdk.Version, sdk.Manager, sdk.Config, install, strings.Join(candidates, ", "))
+}
@@ -0,0 +1,145 @@
+package flutter_sdk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"patrol_install/commands"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useHome points the SDK caches at an empty home folder.
+func useHome(t *testing.T) string {
+	home := t.TempDir()
+	original := homeDir
+	homeDir = func() (string, error) { return home, nil }
+	t.Cleanup(func() { homeDir = original })
+	t.Setenv(fvmCachePathEnvKey, "")
+	t.Setenv(fvmHomeEnvKey, "")
+	t.Setenv(puroRootEnvKey, "")
+	return home
+}
+
+func TestDetect_FVMFromParentFolder(t *testing.T) {
+	// GIVEN an app in a monorepo whose root pins Flutter with FVM 3, installed in the FVM cache
+	home := useHome(t)
+	repo := t.TempDir()
+	app := filepath.Join(repo, "apps", "shop")
+	writeFile(t, filepath.Join(repo, ".fvmrc"), `{"flutter": "3.24.0"}`)
+	writeFile(t, filepath.Join(home, "fvm", "versions", "3.24.0", "bin", "flutter"), "")
+
+	// WHEN detecting the SDK of the app
+	sdk, err := Detect(app)
+
+	// THEN the cached version is used for every flutter command
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := filepath.Join(home, "fvm", "versions", "3.24.0", "bin", "flutter")
+	if sdk.Manager != ManagerFVM || sdk.Version != "3.24.0" || sdk.Flutter() != want {
+		t.Fatalf("unexpected SDK %+v", sdk)
+	}
+	if cmd := sdk.Command(commands.FlutterVersion); cmd.Name != want {
+		t.Fatalf("expected the pinned flutter, got %v", cmd)
+	}
+	if cmd := sdk.Command(commands.GitChangedFiles); cmd.Name != "git" {
+		t.Fatalf("expected other commands to be kept, got %v", cmd)
+	}
+}
+
+func TestCommand_PinnedDart(t *testing.T) {
+	// GIVEN a Flutter SDK pinned by FVM
+	sdk := SDK{Manager: ManagerFVM, Version: "3.24.0", Root: "/fvm/versions/3.24.0"}
+	dart := filepath.Join("/fvm/versions/3.24.0", "bin", "dart")
+
+	// WHEN resolving the Patrol CLI install and the installed patrol
+	install := sdk.Command(commands.PatrolInstall)
+	doctor := sdk.Command(commands.PatrolDoctor)
+
+	// THEN both run with the dart of the pinned SDK
+	if install.Name != dart || strings.Join(install.Args, " ") != "pub global activate patrol_cli" {
+		t.Fatalf("expected the install to use the pinned dart, got %v", install)
+	}
+	if doctor.Name != dart || strings.Join(doctor.Args, " ") != "pub global run patrol_cli doctor --verbose" {
+		t.Fatalf("expected patrol to run through the pinned dart, got %v", doctor)
+	}
+	if env := sdk.Env(); len(env) != 2 || !strings.HasPrefix(env[1], "PATH="+filepath.Join("/fvm/versions/3.24.0", "bin")+string(os.PathListSeparator)) {
+		t.Fatalf("expected the pinned SDK first on the PATH, got %v", env)
+	}
+}
+
+func TestDetect_FVM2ProjectLink(t *testing.T) {
+	// GIVEN an FVM 2 config and the SDK linked into the project
+	useHome(t)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".fvm", "fvm_config.json"), `{"flutterSdkVersion": "stable", "flavors": {}}`)
+	writeFile(t, filepath.Join(dir, ".fvm", "flutter_sdk", "bin", "flutter"), "")
+
+	// WHEN detecting the SDK
+	sdk, err := Detect(dir)
+
+	// THEN the linked SDK is used
+	if err != nil || sdk.Root != filepath.Join(dir, ".fvm", "flutter_sdk") || sdk.Version != "stable" {
+		t.Fatalf("unexpected SDK %+v, error %v", sdk, err)
+	}
+}
+
+func TestDetect_Puro(t *testing.T) {
+	// GIVEN a Puro environment in a custom Puro root
+	useHome(t)
+	dir := t.TempDir()
+	root := t.TempDir()
+	t.Setenv(puroRootEnvKey, root)
+	writeFile(t, filepath.Join(dir, ".puro.json"), `{"env": "beta"}`)
+	writeFile(t, filepath.Join(root, "envs", "beta", "flutter", "bin", "flutter"), "")
+
+	// WHEN detecting the SDK
+	sdk, err := Detect(dir)
+
+	// THEN the flutter of the environment is used
+	if err != nil || sdk.Manager != ManagerPuro || sdk.Root != filepath.Join(root, "envs", "beta", "flutter") {
+		t.Fatalf("unexpected SDK %+v, error %v", sdk, err)
+	}
+}
+
+func TestDetect_PinnedVersionNotInstalled(t *testing.T) {
+	// GIVEN a pinned version missing from the FVM cache
+	useHome(t)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".fvmrc"), `{"flutter": "3.27.1"}`)
+
+	// WHEN detecting the SDK
+	_, err := Detect(dir)
+
+	// THEN the build stops instead of using another Flutter
+	if err == nil || !strings.Contains(err.Error(), "run `fvm install` first") {
+		t.Fatalf("expected an install hint, got %v", err)
+	}
+}
+
+func TestDetect_Global(t *testing.T) {
+	// GIVEN a project pinning no Flutter version
+	useHome(t)
+
+	// WHEN detecting the SDK
+	sdk, err := Detect(t.TempDir())
+
+	// THEN the flutter on the PATH is used
+	if err != nil || sdk.Pinned() || sdk.Flutter() != "flutter" {
+		t.Fatalf("unexpected SDK %+v, error %v", sdk, err)
+	}
+	if cmd := sdk.Command(commands.PatrolDoctor); cmd.Name != "patrol" || sdk.Env() != nil {
+		t.Fatalf("expected patrol and the environment to be kept, got %v and %v", cmd, sdk.Env())
+	}
+}
@@ -1,6 +1,7 @@
 package get_cli_version
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -11,10 +12,13 @@ import (
 	"patrol_install/utils/exec"
 )
 
-var patrolDoctor = commands.PatrolDoctor
+// PatrolDoctorCmd prints the version of the installed Patrol CLI.
+var PatrolDoctorCmd = commands.PatrolDoctor
 
-func GetPatrolCLIVersion() (*v.Version, error) {
-	output, err := exec.Command(patrolDoctor)
+// GetPatrolCLIVersion reads the Patrol CLI version from the output of doctor, usually PatrolDoctorCmd
+// run through the Flutter SDK in use.
+func GetPatrolCLIVersion(ctx context.Context, doctor commands.Command) (*v.Version, error) {
+	output, err := exec.CommandContext(ctx, doctor)
 	if err != nil {
 		return nil, err
 	}
@@ -5,6 +5,7 @@ import (
 
 	"patrol_install/commands"
 	constants "patrol_install/steps/build/constants"
+	"patrol_install/steps/flutter_sdk"
 	"patrol_install/utils/exec"
 	print "patrol_install/utils/print"
 )
@@ -40,6 +41,16 @@ func InstallPatrolCLI(executor CommandExecutor) (string, error) {
 	return output, nil
 }
 
+// InstallCommandFromEnv returns the command InstallPatrolCLI runs for CUSTOM_PATROL_CLI_VERSION,
+// with the dart of the Flutter SDK pinned by FVM or Puro.
+func InstallCommandFromEnv() (commands.Command, error) {
+	sdk, err := flutter_sdk.FromEnv()
+	if err != nil {
+		return commands.Command{}, err
+	}
+	return sdk.Command(buildInstallCommand(os.Getenv(constants.CustomPatrolCLIVersion))), nil
+}
+
 // buildInstallCommand returns the appropriate Command struct based on the version.
 func buildInstallCommand(version string) commands.Command {
 	if version == "" {
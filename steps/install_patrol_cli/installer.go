@@ -1,28 +1,30 @@
 package install_patrol_cli
 
 import (
+	"context"
+
 	v "github.com/Masterminds/semver/v3"
 
 	"patrol_install/utils/print"
 )
 
 type Installer interface {
-	GetPatrolCLIVersion() (*v.Version, error)
-	InstallPatrolCLI() error
+	GetPatrolCLIVersion(ctx context.Context) (*v.Version, error)
+	InstallPatrolCLI(ctx context.Context) error
 }
 
-func Run(installer Installer) (*v.Version, error) {
+func Run(ctx context.Context, installer Installer) (*v.Version, error) {
 	print.StepInitiated("--- Checking if Patrol CLI is already installed ---")
 
-	version, err := installer.GetPatrolCLIVersion()
+	version, err := installer.GetPatrolCLIVersion(ctx)
 	if err != nil {
 		print.Warning("CLI is not installed, attempting installation...")
-		if err := installer.InstallPatrolCLI(); err != nil {
+		if err := installer.InstallPatrolCLI(ctx); err != nil {
 			print.Error("❌ Installation failed: " + err.Error())
 			return nil, err
 		}
 
-		version, err = installer.GetPatrolCLIVersion()
+		version, err = installer.GetPatrolCLIVersion(ctx)
 		if err != nil {
 			print.Error("❌ Failed to verify version after install: " + err.Error())
 			return nil, err
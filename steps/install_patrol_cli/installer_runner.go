@@ -1,19 +1,51 @@
 package install_patrol_cli
 
 import (
+	"context"
+
+	"patrol_install/commands"
+	build_constants "patrol_install/steps/build/constants"
+	"patrol_install/steps/flutter_sdk"
 	get_cli_version "patrol_install/steps/install_patrol_cli/get_cli_version"
 	install_cli_tool "patrol_install/steps/install_patrol_cli/install_cli_tool"
+	"patrol_install/utils/exec"
+	"patrol_install/utils/failure"
+	"patrol_install/utils/retry"
 
 	v "github.com/Masterminds/semver/v3"
 )
 
 type InstallerRunner struct{}
 
-func (p *InstallerRunner) GetPatrolCLIVersion() (*v.Version, error) {
-	return get_cli_version.GetPatrolCLIVersion()
+// GetPatrolCLIVersion reads the version of the Patrol CLI run by the dart of the Flutter SDK pinned
+// by FVM or Puro, else the patrol on the PATH.
+func (p *InstallerRunner) GetPatrolCLIVersion(ctx context.Context) (*v.Version, error) {
+	sdk, err := flutter_sdk.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return get_cli_version.GetPatrolCLIVersion(ctx, sdk.Command(get_cli_version.PatrolDoctorCmd))
 }
 
-func (p *InstallerRunner) InstallPatrolCLI() error {
-	_, err := install_cli_tool.InstallPatrolCLI(nil)
-	return err
+// InstallPatrolCLI installs the Patrol CLI with the dart of the Flutter SDK pinned by FVM or Puro,
+// retrying when the failure looks transient (e.g. pub.dev unreachable).
+func (p *InstallerRunner) InstallPatrolCLI(ctx context.Context) error {
+	policy, err := retry.PolicyFromEnv(build_constants.RetryCount, build_constants.RetryInitialDelay)
+	if err != nil {
+		return err
+	}
+	sdk, err := flutter_sdk.FromEnv()
+	if err != nil {
+		return err
+	}
+	executor := func(cmd commands.Command) (string, error) {
+		return exec.CommandContext(ctx, sdk.Command(cmd))
+	}
+	return retry.Do(ctx, "Patrol CLI install", policy, func() error {
+		output, err := install_cli_tool.InstallPatrolCLI(executor)
+		if err != nil {
+			return failure.Wrap(err, failure.Classify(output+"\n"+err.Error()))
+		}
+		return nil
+	})
 }
@@ -0,0 +1,146 @@
+package test_discovery
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	build_constants "patrol_install/steps/build/constants"
+	tag_expression "patrol_install/steps/build/models/tag_expression"
+)
+
+const (
+	pubspecPath = "pubspec.yaml"
+	testSuffix  = "_test.dart"
+	// bundleFileName is the entrypoint Patrol generates in the test directory; it declares no test itself.
+	bundleFileName = "test_bundle.dart"
+)
+
+// DefaultTestDirectories are searched in order when neither the input nor pubspec.yaml names one.
+var DefaultTestDirectories = []string{"patrol_test", "integration_test"}
+
+// RootsFromEnv returns the test files and folders the build targets: the comma separated
+// TEST_TARGET_DIRECTORY, else the patrol test_directory of pubspec.yaml, else the first existing
+// default test directory.
+func RootsFromEnv() []string {
+	var roots []string
+	for _, target := range strings.Split(os.Getenv(build_constants.TestTargetDirectory), ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			roots = append(roots, target)
+		}
+	}
+	if len(roots) > 0 {
+		return roots
+	}
+	if directory := pubspecTestDirectory(pubspecPath); directory != "" {
+		return []string{directory}
+	}
+	for _, directory := range DefaultTestDirectories {
+		if info, err := os.Stat(directory); err == nil && info.IsDir() {
+			return []string{directory}
+		}
+	}
+	return []string{DefaultTestDirectories[0]}
+}
+
+// DiscoverFromEnv returns the tests declared under RootsFromEnv.
+func DiscoverFromEnv() ([]Test, error) {
+	return Discover(RootsFromEnv())
+}
+
+// Discover returns the tests declared in every *_test.dart file under roots, ordered by file and
+// position. A root may also be a single Dart file.
+func Discover(roots []string) ([]Test, error) {
+	files, err := Files(roots)
+	if err != nil {
+		return nil, err
+	}
+
+	var tests []Test
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, scanSource(file, string(src))...)
+	}
+	return tests, nil
+}
+
+// Files returns the *_test.dart files under roots as sorted, slash separated paths without
+// duplicates. A root may also be a single Dart file.
+func Files(roots []string) ([]string, error) {
+	var files []string
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan tests in %s: %w", root, err)
+		}
+		if !info.IsDir() {
+			files = append(files, filepath.ToSlash(root))
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), testSuffix) && d.Name() != bundleFileName {
+				files = append(files, filepath.ToSlash(path))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan tests in %s: %w", root, err)
+		}
+	}
+	sort.Strings(files)
+	return slices.Compact(files), nil
+}
+
+// KnownTags returns every tag used by tests, sorted.
+func KnownTags(tests []Test) []string {
+	var tags []string
+	for _, test := range tests {
+		tags = append(tags, test.Tags...)
+	}
+	return uniqueSorted(tags)
+}
+
+// pubspecTestDirectory reads patrol.test_directory from the pubspec, empty when it is not set.
+func pubspecTestDirectory(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var pubspec struct {
+		Patrol struct {
+			TestDirectory string `yaml:"test_directory"`
+		} `yaml:"patrol"`
+	}
+	if err := yaml.Unmarshal(data, &pubspec); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(pubspec.Patrol.TestDirectory)
+}
+
+// Filter returns the tests selected by include and not matched by exclude, as `patrol build`
+// selects them with --tags and --excludedTags. A nil expression does not filter.
+func Filter(tests []Test, include, exclude *tag_expression.Expression) []Test {
+	var selected []Test
+	for _, test := range tests {
+		if include != nil && !include.Match(test.Tags) {
+			continue
+		}
+		if exclude != nil && exclude.Match(test.Tags) {
+			continue
+		}
+		selected = append(selected, test)
+	}
+	return selected
+}
@@ -0,0 +1,80 @@
+package test_discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	build_constants "patrol_install/steps/build/constants"
+	tag_expression "patrol_install/steps/build/models/tag_expression"
+)
+
+// chdir runs the test in dir, restoring the working directory afterwards.
+func chdir(t *testing.T, dir string) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestRootsFromEnv(t *testing.T) {
+	// GIVEN a project configuring its Patrol test directory in pubspec.yaml
+	chdir(t, t.TempDir())
+	writeFile(t, "pubspec.yaml", "name: my_app\npatrol:\n  app_name: My App\n  test_directory: e2e\n")
+	t.Setenv(build_constants.TestTargetDirectory, "")
+
+	// WHEN resolving the roots with and without targets
+	fromPubspec := RootsFromEnv()
+	t.Setenv(build_constants.TestTargetDirectory, "e2e/a_test.dart, e2e/b_test.dart")
+	fromInput := RootsFromEnv()
+
+	// THEN the input wins over the pubspec
+	if len(fromPubspec) != 1 || fromPubspec[0] != "e2e" {
+		t.Fatalf("expected the pubspec test directory, got %v", fromPubspec)
+	}
+	if len(fromInput) != 2 || fromInput[1] != "e2e/b_test.dart" {
+		t.Fatalf("expected the targets, got %v", fromInput)
+	}
+}
+
+func TestDiscover_FiltersByTags(t *testing.T) {
+	// GIVEN a test directory with the generated bundle and two test files
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "test_bundle.dart"), "void main() { group('login_test', () {}); }")
+	writeFile(t, filepath.Join(dir, "login_test.dart"), "void main() { patrolTest('logs in', tags: ['smoke'], ($) async {}); }")
+	writeFile(t, filepath.Join(dir, "flows", "checkout_test.dart"), "void main() { patrolTest('pays', tags: ['smoke', 'flaky'], ($) async {}); }")
+	writeFile(t, filepath.Join(dir, "helpers.dart"), "void main() { patrolTest('helper', ($) async {}); }")
+
+	// WHEN discovering and filtering the tests
+	tests, err := Discover([]string{dir})
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	include, _ := tag_expression.Parse("smoke")
+	exclude, _ := tag_expression.Parse("flaky")
+	selected := Filter(tests, include, exclude)
+
+	// THEN only test files are scanned and the filters apply like patrol build
+	if len(tests) != 2 || tests[0].Name != "pays" || tests[1].Name != "logs in" {
+		t.Fatalf("unexpected tests %+v", tests)
+	}
+	if len(selected) != 1 || selected[0].Name != "logs in" {
+		t.Fatalf("unexpected selection %+v", selected)
+	}
+	if tags := KnownTags(tests); len(tags) != 2 || tags[0] != "flaky" {
+		t.Fatalf("unexpected known tags %v", tags)
+	}
+}
@@ -0,0 +1,74 @@
+package test_discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	build_constants "patrol_install/steps/build/constants"
+	tag_expression "patrol_install/steps/build/models/tag_expression"
+)
+
+// InventoryFileName is the name of the inventory written next to the exported artifacts.
+const InventoryFileName = "test_inventory.json"
+
+// Inventory lists the tests a build bundles, after the tag filters passed to `patrol build`.
+type Inventory struct {
+	// Tags and ExcludedTags are the filters in canonical form, empty when not set.
+	Tags         string `json:"tags,omitempty"`
+	ExcludedTags string `json:"excludedTags,omitempty"`
+	// Discovered counts the tests found before filtering.
+	Discovered int             `json:"discovered"`
+	Tests      []InventoryTest `json:"tests"`
+}
+
+// InventoryTest is a test of the inventory with the full name device farms select it by.
+type InventoryTest struct {
+	FullName string `json:"fullName"`
+	Test
+}
+
+// NewInventory filters tests with include and exclude.
+func NewInventory(tests []Test, include, exclude *tag_expression.Expression) *Inventory {
+	inventory := &Inventory{Discovered: len(tests), Tests: []InventoryTest{}}
+	if include != nil {
+		inventory.Tags = include.String()
+	}
+	if exclude != nil {
+		inventory.ExcludedTags = exclude.String()
+	}
+	for _, test := range Filter(tests, include, exclude) {
+		inventory.Tests = append(inventory.Tests, InventoryTest{FullName: test.FullName(), Test: test})
+	}
+	return inventory
+}
+
+// InventoryFromEnv discovers the tests under RootsFromEnv and filters them with TAGS and EXCLUDED_TAGS.
+func InventoryFromEnv() (*Inventory, error) {
+	include, err := tag_expression.Parse(os.Getenv(build_constants.Tags))
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := tag_expression.Parse(os.Getenv(build_constants.ExcludedTags))
+	if err != nil {
+		return nil, err
+	}
+	tests, err := DiscoverFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewInventory(tests, include, exclude), nil
+}
+
+// Save writes the inventory as JSON, creating parent folders as needed.
+func (i *Inventory) Save(path string) error {
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create folder for %s: %w", path, err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
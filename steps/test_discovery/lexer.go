@@ -0,0 +1,156 @@
+package test_discovery
+
+import "strings"
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenPunct
+)
+
+// token is a Dart token. String tokens hold the literal contents without quotes; escapes and
+// interpolations are kept as written.
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// lexer splits Dart source into the identifiers, string literals and punctuation the scanner
+// needs. Comments and whitespace are dropped; numbers and operators come out as punctuation.
+type lexer struct {
+	src    string
+	pos    int
+	line   int
+	tokens []token
+}
+
+func tokenize(src string) []token {
+	l := &lexer{src: src, line: 1}
+	for l.pos < len(l.src) {
+		l.next()
+	}
+	return l.tokens
+}
+
+func (l *lexer) next() {
+	c := l.src[l.pos]
+	switch {
+	case c == '\n':
+		l.line++
+		l.pos++
+	case c == ' ' || c == '\t' || c == '\r':
+		l.pos++
+	case strings.HasPrefix(l.src[l.pos:], "//"):
+		for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+			l.pos++
+		}
+	case strings.HasPrefix(l.src[l.pos:], "/*"):
+		l.skipBlockComment()
+	case c == 'r' && l.pos+1 < len(l.src) && (l.src[l.pos+1] == '\'' || l.src[l.pos+1] == '"'):
+		l.pos++
+		l.readString(true)
+	case c == '\'' || c == '"':
+		l.readString(false)
+	case isIdentStart(c):
+		start := l.pos
+		for l.pos < len(l.src) && isIdentPart(l.src[l.pos]) {
+			l.pos++
+		}
+		l.tokens = append(l.tokens, token{kind: tokenIdent, text: l.src[start:l.pos], line: l.line})
+	default:
+		l.tokens = append(l.tokens, token{kind: tokenPunct, text: string(c), line: l.line})
+		l.pos++
+	}
+}
+
+// skipBlockComment skips a block comment; Dart block comments nest.
+func (l *lexer) skipBlockComment() {
+	depth := 0
+	for l.pos < len(l.src) {
+		switch {
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			depth++
+			l.pos += 2
+		case strings.HasPrefix(l.src[l.pos:], "*/"):
+			depth--
+			l.pos += 2
+			if depth == 0 {
+				return
+			}
+		default:
+			if l.src[l.pos] == '\n' {
+				l.line++
+			}
+			l.pos++
+		}
+	}
+}
+
+// readString reads a single, double or triple quoted literal starting at the opening quote.
+func (l *lexer) readString(raw bool) {
+	line := l.line
+	quote := l.src[l.pos : l.pos+1]
+	if strings.HasPrefix(l.src[l.pos:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	l.pos += len(quote)
+	start := l.pos
+	for l.pos < len(l.src) {
+		switch {
+		case strings.HasPrefix(l.src[l.pos:], quote):
+			l.tokens = append(l.tokens, token{kind: tokenString, text: l.src[start:l.pos], line: line})
+			l.pos += len(quote)
+			return
+		case l.src[l.pos] == '\n' && len(quote) == 1:
+			// Unterminated literal: stop at the end of the line like the Dart analyzer does.
+			l.tokens = append(l.tokens, token{kind: tokenString, text: l.src[start:l.pos], line: line})
+			return
+		case l.src[l.pos] == '\\' && !raw:
+			l.pos += 2
+		case strings.HasPrefix(l.src[l.pos:], "${") && !raw:
+			l.skipInterpolation()
+		default:
+			if l.src[l.pos] == '\n' {
+				l.line++
+			}
+			l.pos++
+		}
+	}
+	l.tokens = append(l.tokens, token{kind: tokenString, text: l.src[start:], line: line})
+}
+
+// skipInterpolation skips ${...}, including nested braces and string literals.
+func (l *lexer) skipInterpolation() {
+	l.pos += 2
+	depth := 1
+	for l.pos < len(l.src) && depth > 0 {
+		switch c := l.src[l.pos]; c {
+		case '{':
+			depth++
+			l.pos++
+		case '}':
+			depth--
+			l.pos++
+		case '\'', '"':
+			saved := len(l.tokens)
+			l.readString(false)
+			l.tokens = l.tokens[:saved]
+		case '\n':
+			l.line++
+			l.pos++
+		default:
+			l.pos++
+		}
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
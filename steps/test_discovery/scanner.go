@@ -0,0 +1,190 @@
+package test_discovery
+
+import (
+	"sort"
+	"strings"
+)
+
+// Calls recognised as tests and groups.
+const (
+	testFunction  = "patrolTest"
+	groupFunction = "group"
+)
+
+// Test is a patrolTest call found in a test file.
+type Test struct {
+	// Name is the description passed to patrolTest, as written; interpolations are not resolved.
+	Name string `json:"name"`
+	// Groups are the descriptions of the enclosing group calls, outermost first.
+	Groups []string `json:"groups,omitempty"`
+	File   string   `json:"file"`
+	Line   int      `json:"line"`
+	// Tags are the tags of the test, including those of its groups and of the file's @Tags annotation.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// FullName is the name package:test reports: the group descriptions and the test name joined by spaces.
+func (t Test) FullName() string {
+	return strings.Join(append(append([]string(nil), t.Groups...), t.Name), " ")
+}
+
+// call is a test or group call with the token range of its arguments.
+type call struct {
+	function    string
+	name        string
+	tags        []string
+	line        int
+	open, close int
+}
+
+// scanSource returns the tests declared in the Dart source of file.
+func scanSource(file, src string) []Test {
+	tokens := tokenize(src)
+	matching := matchBrackets(tokens)
+
+	fileTags := annotationTags(tokens, matching)
+	var groups []call
+	var tests []Test
+	for i := 0; i+1 < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind != tokenIdent || (t.text != testFunction && t.text != groupFunction) || tokens[i+1].text != "(" {
+			continue
+		}
+		// Skip declarations such as `void group(` and member calls such as `tester.group(`.
+		if i > 0 && (tokens[i-1].kind == tokenIdent || tokens[i-1].text == ".") {
+			continue
+		}
+		c, ok := parseCall(tokens, matching, i)
+		if !ok {
+			continue
+		}
+		if c.function == groupFunction {
+			groups = append(groups, c)
+			continue
+		}
+
+		test := Test{Name: c.name, File: file, Line: c.line}
+		tags := append([]string(nil), fileTags...)
+		for _, g := range groups {
+			if g.open < c.open && c.close < g.close {
+				test.Groups = append(test.Groups, g.name)
+				tags = append(tags, g.tags...)
+			}
+		}
+		test.Tags = uniqueSorted(append(tags, c.tags...))
+		tests = append(tests, test)
+	}
+	return tests
+}
+
+// parseCall reads the description and tags of the call whose name is tokens[i].
+func parseCall(tokens []token, matching map[int]int, i int) (call, bool) {
+	open := i + 1
+	close, ok := matching[open]
+	if !ok {
+		return call{}, false
+	}
+	c := call{function: tokens[i].text, line: tokens[i].line, open: open, close: close}
+
+	j := open + 1
+	var name []string
+	for ; j < close && tokens[j].kind == tokenString; j++ {
+		name = append(name, tokens[j].text)
+	}
+	if len(name) == 0 {
+		return call{}, false
+	}
+	c.name = strings.Join(name, "")
+
+	for ; j < close; j++ {
+		if end, nested := matching[j]; nested {
+			j = end
+			continue
+		}
+		if tokens[j].kind == tokenIdent && tokens[j].text == "tags" && j+1 < close && tokens[j+1].text == ":" {
+			c.tags = literalStrings(tokens, matching, j+2, close)
+		}
+	}
+	return c, true
+}
+
+// literalStrings returns the strings of the value starting at tokens[start]: a single string or a
+// list or set literal of strings, optionally const and type annotated.
+func literalStrings(tokens []token, matching map[int]int, start, limit int) []string {
+	j := start
+	for j < limit && (tokens[j].text == "const" || tokens[j].text == "<" || tokens[j].text == ">" || tokens[j].text == "String") {
+		j++
+	}
+	if j >= limit {
+		return nil
+	}
+	if tokens[j].kind == tokenString {
+		return []string{tokens[j].text}
+	}
+	end, ok := matching[j]
+	if !ok || (tokens[j].text != "[" && tokens[j].text != "{") {
+		return nil
+	}
+	var values []string
+	for k := j + 1; k < end; k++ {
+		if tokens[k].kind == tokenString {
+			values = append(values, tokens[k].text)
+		}
+	}
+	return values
+}
+
+// annotationTags returns the tags of a library level @Tags([...]) annotation.
+func annotationTags(tokens []token, matching map[int]int) []string {
+	for i := 0; i+2 < len(tokens); i++ {
+		if tokens[i].text == "@" && tokens[i+1].text == "Tags" && tokens[i+2].text == "(" {
+			if close, ok := matching[i+2]; ok {
+				return literalStrings(tokens, matching, i+3, close)
+			}
+		}
+	}
+	return nil
+}
+
+// matchBrackets maps the index of each opening (, [ and { to the index of its closing bracket.
+func matchBrackets(tokens []token) map[int]int {
+	pairs := map[string]string{")": "(", "]": "[", "}": "{"}
+	matching := map[int]int{}
+	var stack []int
+	for i, t := range tokens {
+		if t.kind != tokenPunct {
+			continue
+		}
+		switch t.text {
+		case "(", "[", "{":
+			stack = append(stack, i)
+		case ")", "]", "}":
+			// Unbalanced source: drop openers until the matching kind so the rest still pairs up.
+			for len(stack) > 0 {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if tokens[top].text == pairs[t.text] {
+					matching[top] = i
+					break
+				}
+			}
+		}
+	}
+	return matching
+}
+
+func uniqueSorted(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	set := map[string]bool{}
+	for _, value := range values {
+		set[value] = true
+	}
+	unique := make([]string, 0, len(set))
+	for value := range set {
+		unique = append(unique, value)
+	}
+	sort.Strings(unique)
+	return unique
+}
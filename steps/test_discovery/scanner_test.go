@@ -0,0 +1,66 @@
+package test_discovery
+
+import (
+	"strings"
+	"testing"
+)
+
+const loginTestSource = `
+@Tags(['e2e'])
+library;
+
+import 'package:patrol/patrol.dart';
+
+/* a block comment /* nested */ with patrolTest('not a test') inside */
+void main() {
+  // patrolTest('commented out', ($) async {});
+  group('login', () {
+    patrolTest(
+      'signs in with ' 'valid credentials',
+      tags: const <String>['smoke', 'android'],
+      ($) async {
+        await $('Sign in \'now\'').tap();
+      },
+    );
+
+    group("errors", () {
+      patrolTest('shows ${error.message} on failure', tags: 'critical', ($) async {
+        final text = '''
+patrolTest('inside a string', ($) async {});
+''';
+      });
+    }, tags: ['slow']);
+  }, tags: {'auth'});
+
+  patrolTest(r'raw \name', ($) async {});
+}
+
+void group(String name) {}
+`
+
+func TestScanSource(t *testing.T) {
+	// GIVEN a test file with nested groups, comments, strings and several tag forms
+	// WHEN scanning it
+	tests := scanSource("patrol_test/login_test.dart", loginTestSource)
+
+	// THEN every patrolTest is found with its groups and inherited tags
+	type want struct {
+		fullName string
+		tags     string
+		line     int
+	}
+	wants := []want{
+		{"login signs in with valid credentials", "android,auth,e2e,smoke", 11},
+		{"login errors shows ${error.message} on failure", "auth,critical,e2e,slow", 20},
+		{`raw \name`, "e2e", 28},
+	}
+	if len(tests) != len(wants) {
+		t.Fatalf("expected %d tests, got %+v", len(wants), tests)
+	}
+	for i, w := range wants {
+		got := tests[i]
+		if got.FullName() != w.fullName || strings.Join(got.Tags, ",") != w.tags || got.Line != w.line || got.File != "patrol_test/login_test.dart" {
+			t.Fatalf("test %d: expected %+v, got %+v (full name %q)", i, w, got, got.FullName())
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package test_sharding
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	build_constants "patrol_install/steps/build/constants"
+	"patrol_install/steps/test_discovery"
+	print "patrol_install/utils/print"
+)
+
+// PlanFileName is the name of the shard plan written next to the exported artifacts.
+const PlanFileName = "shard_plan.json"
+
+// MaxShards caps SHARD_COUNT.
+const MaxShards = 100
+
+// Strategies recorded in the plan.
+const (
+	StrategyCount   = "count"
+	StrategyTimings = "timings"
+)
+
+// defaultSeconds is the duration assumed for every test when the timings file knows none of them.
+const defaultSeconds = 60
+
+// Shard is the set of tests one device runs.
+type Shard struct {
+	// Index counts from 1.
+	Index int      `json:"index"`
+	Tests []string `json:"tests"`
+	// Files are the test files holding the tests and no other, usable as `patrol build --target`.
+	Files []string `json:"files"`
+	// Filter is a regular expression matching the full name of every test of the shard and no other.
+	Filter           string  `json:"filter"`
+	EstimatedSeconds float64 `json:"estimatedSeconds,omitempty"`
+}
+
+// Plan splits the tests of a build into shards.
+type Plan struct {
+	Strategy string  `json:"strategy"`
+	Shards   []Shard `json:"shards"`
+}
+
+// Settings are the sharding inputs.
+type Settings struct {
+	// Count is the number of shards, 0 when sharding is disabled.
+	Count       int
+	TimingsFile string
+}
+
+// SettingsFromEnv reads SHARD_COUNT and SHARD_TIMINGS_FILE.
+func SettingsFromEnv() (Settings, error) {
+	settings := Settings{TimingsFile: strings.TrimSpace(os.Getenv(build_constants.ShardTimingsFile))}
+	if value := strings.TrimSpace(os.Getenv(build_constants.ShardCount)); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 || count > MaxShards {
+			return Settings{}, fmt.Errorf("invalid value for %s: expected a number between 0 and %d", build_constants.ShardCount, MaxShards)
+		}
+		settings.Count = count
+	}
+	return settings, nil
+}
+
+// LoadTimings reads a JSON object mapping full test names to durations in seconds.
+func LoadTimings(path string) (map[string]float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	timings := map[string]float64{}
+	if err := json.Unmarshal(data, &timings); err != nil {
+		return nil, fmt.Errorf("invalid timings file %s: expected an object of test names and seconds: %w", path, err)
+	}
+	return timings, nil
+}
+
+// New splits tests into count shards. Every test file is assigned whole to one shard, so the files
+// of a shard hold exactly its tests and can be built as its target. Files are placed, largest
+// first, on the least loaded shard: without timings a file weighs its number of tests, with timings
+// the sum of their durations, tests missing from timings counting as the average known duration.
+// Never more shards than test files are planned.
+func New(tests []test_discovery.Test, count int, timings map[string]float64) *Plan {
+	var files []string
+	members := map[string][]int{}
+	for i, test := range tests {
+		if _, ok := members[test.File]; !ok {
+			files = append(files, test.File)
+		}
+		members[test.File] = append(members[test.File], i)
+	}
+
+	plan := &Plan{Strategy: StrategyCount}
+	durations := make([]float64, len(tests))
+	for i := range durations {
+		durations[i] = 1
+	}
+	if len(timings) > 0 {
+		plan.Strategy = StrategyTimings
+		durations = estimate(tests, timings)
+	}
+	weights := make(map[string]float64, len(files))
+	for _, file := range files {
+		for _, i := range members[file] {
+			weights[file] += durations[i]
+		}
+	}
+
+	order := append([]string(nil), files...)
+	sort.SliceStable(order, func(a, b int) bool { return weights[order[a]] > weights[order[b]] })
+	count = min(count, len(files))
+	assigned := make([][]int, count)
+	loads := make([]float64, count)
+	for _, file := range order {
+		lightest := 0
+		for shard := range loads {
+			if loads[shard] < loads[lightest] {
+				lightest = shard
+			}
+		}
+		loads[lightest] += weights[file]
+		assigned[lightest] = append(assigned[lightest], members[file]...)
+	}
+
+	for shard, indexes := range assigned {
+		sort.Ints(indexes)
+		planned := newShard(shard+1, tests, indexes)
+		if plan.Strategy == StrategyTimings {
+			planned.EstimatedSeconds = loads[shard]
+		}
+		plan.Shards = append(plan.Shards, planned)
+	}
+	return plan
+}
+
+// estimate returns the expected duration of each test.
+func estimate(tests []test_discovery.Test, timings map[string]float64) []float64 {
+	var total float64
+	var known int
+	for _, test := range tests {
+		if seconds, ok := timings[test.FullName()]; ok {
+			total += seconds
+			known++
+		}
+	}
+	fallback := float64(defaultSeconds)
+	if known > 0 {
+		fallback = total / float64(known)
+	}
+	durations := make([]float64, len(tests))
+	for i, test := range tests {
+		durations[i] = fallback
+		if seconds, ok := timings[test.FullName()]; ok {
+			durations[i] = seconds
+		}
+	}
+	return durations
+}
+
+func newShard(index int, tests []test_discovery.Test, indexes []int) Shard {
+	shard := Shard{Index: index, Tests: []string{}, Files: []string{}}
+	quoted := make([]string, 0, len(indexes))
+	files := map[string]bool{}
+	for _, i := range indexes {
+		name := tests[i].FullName()
+		shard.Tests = append(shard.Tests, name)
+		quoted = append(quoted, regexp.QuoteMeta(name))
+		if !files[tests[i].File] {
+			files[tests[i].File] = true
+			shard.Files = append(shard.Files, tests[i].File)
+		}
+	}
+	shard.Filter = "^(?:" + strings.Join(quoted, "|") + ")$"
+	return shard
+}
+
+// NewFromSettings plans the shards of tests. A timings file that does not exist yet, e.g. on the
+// first run before any timing was cached, falls back to sharding by count.
+func NewFromSettings(tests []test_discovery.Test, settings Settings) (*Plan, error) {
+	var timings map[string]float64
+	if settings.TimingsFile != "" {
+		var err error
+		timings, err = LoadTimings(settings.TimingsFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			print.Warning(fmt.Sprintf("Timings file %s not found, sharding by test count", settings.TimingsFile))
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if files := countFiles(tests); settings.Count > files {
+		print.Warning(fmt.Sprintf("%d shards requested for %d test files, planning %d", settings.Count, files, files))
+	}
+	return New(tests, settings.Count, timings), nil
+}
+
+func countFiles(tests []test_discovery.Test) int {
+	files := map[string]bool{}
+	for _, test := range tests {
+		files[test.File] = true
+	}
+	return len(files)
+}
+
+// Save writes the plan as JSON, creating parent folders as needed.
+func (p *Plan) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create folder for %s: %w", path, err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,131 @@
+package test_sharding
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	build_constants "patrol_install/steps/build/constants"
+	"patrol_install/steps/test_discovery"
+)
+
+func suite(names ...string) []test_discovery.Test {
+	tests := make([]test_discovery.Test, len(names))
+	for i, name := range names {
+		tests[i] = test_discovery.Test{Name: name, Groups: []string{"app"}, File: "patrol_test/" + strings.Fields(name)[0] + "_test.dart"}
+	}
+	return tests
+}
+
+func TestNew_ByCount(t *testing.T) {
+	// GIVEN five tests across three files
+	tests := suite("login works", "login fails", "checkout (card)", "checkout invoice", "profile edit")
+
+	// WHEN splitting them into two shards without timings
+	plan := New(tests, 2, nil)
+
+	// THEN whole files are balanced by their number of tests
+	if plan.Strategy != StrategyCount || len(plan.Shards) != 2 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	first, second := plan.Shards[0], plan.Shards[1]
+	if len(first.Tests) != 3 || len(second.Tests) != 2 || second.Index != 2 {
+		t.Fatalf("unexpected shard sizes %+v", plan.Shards)
+	}
+	if strings.Join(first.Files, ",") != "patrol_test/login_test.dart,patrol_test/profile_test.dart" {
+		t.Fatalf("unexpected files %v", first.Files)
+	}
+	filter := regexp.MustCompile(second.Filter)
+	if !filter.MatchString("app checkout (card)") || filter.MatchString("app login works") || filter.MatchString("app checkout (card) again") {
+		t.Fatalf("filter %s does not select exactly the shard", second.Filter)
+	}
+}
+
+func TestNew_KeepsFilesWhole(t *testing.T) {
+	// GIVEN a file of two long tests and two files of short ones
+	tests := suite("checkout card", "checkout invoice", "login works", "profile edit")
+	timings := map[string]float64{"app checkout card": 60, "app checkout invoice": 60, "app login works": 50, "app profile edit": 50}
+
+	// WHEN splitting them into three shards by timings
+	plan := New(tests, 3, timings)
+
+	// THEN the tests of a file share its shard, and its files hold no other test
+	if len(plan.Shards) != 3 || strings.Join(plan.Shards[0].Tests, ",") != "app checkout card,app checkout invoice" {
+		t.Fatalf("unexpected plan %+v", plan.Shards)
+	}
+	for _, shard := range plan.Shards {
+		if len(shard.Files) != 1 {
+			t.Fatalf("expected one file per shard, got %+v", shard)
+		}
+	}
+	if plan.Shards[0].EstimatedSeconds != 120 {
+		t.Fatalf("unexpected estimate %+v", plan.Shards[0])
+	}
+}
+
+func TestNew_ByTimings(t *testing.T) {
+	// GIVEN one long test, three short ones and one without a recorded duration
+	tests := suite("a long", "b short", "c short", "d short", "e unknown")
+	timings := map[string]float64{"app a long": 90, "app b short": 30, "app c short": 30, "app d short": 30, "app removed": 500}
+
+	// WHEN splitting them into two shards
+	plan := New(tests, 2, timings)
+
+	// THEN the longest tests are placed first on the least loaded shard, the unknown one counting as the 45s average
+	if plan.Strategy != StrategyTimings {
+		t.Fatalf("unexpected strategy %s", plan.Strategy)
+	}
+	if strings.Join(plan.Shards[0].Tests, ",") != "app a long,app d short" || plan.Shards[0].EstimatedSeconds != 120 {
+		t.Fatalf("unexpected first shard %+v", plan.Shards[0])
+	}
+	if len(plan.Shards[1].Tests) != 3 || plan.Shards[1].EstimatedSeconds != 105 {
+		t.Fatalf("unexpected second shard %+v", plan.Shards[1])
+	}
+}
+
+func TestNew_NeverMoreShardsThanFiles(t *testing.T) {
+	// GIVEN three tests in two files
+	// WHEN asking for five shards
+	plan := New(suite("a one", "a two", "b three"), 5, nil)
+
+	// THEN every shard holds a file
+	if len(plan.Shards) != 2 || len(plan.Shards[1].Tests) != 1 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+}
+
+func TestNewFromSettings_MissingTimingsFile(t *testing.T) {
+	// GIVEN a timings file that was not cached yet
+	settings := Settings{Count: 2, TimingsFile: filepath.Join(t.TempDir(), "timings.json")}
+
+	// WHEN planning
+	plan, err := NewFromSettings(suite("a one", "b two", "c three"), settings)
+
+	// THEN the tests are sharded by count
+	if err != nil || plan.Strategy != StrategyCount {
+		t.Fatalf("expected a plan by count, got %+v, %v", plan, err)
+	}
+
+	// AND an invalid timings file is reported
+	if err := os.WriteFile(settings.TimingsFile, []byte(`["a one"]`), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := NewFromSettings(suite("a one"), settings); err == nil || !strings.Contains(err.Error(), "invalid timings file") {
+		t.Fatalf("expected an invalid timings file error, got %v", err)
+	}
+}
+
+func TestSettingsFromEnv_Invalid(t *testing.T) {
+	// GIVEN a shard count out of range
+	t.Setenv(build_constants.ShardCount, "101")
+
+	// WHEN reading the settings
+	_, err := SettingsFromEnv()
+
+	// THEN it is rejected
+	if err == nil || !strings.Contains(err.Error(), build_constants.ShardCount) {
+		t.Fatalf("expected an invalid shard count error, got %v", err)
+	}
+}
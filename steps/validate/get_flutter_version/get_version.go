@@ -1,7 +1,11 @@
 package get_flutter_version
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 
 	v "github.com/Masterminds/semver/v3"
@@ -11,7 +15,36 @@ import (
 	"patrol_install/utils/exec"
 )
 
-var FlutterVersionCmd = commands.FlutterVersion
+var (
+	FlutterVersionCmd        = commands.FlutterVersion
+	FlutterVersionMachineCmd = commands.FlutterVersionMachine
+)
+
+// unsupportedMachine matches the error of a flutter too old to know --machine.
+var unsupportedMachine = regexp.MustCompile(`option named "?machine`)
+
+// errNoMachineOutput reports output of --version --machine holding no JSON object.
+var errNoMachineOutput = errors.New("no JSON object in the output")
+
+// VersionInfo describes the Flutter SDK. Only Version is known when the SDK is too old for
+// `flutter --version --machine`.
+type VersionInfo struct {
+	Version *v.Version
+	// Channel is stable, beta or master, or the branch of a custom checkout.
+	Channel         string
+	Revision        string
+	DartVersion     *v.Version
+	DevToolsVersion string
+}
+
+// machineVersion is the JSON printed by `flutter --version --machine`.
+type machineVersion struct {
+	FrameworkVersion  string `json:"frameworkVersion"`
+	Channel           string `json:"channel"`
+	FrameworkRevision string `json:"frameworkRevision"`
+	DartSdkVersion    string `json:"dartSdkVersion"`
+	DevToolsVersion   string `json:"devToolsVersion"`
+}
 
 // CleanVersion receives the command output string and extracts the version substring.
 func CleanVersion(output string) (string, error) {
@@ -32,8 +65,57 @@ func ParseVersion(versionStr string) (*v.Version, error) {
 	return parsedVersion, nil
 }
 
-func GetFlutterVersion(cmd commands.Command) (*v.Version, error) {
-	output, err := exec.Command(cmd)
+// ParseMachineOutput reads the JSON of `flutter --version --machine`. Banners and notices Flutter
+// prints around it, e.g. about analytics or running as root, are skipped.
+func ParseMachineOutput(output string) (*VersionInfo, error) {
+	start := jsonStart(output)
+	if start < 0 {
+		return nil, errNoMachineOutput
+	}
+	var machine machineVersion
+	if err := json.NewDecoder(strings.NewReader(output[start:])).Decode(&machine); err != nil {
+		return nil, fmt.Errorf("invalid flutter --version --machine output: %w", err)
+	}
+	version, err := ParseVersion(cleanVersion(machine.FrameworkVersion))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Flutter framework version %q: %w", machine.FrameworkVersion, err)
+	}
+	info := &VersionInfo{
+		Version:         version,
+		Channel:         machine.Channel,
+		Revision:        machine.FrameworkRevision,
+		DevToolsVersion: machine.DevToolsVersion,
+	}
+	if dart := dartVersion(machine.DartSdkVersion); dart != "" {
+		if info.DartVersion, err = ParseVersion(dart); err != nil {
+			return nil, fmt.Errorf("invalid Dart version %q: %w", machine.DartSdkVersion, err)
+		}
+	}
+	return info, nil
+}
+
+// GetFlutterVersion reads the SDK metadata from `flutter --version --machine`, falling back to
+// matching the version in `flutter --version` only when the SDK does not support --machine.
+func GetFlutterVersion(ctx context.Context, machineCmd, cmd commands.Command) (*VersionInfo, error) {
+	output, err := exec.CommandContext(ctx, machineCmd)
+	if err == nil {
+		info, parseErr := ParseMachineOutput(output)
+		if !errors.Is(parseErr, errNoMachineOutput) {
+			return info, parseErr
+		}
+	} else if !unsupportedMachine.MatchString(err.Error()) {
+		return nil, err
+	}
+
+	version, err := getVersionFromText(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return &VersionInfo{Version: version}, nil
+}
+
+func getVersionFromText(ctx context.Context, cmd commands.Command) (*v.Version, error) {
+	output, err := exec.CommandContext(ctx, cmd)
 	if err != nil {
 		return nil, err
 	}
@@ -55,3 +137,27 @@ func cleanVersion(version string) string {
 	version = strings.TrimPrefix(version, "v")
 	return version
 }
+
+// jsonStart returns the offset of the first line opening a JSON object, or -1.
+func jsonStart(output string) int {
+	for offset := 0; offset < len(output); {
+		line, _, _ := strings.Cut(output[offset:], "\n")
+		if strings.HasPrefix(strings.TrimSpace(line), "{") {
+			return offset + strings.Index(line, "{")
+		}
+		offset += len(line) + 1
+	}
+	return -1
+}
+
+// dartVersion returns the full Dart version, e.g. 3.6.0-216.1.beta for
+// "3.6.0 (build 3.6.0-216.1.beta)", which pre-release SDKs report.
+func dartVersion(value string) string {
+	if _, build, ok := strings.Cut(value, "(build "); ok {
+		return cleanVersion(strings.TrimSuffix(strings.TrimSpace(build), ")"))
+	}
+	if fields := strings.Fields(value); len(fields) > 0 {
+		return cleanVersion(fields[0])
+	}
+	return ""
+}
@@ -1,7 +1,11 @@
 package get_flutter_version
 
 import (
+	"context"
+	"strings"
 	"testing"
+
+	"patrol_install/commands"
 )
 
 func Test_cleanVersion(t *testing.T) {
@@ -67,3 +71,82 @@ func Test_GetVersion_regex(t *testing.T) {
 		t.Errorf("parsed version = %v, want 3.35.7", parsed)
 	}
 }
+
+func Test_ParseMachineOutput(t *testing.T) {
+	// GIVEN a beta SDK printing an analytics notice before the JSON
+	output := `Welcome to Flutter! https://flutter.dev
+The Flutter tool uses Google Analytics to anonymously report feature usage statistics.
+{
+  "frameworkVersion": "3.33.0-0.1.pre",
+  "channel": "beta",
+  "repositoryUrl": "https://github.com/flutter/flutter.git",
+  "frameworkRevision": "1425e5e9ec",
+  "engineRevision": "a3b5da0d6f",
+  "dartSdkVersion": "3.9.0 (build 3.9.0-100.2.beta)",
+  "devToolsVersion": "2.46.0",
+  "flutterRoot": "/opt/flutter"
+}`
+
+	// WHEN parsing it
+	info, err := ParseMachineOutput(output)
+
+	// THEN every field is read, keeping the pre-releases
+	if err != nil {
+		t.Fatalf("ParseMachineOutput() error: %v", err)
+	}
+	if info.Version.String() != "3.33.0-0.1.pre" || info.Channel != "beta" || info.Revision != "1425e5e9ec" ||
+		info.DartVersion.String() != "3.9.0-100.2.beta" || info.DevToolsVersion != "2.46.0" {
+		t.Errorf("unexpected info %+v", info)
+	}
+}
+
+func Test_ParseMachineOutput_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"human output", "Flutter 3.24.0 • channel stable", "no JSON object"},
+		{"broken JSON", `{"frameworkVersion": `, "invalid flutter --version --machine output"},
+		{"missing version", `{"channel": "stable"}`, "invalid Flutter framework version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseMachineOutput(tt.output)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseMachineOutput() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_GetFlutterVersion_FallsBackWithoutMachine(t *testing.T) {
+	// GIVEN an SDK rejecting --machine
+	machine := commands.Command{Name: "sh", Args: []string{"-c", `echo 'Could not find an option named "machine".' >&2; exit 64`}}
+	text := commands.Command{Name: "echo", Args: []string{"Flutter 3.22.1 • channel stable"}}
+
+	// WHEN getting the Flutter version
+	info, err := GetFlutterVersion(context.Background(), machine, text)
+
+	// THEN the version is matched in the human output
+	if err != nil {
+		t.Fatalf("GetFlutterVersion() error: %v", err)
+	}
+	if info.Version.String() != "3.22.1" || info.Channel != "" || info.DartVersion != nil {
+		t.Errorf("unexpected info %+v", info)
+	}
+}
+
+func Test_GetFlutterVersion_KeepsOtherFailures(t *testing.T) {
+	// GIVEN a machine command failing for another reason
+	machine := commands.Command{Name: "sh", Args: []string{"-c", "echo 'flutter: not found' >&2; exit 127"}}
+	text := commands.Command{Name: "echo", Args: []string{"Flutter 3.22.1"}}
+
+	// WHEN getting the Flutter version
+	_, err := GetFlutterVersion(context.Background(), machine, text)
+
+	// THEN the failure is reported instead of falling back
+	if err == nil || !strings.Contains(err.Error(), "flutter: not found") {
+		t.Errorf("expected the machine command failure, got %v", err)
+	}
+}
@@ -2,26 +2,28 @@ package get_patrol_version
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	v "github.com/Masterminds/semver/v3"
 
 	"patrol_install/commands"
-	commands_utils "patrol_install/commands/utils"
 	"patrol_install/utils/exec"
 )
 
 var FlutterPubDepsCmd = commands.FlutterPubDependencies
 
-func GetPatrolVersion(cmd commands.Command) (*v.Version, error) {
+func GetPatrolVersion(ctx context.Context, cmd commands.Command) (*v.Version, error) {
 
-	if !commands_utils.IsSameCommand(cmd, FlutterPubDepsCmd) {
+	// The name is not compared since the flutter of a pinned SDK may run it.
+	if !slices.Equal(cmd.Args, FlutterPubDepsCmd.Args) {
 		return nil, fmt.Errorf("should use FlutterPubDependencies command")
 	}
 
 	// Todo: create execture function that returns the log
-	output, err := exec.Command(cmd)
+	output, err := exec.CommandContext(ctx, cmd)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package get_patrol_version
 
 import (
+	"context"
 	"testing"
 
 	"patrol_install/commands"
@@ -85,7 +86,7 @@ func Test_GetPatrolVersionFromLog(t *testing.T) {
 func Test_GetPatrolVersion(t *testing.T) {
 	t.Run("wrong command returns error", func(t *testing.T) {
 		wrongCmd := commands.Command{Name: "echo", Args: []string{"hello"}}
-		_, err := GetPatrolVersion(wrongCmd)
+		_, err := GetPatrolVersion(context.Background(), wrongCmd)
 		if err == nil {
 			t.Error("expected error for wrong command, got nil")
 		}
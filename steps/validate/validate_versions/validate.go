@@ -8,9 +8,38 @@ type ValidateRunParams struct {
 	FlutterVersion *v.Version
 	CliVersion     *v.Version
 	PatrolVersion  *v.Version
+	// FlutterChannel and DartVersion are only known from `flutter --version --machine`.
+	FlutterChannel string
+	DartVersion    *v.Version
 }
 
+// IsPreReleaseChannel reports whether channel ships pre-releases, e.g. beta or master.
+// An unknown channel is treated as stable.
+func IsPreReleaseChannel(channel string) bool {
+	return channel != "" && channel != "stable"
+}
+
+// Compatibility is the outcome of checking versions against CompatibilityTable.
+type Compatibility int
+
+const (
+	Incompatible Compatibility = iota
+	Compatible
+	// Unverified means the versions only match an entry once the pre-release of Flutter or Dart is
+	// ignored, e.g. 3.32.0-0.1.pre on beta for an entry requiring 3.32.0. The table does not say
+	// whether pre-releases of the required version are supported.
+	Unverified
+)
+
+// CheckCompatibility reports whether the versions match an entry of CompatibilityTable.
+// A pre-release is older than its release, so it only matches entries requiring an earlier release.
 func CheckCompatibility(params ValidateRunParams) bool {
+	return Check(params) == Compatible
+}
+
+// Check compares the versions with CompatibilityTable. On a pre-release channel, versions that only
+// match an entry once their pre-release is ignored are Unverified rather than Incompatible.
+func Check(params ValidateRunParams) Compatibility {
 	flutterV := params.FlutterVersion
 	patrolCLIV := params.CliVersion
 	patrolV := params.PatrolVersion
@@ -25,14 +54,36 @@ func CheckCompatibility(params ValidateRunParams) bool {
 		panic("PatrolVersion cannot be nil in CheckCompatibility")
 	}
 
+	preRelease := IsPreReleaseChannel(params.FlutterChannel)
+	result := Incompatible
 	for _, entry := range CompatibilityTable {
-		if isVersionInRange(patrolCLIV, entry.PatrolCLIRange) &&
-			isVersionInRange(patrolV, entry.PatrolRange) &&
-			flutterV.GreaterThanEqual(entry.FlutterVersion) {
-			return true
+		if !isVersionInRange(patrolCLIV, entry.PatrolCLIRange) || !isVersionInRange(patrolV, entry.PatrolRange) {
+			continue
+		}
+		if isAtLeast(flutterV, entry.FlutterVersion) && isAtLeast(params.DartVersion, entry.DartVersion) {
+			return Compatible
 		}
+		if preRelease && isAtLeast(release(flutterV), entry.FlutterVersion) && isAtLeast(release(params.DartVersion), entry.DartVersion) {
+			result = Unverified
+		}
+	}
+	return result
+}
+
+// isAtLeast compares version with minimum. A version or minimum left unknown always passes.
+func isAtLeast(version, minimum *v.Version) bool {
+	if version == nil || minimum == nil {
+		return true
+	}
+	return version.GreaterThanEqual(minimum)
+}
+
+// release returns version without its pre-release, e.g. 3.32.0 for 3.32.0-0.1.pre.
+func release(version *v.Version) *v.Version {
+	if version == nil {
+		return nil
 	}
-	return false
+	return v.New(version.Major(), version.Minor(), version.Patch(), "", "")
 }
 
 func isVersionInRange(v *v.Version, r VersionRange) bool {
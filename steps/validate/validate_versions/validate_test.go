@@ -261,3 +261,55 @@ func TestTableCheckCompatibility(t *testing.T) {
 		})
 	}
 }
+
+func TestCheck_ChannelAndDart(t *testing.T) {
+	tests := []struct {
+		name    string
+		flutter string
+		channel string
+		dart    string
+		want    Compatibility
+	}{
+		{"stable release", "3.32.0", "stable", "3.8.0", Compatible},
+		{"pre-release on stable", "3.32.0-0.1.pre", "stable", "", Incompatible},
+		{"pre-release on beta", "3.32.0-0.1.pre", "beta", "3.8.0-278.1.beta", Unverified},
+		{"release with a pre-release Dart on beta", "3.32.0", "beta", "3.8.0-278.1.beta", Unverified},
+		{"pre-release of a later version on beta", "3.33.0-0.1.pre", "beta", "3.9.0-1.0.dev", Compatible},
+		{"pre-release older than required on beta", "3.31.0-0.1.pre", "beta", "", Incompatible},
+		{"Dart older than bundled", "3.32.0", "stable", "3.7.2", Incompatible},
+		{"Dart unknown", "3.32.0", "", "", Compatible},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GIVEN Patrol 4.0.0 with CLI 4.0.0, requiring Flutter 3.32.0 and Dart 3.8.0
+			params := ValidateRunParams{
+				FlutterVersion: v.MustParse(tt.flutter),
+				CliVersion:     v.MustParse("4.0.0"),
+				PatrolVersion:  v.MustParse("4.0.0"),
+				FlutterChannel: tt.channel,
+			}
+			if tt.dart != "" {
+				params.DartVersion = v.MustParse(tt.dart)
+			}
+
+			// WHEN checking the compatibility
+			got := Check(params)
+
+			// THEN pre-releases of the required versions are unverified, never compatible
+			if got != tt.want {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+			if CheckCompatibility(params) != (tt.want == Compatible) {
+				t.Errorf("CheckCompatibility() disagrees with Check() = %v", got)
+			}
+		})
+	}
+}
+
+func TestCompatibilityTable_HasDartVersions(t *testing.T) {
+	for _, entry := range CompatibilityTable {
+		if entry.DartVersion == nil {
+			t.Errorf("no Dart version for Flutter %s", entry.FlutterVersion)
+		}
+	}
+}
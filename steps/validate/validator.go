@@ -1,18 +1,21 @@
 package validate
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
 	v "github.com/Masterminds/semver/v3"
 
+	flutter "patrol_install/steps/validate/get_flutter_version"
 	versions "patrol_install/steps/validate/validate_versions"
 	"patrol_install/utils/print"
+	"patrol_install/utils/summary"
 )
 
 type Validator interface {
-	GetFlutterVersion() (*v.Version, error)
-	GetPatrolVersion() (*v.Version, error)
+	GetFlutterVersion(ctx context.Context) (*flutter.VersionInfo, error)
+	GetPatrolVersion(ctx context.Context) (*v.Version, error)
 }
 
 type ValidatorRunParams struct {
@@ -20,22 +23,25 @@ type ValidatorRunParams struct {
 	CliVersion *v.Version
 }
 
-func Run(params ValidatorRunParams) error {
+func Run(ctx context.Context, params ValidatorRunParams) error {
 	runner := params.Runner
 
 	print.StepInitiated("--- Getting Flutter Version ---")
 
-	flutterVersion, err := runner.GetFlutterVersion()
+	flutterInfo, err := runner.GetFlutterVersion(ctx)
 	if err != nil {
 		print.Warning("❌ Failed to get Flutter version")
 		print.Error(err.Error())
 		return err
 	}
+	flutterVersion := flutterInfo.Version
+	flutterSummary := FlutterSummary(flutterInfo)
+	summary.RecordFlutter(flutterSummary)
 
-	print.StepCompleted("✅ Flutter Version: " + flutterVersion.String() + "\n")
+	print.StepCompleted("✅ " + flutterSummary.String() + "\n")
 
 	print.StepInitiated("--- Getting Patrol Version ---")
-	patrolVersion, patrolErr := runner.GetPatrolVersion()
+	patrolVersion, patrolErr := runner.GetPatrolVersion(ctx)
 
 	if patrolErr != nil {
 		print.Warning("❌ Failed to get Patrol version")
@@ -49,20 +55,42 @@ func Run(params ValidatorRunParams) error {
 		FlutterVersion: flutterVersion,
 		CliVersion:     params.CliVersion,
 		PatrolVersion:  patrolVersion,
+		FlutterChannel: flutterInfo.Channel,
+		DartVersion:    flutterInfo.DartVersion,
 	}
 
 	print.StepInitiated("--- Checking Compatibility ---")
-	isCompatible := versions.CheckCompatibility(validatorParams)
-
-	if isCompatible {
+	switch versions.Check(validatorParams) {
+	case versions.Compatible:
 		message := fmt.Sprintf("✅ Flutter %s, Patrol CLI %s and Patrol %s are compatible",
 			flutterVersion.String(), params.CliVersion.String(), patrolVersion.String())
 		print.StepCompleted(message)
 		return nil
+	case versions.Unverified:
+		print.Warning(fmt.Sprintf("⚠️ Compatibility unverified: Flutter %s on the %s channel is a pre-release of a version the compatibility table requires for Patrol CLI %s and Patrol %s",
+			flutterVersion.String(), flutterInfo.Channel, params.CliVersion.String(), patrolVersion.String()))
+		return nil
 	}
 	errorMessage := fmt.Sprintf("❌ Flutter %s, Patrol CLI %s and Patrol %s are not compatible",
 		flutterVersion.String(), params.CliVersion.String(), patrolVersion.String())
+	if flutterInfo.DartVersion != nil {
+		errorMessage += fmt.Sprintf(" (Dart %s)", flutterInfo.DartVersion)
+	}
 	print.Error(errorMessage)
 	return errors.New(errorMessage)
 
 }
+
+// FlutterSummary describes info for the run summary.
+func FlutterSummary(info *flutter.VersionInfo) summary.Flutter {
+	flutterSummary := summary.Flutter{
+		Version:         info.Version.String(),
+		Channel:         info.Channel,
+		Revision:        info.Revision,
+		DevToolsVersion: info.DevToolsVersion,
+	}
+	if info.DartVersion != nil {
+		flutterSummary.DartVersion = info.DartVersion.String()
+	}
+	return flutterSummary
+}
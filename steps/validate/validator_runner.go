@@ -1,18 +1,32 @@
 package validate
 
 import (
+	"context"
+
 	v "github.com/Masterminds/semver/v3"
 
+	"patrol_install/steps/flutter_sdk"
 	flutter "patrol_install/steps/validate/get_flutter_version"
 	patrol "patrol_install/steps/validate/get_patrol_version"
+	"patrol_install/utils/print"
 )
 
 type ValidatorRunner struct{}
 
-func (p *ValidatorRunner) GetFlutterVersion() (*v.Version, error) {
-	return flutter.GetFlutterVersion(flutter.FlutterVersionCmd)
+// GetFlutterVersion reads the metadata of the Flutter SDK pinned by FVM or Puro, else the flutter on the PATH.
+func (p *ValidatorRunner) GetFlutterVersion(ctx context.Context) (*flutter.VersionInfo, error) {
+	sdk, err := flutter_sdk.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	print.Action("Using " + sdk.String())
+	return flutter.GetFlutterVersion(ctx, sdk.Command(flutter.FlutterVersionMachineCmd), sdk.Command(flutter.FlutterVersionCmd))
 }
 
-func (p *ValidatorRunner) GetPatrolVersion() (*v.Version, error) {
-	return patrol.GetPatrolVersion(patrol.FlutterPubDepsCmd)
+func (p *ValidatorRunner) GetPatrolVersion(ctx context.Context) (*v.Version, error) {
+	sdk, err := flutter_sdk.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return patrol.GetPatrolVersion(ctx, sdk.Command(patrol.FlutterPubDepsCmd))
 }
@@ -2,20 +2,46 @@ package exec
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
+	"strings"
 
 	"patrol_install/commands"
+	"patrol_install/utils/procgroup"
 )
 
 // / Executes a command and returns its output as a string.
+// / On failure the error includes what the command printed to stderr.
 func Command(cmd commands.Command) (string, error) {
+	return CommandContext(context.Background(), cmd)
+}
+
+// / Like Command, but stops the command and every process it started once ctx is cancelled.
+func CommandContext(ctx context.Context, cmd commands.Command) (string, error) {
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("failed to run %s %s: %w", cmd.Name, cmd.Args, procgroup.Err(ctx))
+	}
 	command := exec.Command(cmd.Name, cmd.Args...)
-	var out bytes.Buffer
+	var out, stderr bytes.Buffer
 	command.Stdout = &out
-	err := command.Run()
+	command.Stderr = &stderr
+	procgroup.Prepare(command)
+
+	err := command.Start()
+	if err == nil {
+		stopWatch := procgroup.Watch(ctx, command)
+		err = command.Wait()
+		stopWatch()
+		if err != nil && ctx.Err() != nil {
+			err = fmt.Errorf("%w: %v", procgroup.Err(ctx), err)
+		}
+	}
 
 	if err != nil {
+		if details := strings.TrimSpace(stderr.String()); details != "" {
+			return "", fmt.Errorf("failed to run %s %s: %w\n%s", command, cmd.Args, err, details)
+		}
 		return "", fmt.Errorf("failed to run %s %s: %w", command, cmd.Args, err)
 	}
 
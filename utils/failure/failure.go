@@ -0,0 +1,181 @@
+package failure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Category names a known kind of build or install failure. It is exported as an output for dashboards.
+type Category string
+
+const (
+	CategoryUnknown          Category = "unknown"
+	CategoryCodeSigning      Category = "code_signing"
+	CategoryCocoaPods        Category = "cocoapods"
+	CategoryAndroidSDK       Category = "android_sdk"
+	CategoryTestDirectory    Category = "test_directory_not_found"
+	CategoryDartCompile      Category = "dart_compile"
+	CategoryGradleDependency Category = "gradle_dependency_resolution"
+	CategoryLockContention   Category = "lock_contention"
+	CategoryNetwork          Category = "network"
+)
+
+// maxClassifiedLineBytes caps how much of a single line is matched.
+const maxClassifiedLineBytes = 8192
+
+type signature struct {
+	category Category
+	pattern  *regexp.Regexp
+	hint     string
+}
+
+// signatures are ordered by precedence: when several match, the first one names the failure.
+// Specific causes come before the generic network and lock signatures they often print alongside.
+var signatures = []signature{
+	{
+		CategoryCodeSigning,
+		regexp.MustCompile(`(?i)no profiles for|requires a provisioning profile|no signing certificate|code ?sign(ing)? error|errSecInternalComponent|provisioning profile .* (doesn't|does not)`),
+		"Check the signing certificate and provisioning profile installed on the runner, or build debug for the simulator.",
+	},
+	{
+		CategoryCocoaPods,
+		regexp.MustCompile(`(?i)CocoaPods could not find compatible versions|out-of-date source repos|pod repo update|sandbox is not in sync with the Podfile\.lock`),
+		"Run `pod install --repo-update` in the ios folder, or update CocoaPods on the runner.",
+	},
+	{
+		CategoryAndroidSDK,
+		regexp.MustCompile(`(?i)SDK location not found|ANDROID_(SDK_ROOT|HOME)\b.*(not set|invalid|does not exist)|NDK (is not installed|not configured|at .* did not have)|No version of NDK matched|Failed to find (Build Tools|Platform SDK|target with hash)`),
+		"Install the required Android SDK/NDK components or set ANDROID_HOME on the runner.",
+	},
+	{
+		CategoryTestDirectory,
+		regexp.MustCompile(`(?i)test (file|directory|target)s? .*(does not exist|not found)|(integration|patrol)_test\S* (does not exist|not found)|no tests? (files? )?found`),
+		"Check test_target_directory, or the Patrol test_directory configured in pubspec.yaml.",
+	},
+	{
+		CategoryDartCompile,
+		regexp.MustCompile(`\.dart:\d+:\d+: Error:|Target kernel_snapshot\w* failed|Compilation failed`),
+		"Fix the Dart compilation errors printed above; `flutter analyze` reproduces them locally.",
+	},
+	{
+		CategoryGradleDependency,
+		regexp.MustCompile(`Could not resolve all (files|dependencies|artifacts) for configuration|Could not resolve [\w.-]+:[\w.-]+|Could not (GET|HEAD) 'https?://`),
+		"Gradle could not download dependencies. Check repository URLs and credentials, or retry if the network was flaky.",
+	},
+	{
+		CategoryLockContention,
+		regexp.MustCompile(`(?i)timeout waiting to lock|waiting for another flutter command to release the startup lock|could not acquire lock|currently in use by another Gradle instance|database is locked`),
+		"Another process held a lock. Retrying usually helps; avoid parallel builds in the same workspace.",
+	},
+	{
+		CategoryNetwork,
+		regexp.MustCompile(`(?i)connection (timed out|reset|refused)|UnknownHostException|SocketTimeoutException|could not resolve host|temporary failure in name resolution|failed host lookup|TLS handshake timeout|network is unreachable|\b(502 Bad Gateway|503 Service Unavailable|504 Gateway Time-?out)`),
+		"A network request failed. Retrying usually helps.",
+	},
+}
+
+const unknownHint = "Check the first error in the output above."
+
+// Classification is the verdict for a failed command.
+type Classification struct {
+	Category Category
+	Hint     string
+	// Transient is true when retrying may succeed, e.g. network errors or lock contention.
+	Transient bool
+}
+
+// Classifier is an io.Writer matching every line written to it against the known failure signatures.
+type Classifier struct {
+	matched map[Category]bool
+	partial []byte
+}
+
+// NewClassifier returns an empty Classifier.
+func NewClassifier() *Classifier {
+	return &Classifier{matched: map[Category]bool{}}
+}
+
+func (c *Classifier) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			c.appendPartial(p)
+			break
+		}
+		c.appendPartial(p[:i])
+		c.matchLine()
+		p = p[i+1:]
+	}
+	return written, nil
+}
+
+func (c *Classifier) appendPartial(p []byte) {
+	room := maxClassifiedLineBytes - len(c.partial)
+	c.partial = append(c.partial, p[:min(max(room, 0), len(p))]...)
+}
+
+func (c *Classifier) matchLine() {
+	for _, s := range signatures {
+		if !c.matched[s.category] && s.pattern.Match(c.partial) {
+			c.matched[s.category] = true
+		}
+	}
+	c.partial = c.partial[:0]
+}
+
+// Classification returns the verdict for everything written so far.
+func (c *Classifier) Classification() Classification {
+	if len(c.partial) > 0 {
+		c.matchLine()
+	}
+	for _, s := range signatures {
+		if !c.matched[s.category] {
+			continue
+		}
+		transient := s.category == CategoryNetwork || s.category == CategoryLockContention ||
+			(s.category == CategoryGradleDependency && c.matched[CategoryNetwork])
+		return Classification{Category: s.category, Hint: s.hint, Transient: transient}
+	}
+	return Classification{Category: CategoryUnknown, Hint: unknownHint}
+}
+
+// Classify classifies a captured output at once.
+func Classify(output string) Classification {
+	c := NewClassifier()
+	_, _ = c.Write([]byte(output))
+	return c.Classification()
+}
+
+// Error attaches a classification to a failure.
+type Error struct {
+	Classification
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v\nFailure category: %s\nHint: %s", e.Err, e.Category, e.Hint)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap attaches classification to err. A nil err stays nil.
+func Wrap(err error, classification Classification) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Classification: classification, Err: err}
+}
+
+// ClassificationOf returns the classification attached to err, if any.
+func ClassificationOf(err error) (Classification, bool) {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Classification, true
+	}
+	return Classification{}, false
+}
@@ -0,0 +1,72 @@
+package failure
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		want      Category
+		transient bool
+	}{
+		{"code signing", "error: No profiles for 'com.example.app' were found", CategoryCodeSigning, false},
+		{"cocoapods", "[!] CocoaPods could not find compatible versions for pod \"Firebase\"", CategoryCocoaPods, false},
+		{"android sdk", "SDK location not found. Define a valid SDK location with an ANDROID_HOME environment variable", CategoryAndroidSDK, false},
+		{"test directory", "Test directory patrol_test does not exist", CategoryTestDirectory, false},
+		{"dart compile", "lib/main.dart:12:5: Error: Expected ';' after this.", CategoryDartCompile, false},
+		{"gradle dependency", "> Could not resolve all files for configuration ':app:debugRuntimeClasspath'.", CategoryGradleDependency, false},
+		{
+			"gradle dependency over flaky network",
+			"> Could not resolve com.google.firebase:firebase-bom:32.0.0.\n> Connection timed out",
+			CategoryGradleDependency, true,
+		},
+		{"lock", "Timeout waiting to lock journal cache (/root/.gradle/caches/journal-1).", CategoryLockContention, true},
+		{"network", "SocketException: Failed host lookup: 'pub.dev'", CategoryNetwork, true},
+		{"precedence", "Connection reset\nerror: No signing certificate \"iOS Development\" found", CategoryCodeSigning, false},
+		{"unknown", "FAILURE: Build failed with an exception.", CategoryUnknown, false},
+	}
+	for _, tt := range tests {
+		got := Classify(tt.output)
+		if got.Category != tt.want || got.Transient != tt.transient || got.Hint == "" {
+			t.Errorf("%s: got %+v, want %s (transient %v)", tt.name, got, tt.want, tt.transient)
+		}
+	}
+}
+
+func TestClassifier_LinesSplitAcrossWrites(t *testing.T) {
+	// GIVEN a signature split over two writes
+	c := NewClassifier()
+
+	// WHEN writing it in pieces
+	_, _ = c.Write([]byte("lib/main.dart:3:1: Err"))
+	_, _ = c.Write([]byte("or: Undefined name 'foo'.\n"))
+
+	// THEN the whole line is matched
+	if got := c.Classification().Category; got != CategoryDartCompile {
+		t.Fatalf("expected %s, got %s", CategoryDartCompile, got)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	// GIVEN a failure and its classification
+	cause := errors.New("exit status 1")
+	classification := Classify("Connection refused")
+
+	// WHEN wrapping it
+	err := Wrap(cause, classification)
+
+	// THEN the cause and classification are both reachable
+	if !errors.Is(err, cause) || !strings.Contains(err.Error(), "Failure category: network") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, ok := ClassificationOf(err); !ok || got != classification {
+		t.Fatalf("expected %+v, got %+v (%v)", classification, got, ok)
+	}
+	if Wrap(nil, classification) != nil {
+		t.Fatal("expected nil error to stay nil")
+	}
+}
@@ -0,0 +1,59 @@
+package interrupt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"patrol_install/utils/print"
+	"patrol_install/utils/procgroup"
+)
+
+// force kills the process groups still stopping; a variable so tests can observe it.
+var force = procgroup.Force
+
+// Context returns a context cancelled on the first SIGINT or SIGTERM, with the signal as its
+// cause. Signals stay caught until the returned func releases the handler, so the step always
+// outlives the process groups it stops: a second signal kills them at once instead of waiting
+// for their grace period.
+func Context(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	released := make(chan struct{})
+
+	go func() {
+		received := false
+		for {
+			select {
+			case sig := <-signals:
+				if received {
+					print.Warning(fmt.Sprintf("Received %s again, killing the running commands", sig))
+					force()
+					continue
+				}
+				received = true
+				print.Warning(fmt.Sprintf("Received %s, stopping the running stage...", sig))
+				cancel(fmt.Errorf("received %s", sig))
+			case <-released:
+				return
+			}
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(released)
+		cancel(nil)
+	}
+}
+
+// Reason describes why ctx was cancelled, or is empty while it is still running.
+func Reason(ctx context.Context) string {
+	if ctx.Err() == nil {
+		return ""
+	}
+	return context.Cause(ctx).Error()
+}
@@ -0,0 +1,66 @@
+package interrupt
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestContext_CancelledBySignal(t *testing.T) {
+	// GIVEN an interruptible context
+	ctx, stop := Context(context.Background())
+	defer stop()
+
+	// WHEN the process receives SIGTERM
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("kill: %v", err)
+	}
+
+	// THEN the context is cancelled with the signal as reason
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the context to be cancelled")
+	}
+	if Reason(ctx) != "received terminated" {
+		t.Fatalf("unexpected reason %q", Reason(ctx))
+	}
+}
+
+func TestReason_EmptyWhileRunning(t *testing.T) {
+	ctx, stop := Context(context.Background())
+	defer stop()
+	if Reason(ctx) != "" {
+		t.Fatalf("expected no reason, got %q", Reason(ctx))
+	}
+}
+
+func TestContext_SecondSignalForcesKill(t *testing.T) {
+	// GIVEN an interruptible context already cancelled by a first signal
+	forced := make(chan struct{}, 1)
+	original := force
+	force = func() { forced <- struct{}{} }
+	t.Cleanup(func() { force = original })
+	ctx, stop := Context(context.Background())
+	defer stop()
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatalf("kill: %v", err)
+	}
+	<-ctx.Done()
+
+	// WHEN a second signal arrives while the stage is stopping
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("kill: %v", err)
+	}
+
+	// THEN the signal is still caught and the running process groups are killed at once
+	select {
+	case <-forced:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the process groups to be killed")
+	}
+	if Reason(ctx) != "received interrupt" {
+		t.Fatalf("expected the first signal as reason, got %q", Reason(ctx))
+	}
+}
@@ -0,0 +1,90 @@
+package procgroup
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"patrol_install/utils/print"
+)
+
+// GracePeriod is how long a cancelled command and its children get to exit after SIGTERM
+// before the whole process group is killed.
+var GracePeriod = 10 * time.Second
+
+// pollInterval is how often a terminating group is checked for remaining processes.
+const pollInterval = 100 * time.Millisecond
+
+var (
+	forceOnce sync.Once
+	// forced is closed by Force to end every grace period.
+	forced = make(chan struct{})
+)
+
+// Force kills the groups being terminated at once, and every group terminated later, without
+// waiting for GracePeriod. It is called on a second interrupt.
+func Force() {
+	forceOnce.Do(func() { close(forced) })
+}
+
+// Prepare makes cmd start in a process group of its own, so it can be stopped together with
+// every process it spawns (Gradle daemons, xcodebuild workers, ...). Call it before cmd.Start.
+// The group is not the terminal's foreground group, so a terminal Ctrl-C only reaches the step,
+// which stops the group through Watch.
+func Prepare(cmd *exec.Cmd) {
+	setGroup(cmd)
+}
+
+// Watch stops the process group of the started cmd once ctx is cancelled: SIGTERM first, then
+// SIGKILL if processes remain after GracePeriod. The returned func ends the watch; call it after
+// cmd.Wait. It blocks until a termination in progress is finished, so no child outlives the call.
+func Watch(ctx context.Context, cmd *exec.Cmd) func() {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-done:
+		case <-ctx.Done():
+			terminate(cmd.Process.Pid)
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// Err describes a command stopped by the cancellation of ctx. It matches context.Canceled
+// (or context.DeadlineExceeded) and names the cause of the cancellation.
+func Err(ctx context.Context) error {
+	if cause := context.Cause(ctx); cause != nil && cause != ctx.Err() {
+		return fmt.Errorf("command cancelled: %w (%v)", ctx.Err(), cause)
+	}
+	return fmt.Errorf("command cancelled: %w", ctx.Err())
+}
+
+func terminate(pid int) {
+	print.Warning(fmt.Sprintf("Stopping process group %d", pid))
+	if err := signalGroup(pid, false); err != nil {
+		return
+	}
+	deadline := time.NewTimer(GracePeriod)
+	defer deadline.Stop()
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	for groupAlive(pid) {
+		select {
+		case <-poll.C:
+			continue
+		case <-forced:
+			print.Warning(fmt.Sprintf("Killing process group %d", pid))
+		case <-deadline.C:
+			print.Warning(fmt.Sprintf("Process group %d still running %s after SIGTERM, killing it", pid, GracePeriod))
+		}
+		_ = signalGroup(pid, true)
+		return
+	}
+}
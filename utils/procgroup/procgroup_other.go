@@ -0,0 +1,24 @@
+//go:build !linux && !darwin
+
+package procgroup
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setGroup is a no-op: process groups are not available on this platform.
+func setGroup(cmd *exec.Cmd) {}
+
+// signalGroup can only kill the command itself on this platform.
+func signalGroup(pid int, _ bool) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
+
+func groupAlive(pid int) bool {
+	return false
+}
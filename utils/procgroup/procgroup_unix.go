@@ -0,0 +1,31 @@
+//go:build linux || darwin
+
+package procgroup
+
+import (
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func setGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalGroup sends SIGTERM, or SIGKILL when kill is set, to every process of the group led by pid.
+func signalGroup(pid int, kill bool) error {
+	signal := unix.SIGTERM
+	if kill {
+		signal = unix.SIGKILL
+	}
+	return unix.Kill(-pid, signal)
+}
+
+// groupAlive reports whether any process of the group led by pid is still running.
+func groupAlive(pid int) bool {
+	return unix.Kill(-pid, 0) == nil
+}
@@ -0,0 +1,108 @@
+//go:build linux
+
+package procgroup
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startIgnoringTerm starts a shell ignoring SIGTERM with a child doing the same, and returns the
+// pid of the child.
+func startIgnoringTerm(t *testing.T, ctx context.Context) (*exec.Cmd, func(), int) {
+	t.Helper()
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	cmd := exec.Command("sh", "-c", `trap "" TERM; sleep 30 & echo $! > "$1"; wait`, "sh", pidFile)
+	Prepare(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	stop := Watch(ctx, cmd)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		data, err := os.ReadFile(pidFile)
+		if pid, convErr := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && convErr == nil {
+			return cmd, stop, pid
+		}
+	}
+	t.Fatal("the child did not start")
+	return nil, nil, 0
+}
+
+// exited reports whether pid is gone, or a zombie waiting to be reaped, within a second: SIGKILL
+// is delivered asynchronously.
+func exited(pid int) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+		if err != nil {
+			return true
+		}
+		fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+		if len(fields) > 0 && fields[0] == "Z" {
+			return true
+		}
+	}
+	return false
+}
+
+func resetForce(t *testing.T) {
+	t.Cleanup(func() {
+		forceOnce = sync.Once{}
+		forced = make(chan struct{})
+	})
+}
+
+func TestWatch_KillsGroupAfterGracePeriod(t *testing.T) {
+	// GIVEN a group ignoring SIGTERM and a short grace period
+	original := GracePeriod
+	GracePeriod = 300 * time.Millisecond
+	t.Cleanup(func() { GracePeriod = original })
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd, stop, child := startIgnoringTerm(t, ctx)
+
+	// WHEN the context is cancelled
+	started := time.Now()
+	cancel()
+	_ = cmd.Wait()
+	stop()
+
+	// THEN the whole group is killed once the grace period is over
+	if elapsed := time.Since(started); elapsed < GracePeriod {
+		t.Fatalf("expected the grace period to be waited, took %s", elapsed)
+	}
+	if !exited(child) {
+		t.Fatalf("expected child %d to be killed with its group", child)
+	}
+}
+
+func TestForce_KillsGroupWithoutGracePeriod(t *testing.T) {
+	// GIVEN a group ignoring SIGTERM and a long grace period
+	resetForce(t)
+	original := GracePeriod
+	GracePeriod = time.Minute
+	t.Cleanup(func() { GracePeriod = original })
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd, stop, child := startIgnoringTerm(t, ctx)
+
+	// WHEN the context is cancelled and the kill forced while the group is stopping
+	started := time.Now()
+	cancel()
+	time.Sleep(200 * time.Millisecond)
+	Force()
+	_ = cmd.Wait()
+	stop()
+
+	// THEN the group is killed at once
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("expected an immediate kill, took %s", elapsed)
+	}
+	if !exited(child) {
+		t.Fatalf("expected child %d to be killed with its group", child)
+	}
+}
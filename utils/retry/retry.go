@@ -0,0 +1,89 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"patrol_install/utils/failure"
+	"patrol_install/utils/print"
+	"patrol_install/utils/summary"
+)
+
+const (
+	DefaultRetries      = 2
+	DefaultInitialDelay = 10 * time.Second
+	MaxRetries          = 10
+	maxDelay            = 2 * time.Minute
+	backoffMultiplier   = 2
+)
+
+// Policy decides how often and how long apart an operation is retried.
+type Policy struct {
+	Retries      int
+	InitialDelay time.Duration
+}
+
+// DefaultPolicy is used when the retry inputs are empty.
+var DefaultPolicy = Policy{Retries: DefaultRetries, InitialDelay: DefaultInitialDelay}
+
+// sleep waits for d, returning early with an error once ctx is cancelled.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PolicyFromEnv reads the number of retries from retriesKey and the initial delay in seconds from
+// initialDelayKey. Empty values keep the defaults.
+func PolicyFromEnv(retriesKey, initialDelayKey string) (Policy, error) {
+	policy := DefaultPolicy
+	if value := strings.TrimSpace(os.Getenv(retriesKey)); value != "" {
+		retries, err := strconv.Atoi(value)
+		if err != nil || retries < 0 || retries > MaxRetries {
+			return Policy{}, fmt.Errorf("invalid value for %s: expected a number between 0 and %d", retriesKey, MaxRetries)
+		}
+		policy.Retries = retries
+	}
+	if value := strings.TrimSpace(os.Getenv(initialDelayKey)); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return Policy{}, fmt.Errorf("invalid value for %s: expected a number of seconds", initialDelayKey)
+		}
+		policy.InitialDelay = time.Duration(seconds) * time.Second
+	}
+	return policy, nil
+}
+
+// Do runs fn, retrying with exponential backoff while it fails with an error the failure
+// classifier considers transient. Every retry is logged and counted in the run summary.
+// Once ctx is cancelled no further attempt is made and the last error is returned.
+func Do(ctx context.Context, operation string, policy Policy, fn func() error) error {
+	delay := policy.InitialDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		classification, ok := failure.ClassificationOf(err)
+		if !ok || !classification.Transient || attempt > policy.Retries || ctx.Err() != nil {
+			return err
+		}
+
+		print.Warning(fmt.Sprintf("%s failed with a transient %s error (attempt %d of %d), retrying in %s",
+			operation, classification.Category, attempt, policy.Retries+1, delay))
+		summary.RecordRetry()
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+		delay = min(delay*backoffMultiplier, maxDelay)
+	}
+}
@@ -0,0 +1,139 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"patrol_install/utils/failure"
+	"patrol_install/utils/summary"
+)
+
+func stubSleep(t *testing.T) *[]time.Duration {
+	delays := &[]time.Duration{}
+	original := sleep
+	sleep = func(_ context.Context, d time.Duration) error {
+		*delays = append(*delays, d)
+		return nil
+	}
+	t.Cleanup(func() { sleep = original })
+	return delays
+}
+
+func transientError() error {
+	return failure.Wrap(errors.New("exit status 1"), failure.Classify("Connection reset by peer"))
+}
+
+func TestDo_RetriesTransientFailuresWithBackoff(t *testing.T) {
+	// GIVEN an operation failing twice with a network error
+	delays := stubSleep(t)
+	summary.Reset()
+	stage := summary.Begin("install")
+	calls := 0
+
+	// WHEN running it with three retries
+	err := Do(context.Background(), "install", Policy{Retries: 3, InitialDelay: time.Second}, func() error {
+		calls++
+		if calls < 3 {
+			return transientError()
+		}
+		return nil
+	})
+
+	// THEN it succeeds on the third attempt after doubling delays, and the retries are counted
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if calls != 3 || len(*delays) != 2 || (*delays)[0] != time.Second || (*delays)[1] != 2*time.Second {
+		t.Fatalf("unexpected calls %d or delays %v", calls, *delays)
+	}
+	if stage.Retries != 2 {
+		t.Fatalf("expected 2 retries in the summary, got %d", stage.Retries)
+	}
+}
+
+func TestDo_GivesUpAfterRetries(t *testing.T) {
+	// GIVEN an operation always failing with a network error
+	stubSleep(t)
+	calls := 0
+
+	// WHEN running it with one retry
+	err := Do(context.Background(), "build", Policy{Retries: 1}, func() error {
+		calls++
+		return transientError()
+	})
+
+	// THEN the last error is returned after two attempts
+	if err == nil || calls != 2 {
+		t.Fatalf("expected failure after 2 attempts, got %d (%v)", calls, err)
+	}
+}
+
+func TestDo_DoesNotRetryPermanentFailures(t *testing.T) {
+	// GIVEN operations failing with a compile error and with an unclassified error
+	delays := stubSleep(t)
+	for _, failing := range []error{
+		failure.Wrap(errors.New("exit status 1"), failure.Classify("lib/main.dart:1:1: Error: oops")),
+		errors.New("boom"),
+	} {
+		calls := 0
+
+		// WHEN running them
+		err := Do(context.Background(), "build", Policy{Retries: 3}, func() error {
+			calls++
+			return failing
+		})
+
+		// THEN they are not retried
+		if err == nil || calls != 1 {
+			t.Fatalf("expected a single attempt, got %d (%v)", calls, err)
+		}
+	}
+	if len(*delays) != 0 {
+		t.Fatalf("expected no sleeps, got %v", *delays)
+	}
+}
+
+func TestDo_StopsRetryingOnceCancelled(t *testing.T) {
+	// GIVEN an operation failing with a network error while the run gets cancelled
+	delays := stubSleep(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+
+	// WHEN running it with retries left
+	err := Do(ctx, "install", Policy{Retries: 3}, func() error {
+		calls++
+		cancel()
+		return transientError()
+	})
+
+	// THEN it gives up without waiting for another attempt
+	if err == nil || calls != 1 || len(*delays) != 0 {
+		t.Fatalf("expected a single attempt without sleeping, got %d attempts, delays %v (%v)", calls, *delays, err)
+	}
+}
+
+const (
+	testRetriesKey      = "TEST_RETRY_COUNT"
+	testInitialDelayKey = "TEST_RETRY_INITIAL_DELAY"
+)
+
+func TestPolicyFromEnv(t *testing.T) {
+	t.Setenv(testRetriesKey, "")
+	t.Setenv(testInitialDelayKey, "")
+	if policy, err := PolicyFromEnv(testRetriesKey, testInitialDelayKey); err != nil || policy != DefaultPolicy {
+		t.Fatalf("expected default policy, got %+v (%v)", policy, err)
+	}
+
+	t.Setenv(testRetriesKey, "4")
+	t.Setenv(testInitialDelayKey, "3")
+	if policy, err := PolicyFromEnv(testRetriesKey, testInitialDelayKey); err != nil || policy != (Policy{Retries: 4, InitialDelay: 3 * time.Second}) {
+		t.Fatalf("unexpected policy %+v (%v)", policy, err)
+	}
+
+	t.Setenv(testRetriesKey, "-1")
+	if _, err := PolicyFromEnv(testRetriesKey, testInitialDelayKey); err == nil {
+		t.Fatal("expected invalid retry count to be rejected")
+	}
+}
@@ -0,0 +1,184 @@
+package step_config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"patrol_install/utils/print"
+	"patrol_install/utils/step_inputs"
+)
+
+// DefaultFileName is the config file read from the working directory when no other is given.
+const DefaultFileName = "patrol_build.yaml"
+
+// FileInputKey is the input naming the config file. The file cannot set it itself.
+const FileInputKey = "config_file"
+
+// Origins of a resolved value, from the highest to the lowest precedence.
+const (
+	OriginFlag    = "flag"
+	OriginEnv     = "env"
+	OriginFile    = "file"
+	OriginDefault = "step.yml default"
+	OriginUnset   = "not set"
+)
+
+// Value is the effective value of one input and where it came from.
+type Value struct {
+	Input  step_inputs.Input
+	Value  string
+	Origin string
+}
+
+// File holds the settings read from a config file, keyed by input.
+type File struct {
+	Path   string
+	Values map[string]string
+}
+
+// LoadFile reads a YAML mapping of step input keys to scalar values. A missing file is only an
+// error when it is not the default one. Unknown keys are rejected so typos do not go unnoticed.
+func LoadFile(path string, inputs []step_inputs.Input) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && path == DefaultFileName {
+			return &File{Path: path, Values: map[string]string{}}, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	file := &File{Path: path, Values: map[string]string{}}
+	if len(root.Content) == 0 {
+		return file, nil
+	}
+	mapping := root.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: expected a mapping of step inputs to values", path)
+	}
+
+	var errs []error
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if _, ok := step_inputs.Lookup(inputs, key.Value); !ok || key.Value == FileInputKey {
+			errs = append(errs, fmt.Errorf("%s line %d: unknown setting %q", path, key.Line, key.Value))
+			continue
+		}
+		if value.Kind != yaml.ScalarNode {
+			errs = append(errs, fmt.Errorf("%s line %d: %s must be a single value", path, value.Line, key.Value))
+			continue
+		}
+		if value.Tag != "!!null" {
+			file.Values[key.Value] = value.Value
+		}
+	}
+	return file, errors.Join(errs...)
+}
+
+// Resolve returns the effective value of every input with this precedence: flags, then the
+// environment, then the config file, then, when useDefaults is set, the step.yml defaults.
+// Empty environment variables count as unset, as CI systems export empty inputs. An environment
+// variable holding the step.yml default does not override the file either, as Bitrise exports every
+// input, defaults included. Options given in another case are brought to their step.yml case.
+func Resolve(inputs []step_inputs.Input, flags map[string]string, file *File, useDefaults bool) []Value {
+	values := make([]Value, 0, len(inputs))
+	for _, input := range inputs {
+		value := resolve(input, flags, file, useDefaults)
+		value.Value = input.Canonical(value.Value)
+		values = append(values, value)
+	}
+	return values
+}
+
+func resolve(input step_inputs.Input, flags map[string]string, file *File, useDefaults bool) Value {
+	if value, ok := flags[input.Key]; ok {
+		return Value{Input: input, Value: value, Origin: OriginFlag}
+	}
+	env := os.Getenv(input.EnvKey())
+	fileValue, inFile := file.Values[input.Key]
+	if env != "" && !(inFile && isDefault(input, env)) {
+		return Value{Input: input, Value: env, Origin: OriginEnv}
+	}
+	if inFile {
+		return Value{Input: input, Value: fileValue, Origin: OriginFile}
+	}
+	if env != "" {
+		return Value{Input: input, Value: env, Origin: OriginEnv}
+	}
+	if useDefaults && input.Default != "" {
+		if value, ok := expandDefault(input.Default); ok {
+			return Value{Input: input, Value: value, Origin: OriginDefault}
+		}
+	}
+	return Value{Input: input, Origin: OriginUnset}
+}
+
+// isDefault reports whether value is the step.yml default of input, as written or expanded.
+func isDefault(input step_inputs.Input, value string) bool {
+	if input.Default == "" {
+		return false
+	}
+	if value == input.Default {
+		return true
+	}
+	expanded, ok := expandDefault(input.Default)
+	return ok && value == expanded
+}
+
+// expandDefault expands the variables of a default, failing when one is unset so the stages can
+// apply their own fallback instead of a half-expanded path.
+func expandDefault(value string) (string, bool) {
+	unset := false
+	expanded := os.Expand(value, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		unset = unset || !ok
+		return value
+	})
+	return expanded, !unset
+}
+
+// Apply exports the resolved values to the environment the stages read.
+func Apply(values []Value) error {
+	for _, value := range values {
+		if value.Origin == OriginUnset || value.Origin == OriginEnv && os.Getenv(value.Input.EnvKey()) == value.Value {
+			continue
+		}
+		if err := os.Setenv(value.Input.EnvKey(), value.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Print logs the effective value of each input and its origin.
+func Print(values []Value, file *File) {
+	print.StepInitiated("--- Effective configuration ---")
+	for _, value := range values {
+		origin := value.Origin
+		switch origin {
+		case OriginFile:
+			origin = file.Path
+		case OriginEnv:
+			origin = "env " + value.Input.EnvKey()
+		}
+		if value.Origin == OriginUnset {
+			print.Vanilla(fmt.Sprintf("  %s: (not set)", value.Input.Key))
+			continue
+		}
+		print.Vanilla(fmt.Sprintf("  %s: %s (%s)", value.Input.Key, quote(value.Value), origin))
+	}
+}
+
+func quote(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\n\"'") {
+		return fmt.Sprintf("%q", value)
+	}
+	return value
+}
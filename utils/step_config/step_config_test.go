@@ -0,0 +1,109 @@
+package step_config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"patrol_install/utils/step_inputs"
+)
+
+var testInputs = []step_inputs.Input{
+	{Key: "platform", Default: "both"},
+	{Key: "tags"},
+	{Key: "retry_count", Default: "2"},
+	{Key: "config_file", Default: DefaultFileName},
+}
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "patrol_build.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	// GIVEN a config file with scalars of several YAML types
+	path := writeConfig(t, "platform: android\nretry_count: 3\ntags:\n")
+
+	// WHEN loading it
+	file, err := LoadFile(path, testInputs)
+
+	// THEN every value is read as a string and null values are skipped
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if file.Values["platform"] != "android" || file.Values["retry_count"] != "3" || len(file.Values) != 2 {
+		t.Fatalf("unexpected values %v", file.Values)
+	}
+}
+
+func TestLoadFile_ReportsEveryInvalidSetting(t *testing.T) {
+	// GIVEN a config file with a typo, a list and the config file itself
+	path := writeConfig(t, "platfrom: ios\ntags:\n  - smoke\nconfig_file: other.yaml\n")
+
+	// WHEN loading it
+	_, err := LoadFile(path, testInputs)
+
+	// THEN all three problems are reported
+	if err == nil || !strings.Contains(err.Error(), `"platfrom"`) || !strings.Contains(err.Error(), "tags must be a single value") || !strings.Contains(err.Error(), `"config_file"`) {
+		t.Fatalf("expected every problem, got %v", err)
+	}
+}
+
+func TestLoadFile_Missing(t *testing.T) {
+	if _, err := LoadFile(DefaultFileName, testInputs); err != nil {
+		t.Fatalf("expected a missing default file to be ignored, got %v", err)
+	}
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "custom.yaml"), testInputs); err == nil {
+		t.Fatal("expected a missing custom file to be an error")
+	}
+}
+
+func TestResolve_Precedence(t *testing.T) {
+	// GIVEN tags in the env and the file, the platform in a flag and the file
+	t.Setenv("TAGS", "smoke")
+	t.Setenv("PLATFORM", "")
+	t.Setenv("RETRY_COUNT", "")
+	file := &File{Path: "patrol_build.yaml", Values: map[string]string{"platform": "ios", "tags": "regression"}}
+
+	// WHEN resolving with and without defaults
+	values := Resolve(testInputs[:3], map[string]string{"platform": "android"}, file, true)
+	withoutDefaults := Resolve(testInputs[2:3], nil, file, false)
+
+	// THEN flags beat the env, which beats the file, which beats the defaults
+	got := map[string]string{}
+	for _, value := range values {
+		got[value.Input.Key] = value.Value + " (" + value.Origin + ")"
+	}
+	want := map[string]string{"platform": "android (flag)", "tags": "smoke (env)", "retry_count": "2 (step.yml default)"}
+	for key, value := range want {
+		if got[key] != value {
+			t.Fatalf("expected %s = %s, got %v", key, value, got)
+		}
+	}
+	if withoutDefaults[0].Origin != OriginUnset {
+		t.Fatalf("expected no default to be applied, got %+v", withoutDefaults[0])
+	}
+}
+
+func TestResolve_FileBeatsInjectedDefault(t *testing.T) {
+	// GIVEN the env holding the step.yml defaults, as Bitrise exports them, and a file setting them
+	t.Setenv("PLATFORM", "both")
+	t.Setenv("RETRY_COUNT", "3")
+	file := &File{Path: "patrol_build.yaml", Values: map[string]string{"platform": "ios", "retry_count": "5"}}
+
+	// WHEN resolving
+	values := Resolve([]step_inputs.Input{testInputs[0], testInputs[2]}, nil, file, true)
+
+	// THEN the file beats the default but not a value set in the workflow
+	if values[0].Value != "ios" || values[0].Origin != OriginFile {
+		t.Fatalf("expected the file platform, got %+v", values[0])
+	}
+	if values[1].Value != "3" || values[1].Origin != OriginEnv {
+		t.Fatalf("expected the env retry count, got %+v", values[1])
+	}
+}
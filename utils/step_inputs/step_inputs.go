@@ -0,0 +1,112 @@
+package step_inputs
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Input is one input declared in step.yml.
+type Input struct {
+	Key          string
+	Default      string
+	Title        string
+	Summary      string
+	Description  string
+	IsRequired   bool
+	ValueOptions []string
+}
+
+type inputOpts struct {
+	Title        string   `yaml:"title"`
+	Summary      string   `yaml:"summary"`
+	Description  string   `yaml:"description"`
+	IsRequired   bool     `yaml:"is_required"`
+	ValueOptions []string `yaml:"value_options"`
+}
+
+type stepFile struct {
+	Inputs []yaml.Node `yaml:"inputs"`
+}
+
+// EnvKey is the environment variable the input is read from.
+func (i Input) EnvKey() string {
+	return strings.ToUpper(i.Key)
+}
+
+// IsBool reports whether the input only accepts "true" and "false".
+func (i Input) IsBool() bool {
+	return len(i.ValueOptions) == 2 && i.ValueOptions[0] == "true" && i.ValueOptions[1] == "false"
+}
+
+// ParseBool converts the value of a boolean input named key, ignoring case. An empty value is false.
+func ParseBool(key, value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false":
+		return false, nil
+	case "true":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid value for %s: expected 'true' or 'false'", key)
+	}
+}
+
+// Parse reads the inputs of a step.yml, in declaration order.
+func Parse(data []byte) ([]Input, error) {
+	var file stepFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse step.yml: %w", err)
+	}
+
+	inputs := make([]Input, 0, len(file.Inputs))
+	for _, node := range file.Inputs {
+		input, err := parseInput(&node)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+// Lookup returns the input named key.
+func Lookup(inputs []Input, key string) (Input, bool) {
+	for _, input := range inputs {
+		if input.Key == key {
+			return input, true
+		}
+	}
+	return Input{}, false
+}
+
+// parseInput decodes an entry like `- platform: both` followed by its `opts:` mapping.
+func parseInput(node *yaml.Node) (Input, error) {
+	if node.Kind != yaml.MappingNode {
+		return Input{}, fmt.Errorf("step.yml line %d: expected an input mapping", node.Line)
+	}
+	var input Input
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value == "opts" {
+			var opts inputOpts
+			if err := value.Decode(&opts); err != nil {
+				return Input{}, fmt.Errorf("step.yml line %d: invalid opts: %w", value.Line, err)
+			}
+			input.Title, input.Summary, input.Description = opts.Title, opts.Summary, opts.Description
+			input.IsRequired, input.ValueOptions = opts.IsRequired, opts.ValueOptions
+			continue
+		}
+		if input.Key != "" {
+			return Input{}, fmt.Errorf("step.yml line %d: input %s declares a second key %s", key.Line, input.Key, key.Value)
+		}
+		input.Key = key.Value
+		if value.Tag != "!!null" {
+			input.Default = value.Value
+		}
+	}
+	if input.Key == "" {
+		return Input{}, fmt.Errorf("step.yml line %d: input without a key", node.Line)
+	}
+	return input, nil
+}
@@ -0,0 +1,71 @@
+package step_inputs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse_StepYml(t *testing.T) {
+	// GIVEN the step.yml of the repository
+	data, err := os.ReadFile(filepath.Join("..", "..", "step.yml"))
+	if err != nil {
+		t.Fatalf("read step.yml: %v", err)
+	}
+
+	// WHEN parsing its inputs
+	inputs, err := Parse(data)
+
+	// THEN keys, defaults and options are read in order
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(inputs) == 0 || inputs[0].Key != "custom_patrol_cli_version" {
+		t.Fatalf("unexpected inputs %+v", inputs)
+	}
+	platform, ok := Lookup(inputs, "platform")
+	if !ok || platform.Default != "both" || !platform.IsRequired || platform.EnvKey() != "PLATFORM" || len(platform.ValueOptions) != 3 {
+		t.Fatalf("unexpected platform input %+v", platform)
+	}
+	target, ok := Lookup(inputs, "test_target_directory")
+	if !ok || target.Default != "" || target.IsRequired {
+		t.Fatalf("unexpected target input %+v", target)
+	}
+	verbose, _ := Lookup(inputs, "is_verbose_mode")
+	if !verbose.IsBool() {
+		t.Fatalf("expected is_verbose_mode to be a boolean input, got %+v", verbose)
+	}
+}
+
+func TestParse_RejectsMalformedInputs(t *testing.T) {
+	for name, data := range map[string]string{
+		"not a mapping": "inputs:\n- platform\n",
+		"two keys":      "inputs:\n- platform: both\n  tags: \"\"\n",
+		"no key":        "inputs:\n- opts:\n    title: Platform\n",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseBool(t *testing.T) {
+	// GIVEN valid and invalid values of a boolean input
+	cases := map[string]struct {
+		want    bool
+		wantErr bool
+	}{"": {}, " ": {}, "false": {}, "true": {want: true}, " true ": {want: true}, "True": {want: true}, "FALSE": {}, "yes": {wantErr: true}}
+
+	for value, tc := range cases {
+		// WHEN parsing the value
+		got, err := ParseBool("DRY_RUN", value)
+
+		// THEN only 'true' and 'false' are accepted in any case, an empty value being false
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Fatalf("value %q: expected %v (error %v), got %v, %v", value, tc.want, tc.wantErr, got, err)
+		}
+		if err != nil && err.Error() != "invalid value for DRY_RUN: expected 'true' or 'false'" {
+			t.Fatalf("value %q: unexpected error %v", value, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package step_inputs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validate checks the value of every input, read with getenv, against its step.yml definition:
+// required inputs must be set and inputs with value_options must use one of them, in any case (see
+// Canonical). An empty value stands for the default. Every invalid input is reported, not only the first one.
+func Validate(inputs []Input, getenv func(string) string) error {
+	var errs []error
+	for _, input := range inputs {
+		if err := input.validate(getenv(input.EnvKey())); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d invalid inputs:\n%w", len(errs), errors.Join(errs...))
+}
+
+func (i Input) validate(value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		value = i.Default
+	}
+	if value == "" {
+		if i.IsRequired {
+			return fmt.Errorf("- %s (%s) is required", i.Key, i.EnvKey())
+		}
+		return nil
+	}
+	if len(i.ValueOptions) == 0 {
+		return nil
+	}
+	for _, option := range i.ValueOptions {
+		if strings.EqualFold(value, option) {
+			return nil
+		}
+	}
+	return fmt.Errorf("- %s (%s) is %q, expected one of: %s", i.Key, i.EnvKey(), value, strings.Join(i.ValueOptions, ", "))
+}
+
+// Canonical returns the option matching value regardless of case, as written in step.yml, since the
+// stages compare the values exactly. Other values are returned unchanged.
+func (i Input) Canonical(value string) string {
+	for _, option := range i.ValueOptions {
+		if strings.EqualFold(strings.TrimSpace(value), option) {
+			return option
+		}
+	}
+	return value
+}
@@ -0,0 +1,86 @@
+package step_inputs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var validateInputs = []Input{
+	{Key: "platform", Default: "both", IsRequired: true, ValueOptions: []string{"both", "ios", "android"}},
+	{Key: "test_target_directory", IsRequired: true},
+	{Key: "is_verbose_mode", Default: "false", ValueOptions: []string{"true", "false"}},
+	{Key: "tags"},
+}
+
+func envOf(values map[string]string) func(string) string {
+	return func(key string) string { return values[key] }
+}
+
+func TestValidate_ReportsEveryInvalidInput(t *testing.T) {
+	// GIVEN an unknown platform, a missing required input and an invalid boolean
+	env := envOf(map[string]string{"PLATFORM": "windows", "IS_VERBOSE_MODE": "yes"})
+
+	// WHEN validating
+	err := Validate(validateInputs, env)
+
+	// THEN all three are reported with their options
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"3 invalid inputs", `platform (PLATFORM) is "windows", expected one of: both, ios, android`, "test_target_directory (TEST_TARGET_DIRECTORY) is required", "is_verbose_mode"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestValidate_EmptyValuesUseDefaults(t *testing.T) {
+	// GIVEN only the required target, with other inputs empty or in another case
+	env := envOf(map[string]string{"TEST_TARGET_DIRECTORY": "patrol_test", "IS_VERBOSE_MODE": "True"})
+
+	// WHEN validating
+	err := Validate(validateInputs, env)
+
+	// THEN the defaults are valid and options match case-insensitively
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestStepYmlDefaultsAreValid(t *testing.T) {
+	// GIVEN the repository step.yml
+	data, err := os.ReadFile(filepath.Join("..", "..", "step.yml"))
+	if err != nil {
+		t.Fatalf("read step.yml: %v", err)
+	}
+	inputs, err := Parse(data)
+	if err != nil {
+		t.Fatalf("parse step.yml: %v", err)
+	}
+
+	// WHEN validating each input left empty
+	for _, input := range inputs {
+		if input.Default == "" {
+			continue
+		}
+		// THEN its default is one of its options
+		if err := input.validate(""); err != nil {
+			t.Fatalf("default of %s is invalid: %v", input.Key, err)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	// GIVEN the platform input
+	platform, _ := Lookup(validateInputs, "platform")
+
+	// WHEN bringing values in any case to their option
+	// THEN options take their step.yml case and other values are kept
+	for value, want := range map[string]string{"iOS": "ios", " Android ": "android", "both": "both", "windows": "windows"} {
+		if got := platform.Canonical(value); got != want {
+			t.Fatalf("Canonical(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
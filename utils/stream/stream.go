@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"patrol_install/utils/print"
+	"patrol_install/utils/procgroup"
+)
+
+// DefaultTailLines is how many trailing output lines a CommandError keeps.
+const DefaultTailLines = 50
+
+// DrainTimeout bounds how long output is still read after the process exited. Background
+// processes started by the command (e.g. a Gradle daemon) may inherit the pipe and keep it open.
+var DrainTimeout = 5 * time.Second
+
+// CommandError is returned when a streamed command fails, carrying the end of its output.
+type CommandError struct {
+	Err  error
+	Tail []string
+}
+
+func (e *CommandError) Error() string {
+	if len(e.Tail) == 0 {
+		return fmt.Sprintf("command failed: %v", e.Err)
+	}
+	return fmt.Sprintf("command failed: %v\nLast %d lines of output:\n%s", e.Err, len(e.Tail), strings.Join(e.Tail, "\n"))
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Run starts cmd with stdout and stderr sharing one pipe, so lines keep the order the process
+// wrote them in, and copies everything to out as it arrives. It returns only after the process
+// exited and its output was drained. A failure is returned as *CommandError with the last
+// tailLines lines of output.
+//
+// The command runs in its own process group. Cancelling ctx stops the whole group, see
+// procgroup.Watch, and the returned error then matches context.Canceled.
+func Run(ctx context.Context, cmd *exec.Cmd, out io.Writer, tailLines int) error {
+	if err := ctx.Err(); err != nil {
+		return procgroup.Err(ctx)
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create output pipe: %w", err)
+	}
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	procgroup.Prepare(cmd)
+
+	if err := cmd.Start(); err != nil {
+		closeAll(reader, writer)
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+	// The child holds its own copy; closing ours lets the reader see EOF once the child is done.
+	closeAll(writer)
+	stopWatch := procgroup.Watch(ctx, cmd)
+
+	tail := NewTail(tailLines)
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.MultiWriter(ignoreErrors{out}, tail), reader)
+		copied <- err
+	}()
+
+	waitErr := cmd.Wait()
+	stopWatch()
+	if waitErr != nil && ctx.Err() != nil {
+		waitErr = fmt.Errorf("%w: %v", procgroup.Err(ctx), waitErr)
+	}
+
+	var copyErr error
+	select {
+	case copyErr = <-copied:
+	case <-time.After(DrainTimeout):
+		print.Warning(fmt.Sprintf("Output still open %s after the command exited, a background process may hold it. Stopped reading.", DrainTimeout))
+		_ = reader.SetReadDeadline(time.Now())
+		copyErr = <-copied
+		if errors.Is(copyErr, os.ErrDeadlineExceeded) {
+			copyErr = nil
+		}
+	}
+	closeAll(reader)
+	tail.Flush()
+
+	if waitErr != nil {
+		return &CommandError{Err: waitErr, Tail: tail.Lines()}
+	}
+	if copyErr != nil {
+		return fmt.Errorf("failed to read command output: %w", copyErr)
+	}
+	return nil
+}
+
+func closeAll(files ...*os.File) {
+	for _, f := range files {
+		if err := f.Close(); err != nil {
+			print.Error(fmt.Sprintf("Error closing %s: %v", f.Name(), err))
+		}
+	}
+}
+
+// ignoreErrors keeps consuming output when the destination fails, so the child never blocks on a full pipe.
+type ignoreErrors struct {
+	w io.Writer
+}
+
+func (i ignoreErrors) Write(p []byte) (int, error) {
+	_, _ = i.w.Write(p)
+	return len(p), nil
+}
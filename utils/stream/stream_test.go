@@ -0,0 +1,189 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"patrol_install/utils/procgroup"
+)
+
+func TestRun_DrainsOutputOfFailingCommand(t *testing.T) {
+	// GIVEN a command printing many lines before failing
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", "i=1; while [ $i -le 2000 ]; do echo line $i; i=$((i+1)); done; echo fatal >&2; exit 3")
+
+	// WHEN running it
+	err := Run(context.Background(), cmd, &out, 5)
+
+	// THEN every line is streamed and the error carries the last ones
+	if !strings.HasSuffix(out.String(), "line 1999\nline 2000\nfatal\n") || strings.Count(out.String(), "\n") != 2001 {
+		t.Fatalf("expected all output, got %d lines ending in %q", strings.Count(out.String(), "\n"), out.String()[max(out.Len()-40, 0):])
+	}
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("expected CommandError, got %v", err)
+	}
+	want := []string{"line 1997", "line 1998", "line 1999", "line 2000", "fatal"}
+	if fmt.Sprint(cmdErr.Tail) != fmt.Sprint(want) {
+		t.Fatalf("expected tail %v, got %v", want, cmdErr.Tail)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("expected exit status 3, got %v", err)
+	}
+}
+
+func TestRun_PreservesInterleaving(t *testing.T) {
+	// GIVEN a command alternating between stdout and stderr
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", "echo out1; echo err1 >&2; echo out2; echo err2 >&2")
+
+	// WHEN running it
+	err := Run(context.Background(), cmd, &out, DefaultTailLines)
+
+	// THEN the lines keep their order
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if out.String() != "out1\nerr1\nout2\nerr2\n" {
+		t.Fatalf("unexpected order %q", out.String())
+	}
+}
+
+func TestRun_LongLines(t *testing.T) {
+	// GIVEN a command printing a 200 KB line
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", "head -c 200000 /dev/zero | tr '\\0' a; echo; exit 1")
+
+	// WHEN running it
+	err := Run(context.Background(), cmd, &out, DefaultTailLines)
+
+	// THEN the line is streamed whole and kept truncated in the tail
+	if out.Len() != 200001 {
+		t.Fatalf("expected 200001 bytes, got %d", out.Len())
+	}
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || len(cmdErr.Tail) != 1 {
+		t.Fatalf("expected one tail line, got %v", err)
+	}
+	if !strings.HasSuffix(cmdErr.Tail[0], fmt.Sprintf("… (%d more bytes)", 200000-MaxTailLineBytes)) {
+		t.Fatalf("expected truncated tail line, got %q", cmdErr.Tail[0][MaxTailLineBytes:])
+	}
+}
+
+func TestRun_BackgroundProcessHoldingOutput(t *testing.T) {
+	// GIVEN a command leaving a background process attached to its output
+	original := DrainTimeout
+	DrainTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { DrainTimeout = original })
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", "sleep 3 & echo done")
+
+	// WHEN running it
+	started := time.Now()
+	err := Run(context.Background(), cmd, &out, DefaultTailLines)
+
+	// THEN it returns after the drain timeout with the output read so far
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("expected to stop reading after the drain timeout, took %s", elapsed)
+	}
+	if out.String() != "done\n" {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+}
+
+// cancelOnWrite cancels the run as soon as the command printed something.
+type cancelOnWrite struct {
+	cancel context.CancelFunc
+}
+
+func (c cancelOnWrite) Write(p []byte) (int, error) {
+	c.cancel()
+	return len(p), nil
+}
+
+func TestRun_CancelKillsProcessGroup(t *testing.T) {
+	// GIVEN a command and a child both ignoring SIGTERM, and a short grace period
+	original := procgroup.GracePeriod
+	procgroup.GracePeriod = 200 * time.Millisecond
+	t.Cleanup(func() { procgroup.GracePeriod = original })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := exec.Command("sh", "-c", "trap '' TERM; sleep 30 & echo started; wait")
+
+	// WHEN the run is cancelled once the command started
+	started := time.Now()
+	err := Run(ctx, cmd, cancelOnWrite{cancel}, DefaultTailLines)
+
+	// THEN the whole group is killed after the grace period and the error reports the cancellation
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation error, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("expected the group to be killed after the grace period, took %s", elapsed)
+	}
+	// Killed children are reaped by init asynchronously.
+	deadline := time.Now().Add(2 * time.Second)
+	for syscall.Kill(-cmd.Process.Pid, 0) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected no process of the group to survive")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRun_AlreadyCancelled(t *testing.T) {
+	// GIVEN a cancelled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cmd := exec.Command("sh", "-c", "echo never")
+
+	// WHEN running a command
+	err := Run(ctx, cmd, &bytes.Buffer{}, DefaultTailLines)
+
+	// THEN it is not started
+	if !errors.Is(err, context.Canceled) || cmd.Process != nil {
+		t.Fatalf("expected the command not to start, got %v", err)
+	}
+}
+
+func TestRun_StartFailure(t *testing.T) {
+	// GIVEN a missing executable
+	cmd := exec.Command("/nonexistent/patrol")
+
+	// WHEN running it
+	err := Run(context.Background(), cmd, &bytes.Buffer{}, DefaultTailLines)
+
+	// THEN the start error is returned
+	if err == nil || !strings.Contains(err.Error(), "failed to start command") {
+		t.Fatalf("expected start error, got %v", err)
+	}
+}
+
+func TestTail_KeepsLastLines(t *testing.T) {
+	// GIVEN a tail of three lines
+	tail := NewTail(3)
+
+	// WHEN writing lines split across writes, with a trailing partial line
+	for _, chunk := range []string{"one\ntw", "o\r\nthree\nfour\nfi", "ve"} {
+		if _, err := tail.Write([]byte(chunk)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	tail.Flush()
+
+	// THEN the last three complete lines are kept in order
+	if got := fmt.Sprint(tail.Lines()); got != "[three four five]" {
+		t.Fatalf("unexpected lines %s", got)
+	}
+}
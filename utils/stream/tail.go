@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// MaxTailLineBytes caps each line kept by Tail; longer lines are cut and marked.
+const MaxTailLineBytes = 4096
+
+// Tail is an io.Writer keeping the last lines written to it in a ring buffer.
+// Lines of any length are accepted; only their first MaxTailLineBytes are kept.
+type Tail struct {
+	lines   []string
+	next    int
+	full    bool
+	partial []byte
+	dropped int
+}
+
+// NewTail returns a Tail keeping up to size lines.
+func NewTail(size int) *Tail {
+	return &Tail{lines: make([]string, max(size, 0))}
+}
+
+func (t *Tail) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			t.appendPartial(p)
+			break
+		}
+		t.appendPartial(p[:i])
+		t.push()
+		p = p[i+1:]
+	}
+	return written, nil
+}
+
+// Flush keeps a trailing line that did not end with a newline.
+func (t *Tail) Flush() {
+	if len(t.partial) > 0 || t.dropped > 0 {
+		t.push()
+	}
+}
+
+// Lines returns the kept lines, oldest first.
+func (t *Tail) Lines() []string {
+	if !t.full {
+		return append([]string(nil), t.lines[:t.next]...)
+	}
+	return append(append([]string(nil), t.lines[t.next:]...), t.lines[:t.next]...)
+}
+
+func (t *Tail) appendPartial(p []byte) {
+	room := MaxTailLineBytes - len(t.partial)
+	if room >= len(p) {
+		t.partial = append(t.partial, p...)
+		return
+	}
+	t.partial = append(t.partial, p[:max(room, 0)]...)
+	t.dropped += len(p) - max(room, 0)
+}
+
+func (t *Tail) push() {
+	line := string(bytes.TrimSuffix(t.partial, []byte("\r")))
+	if t.dropped > 0 {
+		line += fmt.Sprintf("… (%d more bytes)", t.dropped)
+	}
+	t.partial = t.partial[:0]
+	t.dropped = 0
+
+	if len(t.lines) == 0 {
+		return
+	}
+	t.lines[t.next] = line
+	t.next = (t.next + 1) % len(t.lines)
+	if t.next == 0 {
+		t.full = true
+	}
+}
@@ -0,0 +1,164 @@
+package summary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"patrol_install/utils/failure"
+	"patrol_install/utils/print"
+)
+
+// Stage statuses.
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// FileName is the name of the run summary written next to the exported artifacts.
+const FileName = "run_summary.json"
+
+// Stage records the outcome of one stage of the run.
+type Stage struct {
+	Name            string  `json:"name"`
+	Status          string  `json:"status"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	// Retries counts the attempts repeated after a transient failure.
+	Retries         int    `json:"retries"`
+	FailureCategory string `json:"failureCategory,omitempty"`
+	Error           string `json:"error,omitempty"`
+
+	started time.Time
+}
+
+// Flutter describes the Flutter SDK the run was validated against.
+type Flutter struct {
+	Version string `json:"version"`
+	// The fields below are empty when the SDK does not support `flutter --version --machine`.
+	Channel         string `json:"channel,omitempty"`
+	Revision        string `json:"revision,omitempty"`
+	DartVersion     string `json:"dartVersion,omitempty"`
+	DevToolsVersion string `json:"devToolsVersion,omitempty"`
+}
+
+// Summary describes a whole run, stage by stage.
+type Summary struct {
+	Stages  []*Stage `json:"stages"`
+	Flutter *Flutter `json:"flutter,omitempty"`
+	// Interrupted names the signal that stopped the run early; the stages after it never ran.
+	Interrupted string `json:"interrupted,omitempty"`
+}
+
+var (
+	now     = time.Now
+	current = &Summary{}
+)
+
+// Reset starts a new run summary.
+func Reset() {
+	current = &Summary{}
+}
+
+// Current returns the summary of the running process.
+func Current() *Summary {
+	return current
+}
+
+// Begin records the start of a stage. Later retries are counted on it.
+func Begin(name string) *Stage {
+	stage := &Stage{Name: name, Status: StatusRunning, started: now()}
+	current.Stages = append(current.Stages, stage)
+	return stage
+}
+
+// RecordFlutter records the Flutter SDK of the run.
+func RecordFlutter(flutter Flutter) {
+	current.Flutter = &flutter
+}
+
+// RecordRetry counts a retry on the stage begun last.
+func RecordRetry() {
+	if len(current.Stages) == 0 {
+		return
+	}
+	current.Stages[len(current.Stages)-1].Retries++
+}
+
+// End records the outcome of the stage.
+func (s *Stage) End(err error) {
+	s.DurationSeconds = now().Sub(s.started).Round(time.Millisecond).Seconds()
+	if err == nil {
+		s.Status = StatusSucceeded
+		return
+	}
+	s.Error = err.Error()
+	if errors.Is(err, context.Canceled) {
+		s.Status = StatusCancelled
+		return
+	}
+	s.Status = StatusFailed
+	if classification, ok := failure.ClassificationOf(err); ok {
+		s.FailureCategory = string(classification.Category)
+	}
+}
+
+func (f *Flutter) String() string {
+	text := "Flutter " + f.Version
+	for _, detail := range [][2]string{{"channel", f.Channel}, {"revision", f.Revision}, {"Dart", f.DartVersion}, {"DevTools", f.DevToolsVersion}} {
+		if detail[1] != "" {
+			text += fmt.Sprintf(" • %s %s", detail[0], detail[1])
+		}
+	}
+	return text
+}
+
+// Interrupt marks the run as stopped early because of reason.
+func (s *Summary) Interrupt(reason string) {
+	s.Interrupted = reason
+}
+
+// Print logs one line per stage.
+func (s *Summary) Print() {
+	print.StepInitiated("--- Run Summary ---")
+	if s.Interrupted != "" {
+		print.Warning(fmt.Sprintf("Run interrupted (%s), later stages did not run", s.Interrupted))
+	}
+	if s.Flutter != nil {
+		print.Action(s.Flutter.String())
+	}
+	for _, stage := range s.Stages {
+		line := fmt.Sprintf("%s: %s in %.1fs", stage.Name, stage.Status, stage.DurationSeconds)
+		if stage.Retries > 0 {
+			line += fmt.Sprintf(" after %d retries", stage.Retries)
+		}
+		if stage.FailureCategory != "" {
+			line += fmt.Sprintf(" (%s)", stage.FailureCategory)
+		}
+		switch stage.Status {
+		case StatusSucceeded:
+			print.Success(line)
+		case StatusFailed:
+			print.Error(line)
+		default:
+			print.Warning(line)
+		}
+	}
+}
+
+// Save writes the summary as JSON, creating parent folders as needed.
+func (s *Summary) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create folder for %s: %w", path, err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,94 @@
+package summary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"patrol_install/utils/failure"
+)
+
+func TestStages(t *testing.T) {
+	// GIVEN a clock advancing one second per reading
+	Reset()
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	original := now
+	now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	t.Cleanup(func() { now = original })
+
+	// WHEN a stage succeeds after a retry and another fails with a classified error
+	install := Begin("install")
+	RecordRetry()
+	install.End(nil)
+	build := Begin("build")
+	build.End(failure.Wrap(errors.New("exit status 1"), failure.Classify("Connection refused")))
+
+	// THEN both outcomes are recorded
+	stages := Current().Stages
+	if len(stages) != 2 {
+		t.Fatalf("expected 2 stages, got %d", len(stages))
+	}
+	if stages[0].Status != StatusSucceeded || stages[0].Retries != 1 || stages[0].DurationSeconds != 1 {
+		t.Fatalf("unexpected install stage %+v", stages[0])
+	}
+	if stages[1].Status != StatusFailed || stages[1].FailureCategory != string(failure.CategoryNetwork) || stages[1].Error == "" {
+		t.Fatalf("unexpected build stage %+v", stages[1])
+	}
+}
+
+func TestCancelledStage(t *testing.T) {
+	// GIVEN a run interrupted while building
+	Reset()
+	Begin("install").End(nil)
+	build := Begin("build")
+
+	// WHEN the build stage ends with a cancellation and the run is marked interrupted
+	build.End(fmt.Errorf("command cancelled: %w", context.Canceled))
+	Current().Interrupt("received terminated")
+
+	// THEN the partial summary tells the cancelled stage apart from a failure
+	if build.Status != StatusCancelled || build.FailureCategory != "" {
+		t.Fatalf("unexpected build stage %+v", build)
+	}
+	if Current().Interrupted != "received terminated" || len(Current().Stages) != 2 {
+		t.Fatalf("unexpected summary %+v", Current())
+	}
+}
+
+func TestSave(t *testing.T) {
+	// GIVEN a summary with one stage and the Flutter SDK of the run
+	Reset()
+	Begin("export").End(nil)
+	RecordFlutter(Flutter{Version: "3.24.3", Channel: "stable", DartVersion: "3.5.3"})
+	path := filepath.Join(t.TempDir(), "deploy", FileName)
+
+	// WHEN saving it
+	err := Current().Save(path)
+
+	// THEN it is written as JSON, with the Flutter SDK
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var saved Summary
+	if err := json.Unmarshal(data, &saved); err != nil || len(saved.Stages) != 1 || saved.Stages[0].Name != "export" {
+		t.Fatalf("unexpected summary %s (%v)", data, err)
+	}
+	if saved.Flutter == nil || saved.Flutter.Channel != "stable" || saved.Flutter.DartVersion != "3.5.3" {
+		t.Fatalf("unexpected Flutter SDK in %s", data)
+	}
+	if got := saved.Flutter.String(); got != "Flutter 3.24.3 • channel stable • Dart 3.5.3" {
+		t.Fatalf("unexpected description %q", got)
+	}
+}